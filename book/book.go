@@ -0,0 +1,196 @@
+// Package book reads opening books in the Polyglot format.
+//
+// A book is a file of 16 byte big-endian entries sorted by key:
+//
+//	key     uint64, game.Game.PolyglotKey of the position
+//	move    uint16
+//	weight  uint16, how often the move should be played relative to others
+//	learn   uint32, unused
+//
+// Moves hold the destination file and rank in bits 0-5, the origin in bits
+// 6-11 and the promotion (none, knight, bishop, rook, queen) in bits 12-14.
+// Castling is written as the king capturing its own rook.
+package book
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"sort"
+
+	"bareman.net/chess-engine/game"
+	"bareman.net/chess-engine/game/move"
+	"bareman.net/chess-engine/game/piece"
+)
+
+const entrySize = 16
+
+type Entry struct {
+	Key    uint64
+	Move   uint16
+	Weight uint16
+	Learn  uint32
+}
+
+type Book struct {
+	// Sorted by key
+	entries []Entry
+}
+
+// Choice is a book move playable in a position
+type Choice struct {
+	Move   move.Move
+	Weight int
+}
+
+// Open reads the book in the file at path
+func Open(path string) (*Book, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Load(f)
+}
+
+// Load reads a book in the format described in the package documentation
+func Load(r io.Reader) (*Book, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(data)%entrySize != 0 {
+		return nil, errors.New("book: file size is not a whole number of entries")
+	}
+	b := &Book{entries: make([]Entry, len(data)/entrySize)}
+	for i := range b.entries {
+		e := data[i*entrySize:]
+		b.entries[i] = Entry{
+			Key:    binary.BigEndian.Uint64(e),
+			Move:   binary.BigEndian.Uint16(e[8:]),
+			Weight: binary.BigEndian.Uint16(e[10:]),
+			Learn:  binary.BigEndian.Uint32(e[12:]),
+		}
+	}
+	// Books should already be sorted, but searching relies on it
+	if !sort.SliceIsSorted(b.entries, func(i, j int) bool { return b.entries[i].Key < b.entries[j].Key }) {
+		return nil, errors.New("book: entries are not sorted by key")
+	}
+	return b, nil
+}
+
+// Write stores entries in the Polyglot format, sorted by key
+func Write(w io.Writer, entries []Entry) error {
+	sorted := append([]Entry{}, entries...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Key < sorted[j].Key })
+	buf := make([]byte, entrySize)
+	for _, e := range sorted {
+		binary.BigEndian.PutUint64(buf, e.Key)
+		binary.BigEndian.PutUint16(buf[8:], e.Move)
+		binary.BigEndian.PutUint16(buf[10:], e.Weight)
+		binary.BigEndian.PutUint32(buf[12:], e.Learn)
+		if _, err := w.Write(buf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *Book) Len() int {
+	return len(b.entries)
+}
+
+// Moves returns the legal book moves for the position in g, most weighted
+// first. Entries whose moves are illegal in the position are skipped.
+func (b *Book) Moves(g *game.Game) []Choice {
+	key := g.PolyglotKey()
+	i := sort.Search(len(b.entries), func(i int) bool { return b.entries[i].Key >= key })
+	var choices []Choice
+	for ; i < len(b.entries) && b.entries[i].Key == key; i++ {
+		m, err := g.ParseMove(DecodeMove(g, b.entries[i].Move))
+		if err != nil {
+			continue
+		}
+		choices = append(choices, Choice{Move: m, Weight: int(b.entries[i].Weight)})
+	}
+	sort.SliceStable(choices, func(i, j int) bool { return choices[i].Weight > choices[j].Weight })
+	return choices
+}
+
+// Pick chooses a book move for the position in g. With best it takes the
+// most weighted move, otherwise a random one in proportion to the weights.
+// Moves with a weight of zero are never picked. Returns false if the
+// position isn't in the book.
+func (b *Book) Pick(g *game.Game, r *rand.Rand, best bool) (move.Move, bool) {
+	choices := b.Moves(g)
+	total := 0
+	for _, c := range choices {
+		total += c.Weight
+	}
+	if total == 0 {
+		return move.Null, false
+	}
+	if best {
+		return choices[0].Move, true
+	}
+	n := r.Intn(total)
+	for _, c := range choices {
+		if n < c.Weight {
+			return c.Move, true
+		}
+		n -= c.Weight
+	}
+	return choices[0].Move, true
+}
+
+// DecodeMove converts a Polyglot move to coordinate notation in the position
+// in g, where castling is written as the king's two square move
+func DecodeMove(g *game.Game, m uint16) string {
+	to, from := int(m&0x3f), int(m>>6&0x3f)
+	s := square(from) + square(to)
+	if promotion := m >> 12 & 7; promotion != 0 {
+		s += string("nbrq"[promotion-1])
+	}
+
+	if g.Board[from].Type() == piece.King && from/8 == to/8 && from%8 == 4 {
+		switch to % 8 {
+		case 7:
+			s = square(from) + square(from+2)
+		case 0:
+			s = square(from) + square(from-2)
+		}
+	}
+	return s
+}
+
+// EncodeMove converts a legal move to the Polyglot format
+func EncodeMove(m move.Move) uint16 {
+	from, to := m.Origin(), m.Dest()
+	if m.IsCastle() {
+		switch to - from {
+		case 2:
+			to = from + 3
+		case -2:
+			to = from - 4
+		}
+	}
+	encoded := uint16(from<<6 | to)
+	switch m.Promotion().Type() {
+	case piece.Knight:
+		encoded |= 1 << 12
+	case piece.Bishop:
+		encoded |= 2 << 12
+	case piece.Rook:
+		encoded |= 3 << 12
+	case piece.Queen:
+		encoded |= 4 << 12
+	}
+	return encoded
+}
+
+func square(index int) string {
+	return fmt.Sprintf("%c%c", 'a'+index%8, '1'+index/8)
+}
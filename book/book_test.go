@@ -0,0 +1,83 @@
+package book_test
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+
+	"bareman.net/chess-engine/book"
+	"bareman.net/chess-engine/game"
+)
+
+func entry(t *testing.T, g *game.Game, mv string, weight uint16) book.Entry {
+	m, err := g.ParseMove(mv)
+	if err != nil {
+		t.Fatalf("Failed to parse %v: %v\n", mv, err)
+	}
+	return book.Entry{Key: g.PolyglotKey(), Move: book.EncodeMove(m), Weight: weight}
+}
+
+func TestBook(t *testing.T) {
+	start := game.Default()
+	castle, err := game.FromFEN("r3k2r/pppppppp/8/8/8/8/PPPPPPPP/R3K2R w KQkq - 0 1")
+	if err != nil {
+		t.Fatalf("Failed to create game: %v\n", err)
+	}
+	entries := []book.Entry{
+		entry(t, castle, "e1g1", 3),
+		entry(t, start, "d2d4", 5),
+		entry(t, castle, "e1c1", 1),
+		entry(t, start, "e2e4", 10),
+		// Illegal in the position, so skipped
+		{Key: start.PolyglotKey(), Move: 0x0fff, Weight: 100},
+	}
+	var buf bytes.Buffer
+	if err := book.Write(&buf, entries); err != nil {
+		t.Fatalf("Failed to write book: %v\n", err)
+	}
+	b, err := book.Load(&buf)
+	if err != nil {
+		t.Fatalf("Failed to load book: %v\n", err)
+	}
+	if b.Len() != len(entries) {
+		t.Errorf("Expected %v entries, got %v\n", len(entries), b.Len())
+	}
+
+	choices := b.Moves(start)
+	if len(choices) != 2 || choices[0].Move.String() != "e2e4" || choices[1].Move.String() != "d2d4" {
+		t.Errorf("Expected e2e4 then d2d4, got %v\n", choices)
+	}
+	choices = b.Moves(castle)
+	if len(choices) != 2 || choices[0].Move.String() != "e1g1" || choices[1].Move.String() != "e1c1" {
+		t.Errorf("Expected castling both ways, got %v\n", choices)
+	}
+
+	if m, ok := b.Pick(start, nil, true); !ok || m.String() != "e2e4" {
+		t.Errorf("Expected the best move e2e4, got %v\n", m)
+	}
+	r := rand.New(rand.NewSource(1))
+	counts := map[string]int{}
+	for i := 0; i < 1500; i++ {
+		m, _ := b.Pick(start, r, false)
+		counts[m.String()]++
+	}
+	if counts["e2e4"] < 900 || counts["d2d4"] < 400 {
+		t.Errorf("Expected moves picked in proportion to their weights, got %v\n", counts)
+	}
+
+	start.MakeString("a2a3")
+	if _, ok := b.Pick(start, r, false); ok {
+		t.Errorf("Expected a position outside the book to have no move\n")
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	if _, err := book.Load(bytes.NewReader(make([]byte, 20))); err == nil {
+		t.Errorf("Expected an error for a partial entry\n")
+	}
+	unsorted := make([]byte, 32)
+	unsorted[0] = 1
+	if _, err := book.Load(bytes.NewReader(unsorted)); err == nil {
+		t.Errorf("Expected an error for unsorted entries\n")
+	}
+}
@@ -0,0 +1,69 @@
+// Command tbgen builds distance-to-mate tables for endings of up to four
+// pieces and writes them to a directory, to be loaded with the
+// TablebasePath option. Tables needed by the ones asked for are built and
+// written too, and tables already in the directory are reused.
+//
+//	tbgen -out tables KQvK KRvK KPvK KBNvK
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"bareman.net/chess-engine/tablebase"
+)
+
+func main() {
+	out := flag.String("out", ".", "directory to write the tables to")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %v [-out dir] material...\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err := os.MkdirAll(*out, 0o755); err != nil {
+		log.Fatal(err)
+	}
+	tb, err := tablebase.Open(*out)
+	if err != nil {
+		log.Fatal(err)
+	}
+	existing := map[string]bool{}
+	for _, t := range tb.Tables() {
+		existing[t.Name()] = true
+	}
+	for _, material := range flag.Args() {
+		if err := tb.Generate(material); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	for _, t := range tb.Tables() {
+		if existing[t.Name()] {
+			continue
+		}
+		if err := write(filepath.Join(*out, t.Name()+tablebase.Extension), t); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println(t)
+	}
+}
+
+func write(path string, t *tablebase.Table) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := t.Write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
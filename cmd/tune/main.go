@@ -0,0 +1,74 @@
+// Command tune fits the evaluation weights to a file of labelled positions
+// and writes them as JSON, to be loaded with the EvalParams option.
+//
+//	tune -data positions.epd -out params.json
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"bareman.net/chess-engine/eval"
+	"bareman.net/chess-engine/tune"
+)
+
+func main() {
+	data := flag.String("data", "", "file of \"FEN [result]\" lines")
+	out := flag.String("out", "params.json", "file to write the tuned weights to")
+	start := flag.String("params", "", "weights to start from instead of the built-in ones")
+	passes := flag.Int("passes", 100, "most passes over the weights")
+	workers := flag.Int("workers", 0, "goroutines computing the loss, 0 for one per CPU")
+	flag.Parse()
+	if *data == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if *start != "" {
+		if err := eval.LoadParams(*start); err != nil {
+			log.Fatal(err)
+		}
+	}
+	f, err := os.Open(*data)
+	if err != nil {
+		log.Fatal(err)
+	}
+	positions, err := tune.ReadPositions(f)
+	f.Close()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(positions) == 0 {
+		log.Fatal("no positions in ", *data)
+	}
+	fmt.Printf("Read %v positions\n", len(positions))
+
+	t := tune.New(positions)
+	t.Workers = *workers
+	fmt.Printf("K = %.4f\n", t.FitK())
+	t.Report = func(pass int, loss float64) {
+		fmt.Printf("Pass %v: loss %.6f\n", pass, loss)
+		// Save as we go, since tuning large sets takes hours
+		if err := write(*out, eval.CurrentParams()); err != nil {
+			log.Print(err)
+		}
+	}
+	params := t.Tune(eval.CurrentParams(), *passes)
+	if err := write(*out, params); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func write(path string, p eval.Params) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := eval.WriteParams(f, p); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
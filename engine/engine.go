@@ -9,9 +9,16 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
+	"bareman.net/chess-engine/book"
+	"bareman.net/chess-engine/eval"
 	"bareman.net/chess-engine/game"
 	"bareman.net/chess-engine/game/move"
+	"bareman.net/chess-engine/nnue"
+	"bareman.net/chess-engine/search"
+	"bareman.net/chess-engine/syzygy"
+	"bareman.net/chess-engine/tablebase"
 )
 
 type Engine struct {
@@ -19,8 +26,42 @@ type Engine struct {
 	game      *game.Game
 	isDebug   bool
 	isRunning bool
+	// The running search, nil when there is none. The search doesn't hold
+	// mu, so stop and isready are answered while it runs.
+	searcher *search.Searcher
+	// Closed once the running search has sent its bestmove
+	searchDone chan struct{}
+	// Created on first use, so the zero Engine is ready to run
+	table *search.Table
+	// Loaded from the EvalFile option, nil to use the handcrafted evaluation
+	network *nnue.Network
+	// Time kept back from every move for GUI latency, from the Move Overhead
+	// option
+	moveOverhead    time.Duration
+	moveOverheadSet bool
+	// Search threads from the Threads option. 0 means one.
+	threads int
+	// Lines to report from the MultiPV option. 0 means one.
+	multiPV int
+	// Opening book from the BookFile option, used when ownBook is set
+	book     *book.Book
+	ownBook  bool
+	bookBest bool
+	// Created on first use, for picking book moves
+	rand *rand.Rand
+	// Endgame tables from the TablebasePath and SyzygyPath options. The
+	// first is probed when both are set.
+	tablebase *tablebase.Tablebase
+	syzygy    *syzygy.Tablebase
 }
 
+const (
+	defaultMoveOverhead = 10
+	maxMoveOverhead     = 5000
+	maxThreads          = 256
+	maxMultiPV          = 256
+)
+
 func (e *Engine) Run() {
 	e.isRunning = true
 	reader := bufio.NewReader(os.Stdin)
@@ -43,13 +84,23 @@ func (e *Engine) handleCommand(command string) bool {
 	parts := whiteSpace.Split(strings.TrimSpace(command), -1)
 	switch parts[0] {
 	case "uci":
-		e.sendCommand("id name Random Engine")
+		e.sendCommand("id name Bareman")
 		e.sendCommand("id author Caleb B")
 		// send options
 		// Can handle opening and endgame books and more custom settings as well, but I think only Hash is really required.
-		e.sendCommand("option name Hash type spin default 1 min 1 max 128") // Not sure what this should change about the engine. Have to read up about it.
-		e.sendCommand("option name Ponder type check default true")         // Remove if engine doesn't support Pondering
+		e.sendCommand(fmt.Sprintf("option name Hash type spin default %v min %v max %v", search.DefaultHashSize, search.MinHashSize, search.MaxHashSize))
+		e.sendCommand("option name Ponder type check default true") // Remove if engine doesn't support Pondering
 		e.sendCommand("option name UCI_ShowCurrLine type check default false")
+		e.sendCommand(fmt.Sprintf("option name Threads type spin default 1 min 1 max %v", maxThreads))
+		e.sendCommand(fmt.Sprintf("option name MultiPV type spin default 1 min 1 max %v", maxMultiPV))
+		e.sendCommand(fmt.Sprintf("option name Move Overhead type spin default %v min 0 max %v", defaultMoveOverhead, maxMoveOverhead))
+		e.sendCommand("option name OwnBook type check default false")
+		e.sendCommand("option name BookFile type string default <empty>")
+		e.sendCommand("option name BookBestMove type check default false")
+		e.sendCommand("option name TablebasePath type string default <empty>")
+		e.sendCommand("option name SyzygyPath type string default <empty>")
+		e.sendCommand("option name EvalFile type string default <empty>")
+		e.sendCommand("option name EvalParams type string default <empty>")
 
 		e.sendCommand("uciok")
 	case "debug":
@@ -63,28 +114,57 @@ func (e *Engine) handleCommand(command string) bool {
 		defer e.mu.Unlock() //Ready when this process can lock the state?
 		e.sendCommand("readyok")
 	case "setoption":
-		// TODO
+		e.stopSearch()
+		e.handleSetOption(parts[1:])
 	case "ucinewgame":
-		// TODO
+		e.stopSearch()
+		e.mu.Lock()
+		e.game = game.Default()
+		if e.table != nil {
+			e.table.Clear()
+		}
+		e.mu.Unlock()
 	case "position":
-		go e.handlePosition(parts[1:])
+		e.stopSearch()
+		e.handlePosition(parts[1:])
 	case "go":
-		go e.handleGo(parts[1:])
+		e.stopSearch()
+		e.handleGo(parts[1:])
 	case "stop":
-		go e.handleStop()
+		e.stopSearch()
 	case "ponderhit":
-		// TODO
+		e.mu.Lock()
+		if e.searcher != nil {
+			e.searcher.PonderHit()
+		}
+		e.mu.Unlock()
 	case "board":
+		e.stopSearch()
 		e.mu.Lock()
 		fmt.Println(e.game)
 		e.mu.Unlock()
 	case "fen":
+		e.stopSearch()
+		e.mu.Lock()
+		if e.game == nil {
+			e.game = game.Default()
+		}
 		fmt.Println(e.game.ToFEN())
+		e.mu.Unlock()
+	case "eval":
+		e.stopSearch()
+		e.mu.Lock()
+		e.printEval()
+		e.mu.Unlock()
 	case "undo":
+		e.stopSearch()
 		e.mu.Lock()
-		e.game.Unmake()
+		if e.game != nil {
+			e.game.Unmake()
+		}
 		e.mu.Unlock()
 	case "quit":
+		e.stopSearch()
 		e.mu.Lock()
 		e.isRunning = false
 		e.mu.Unlock()
@@ -98,6 +178,155 @@ func (e *Engine) setIsDebug(val bool) {
 	e.isDebug = val
 }
 
+// handleSetOption reads "name <id> [value <x>]". Names may contain spaces.
+func (e *Engine) handleSetOption(command []string) {
+	var name, value []string
+	target := &name
+	for _, word := range command {
+		switch strings.ToLower(word) {
+		case "name":
+			target = &name
+		case "value":
+			target = &value
+		default:
+			*target = append(*target, word)
+		}
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	switch strings.ToLower(strings.Join(name, " ")) {
+	case "hash":
+		size, err := strconv.Atoi(strings.Join(value, ""))
+		if err != nil || size < search.MinHashSize || size > search.MaxHashSize {
+			e.sendCommand("info string Invalid Hash value")
+			return
+		}
+		e.hashTable().Resize(size)
+	case "threads":
+		n, err := strconv.Atoi(strings.Join(value, ""))
+		if err != nil || n < 1 || n > maxThreads {
+			e.sendCommand("info string Invalid Threads value")
+			return
+		}
+		e.threads = n
+	case "multipv":
+		n, err := strconv.Atoi(strings.Join(value, ""))
+		if err != nil || n < 1 || n > maxMultiPV {
+			e.sendCommand("info string Invalid MultiPV value")
+			return
+		}
+		e.multiPV = n
+	case "move overhead":
+		ms, err := strconv.Atoi(strings.Join(value, ""))
+		if err != nil || ms < 0 || ms > maxMoveOverhead {
+			e.sendCommand("info string Invalid Move Overhead value")
+			return
+		}
+		e.moveOverhead = time.Duration(ms) * time.Millisecond
+		e.moveOverheadSet = true
+	case "ownbook":
+		e.ownBook = strings.ToLower(strings.Join(value, "")) == "true"
+	case "bookbestmove":
+		e.bookBest = strings.ToLower(strings.Join(value, "")) == "true"
+	case "bookfile":
+		path := strings.Join(value, " ")
+		if path == "" || path == "<empty>" {
+			e.book = nil
+			return
+		}
+		b, err := book.Open(path)
+		if err != nil {
+			e.sendCommand("info string " + err.Error())
+			return
+		}
+		e.book = b
+		e.sendCommand(fmt.Sprintf("info string Loaded book %v with %v entries", path, b.Len()))
+	case "tablebasepath":
+		path := strings.Join(value, " ")
+		if path == "" || path == "<empty>" {
+			e.tablebase = nil
+			return
+		}
+		tb, err := tablebase.Open(path)
+		if err != nil {
+			e.sendCommand("info string " + err.Error())
+			return
+		}
+		e.tablebase = tb
+		e.sendCommand(fmt.Sprintf("info string Loaded %v tables with up to %v pieces", len(tb.Tables()), tb.MaxPieces()))
+	case "syzygypath":
+		path := strings.Join(value, " ")
+		if path == "" || path == "<empty>" {
+			e.syzygy = nil
+			return
+		}
+		tb, err := syzygy.Open(path)
+		if err != nil {
+			e.sendCommand("info string " + err.Error())
+			return
+		}
+		e.syzygy = tb
+		e.sendCommand(fmt.Sprintf("info string Found %v Syzygy tables with up to %v pieces", tb.Tables(), tb.MaxPieces()))
+	case "evalfile":
+		path := strings.Join(value, " ")
+		if path == "" || path == "<empty>" {
+			e.network = nil
+			return
+		}
+		network, err := nnue.LoadFile(path)
+		if err != nil {
+			e.sendCommand("info string " + err.Error())
+			return
+		}
+		e.network = network
+		e.sendCommand("info string Loaded network " + path)
+	case "evalparams":
+		path := strings.Join(value, " ")
+		if path == "" || path == "<empty>" {
+			return
+		}
+		if err := eval.LoadParams(path); err != nil {
+			e.sendCommand("info string " + err.Error())
+			return
+		}
+		if e.game != nil {
+			e.game.SetPieceSquareTables(eval.Tables())
+		}
+		e.sendCommand("info string Loaded evaluation parameters " + path)
+	}
+}
+
+// bookMove picks a move from the opening book if it is enabled and has the
+// current position. e.mu must be held.
+func (e *Engine) bookMove() (move.Move, bool) {
+	if !e.ownBook || e.book == nil {
+		return move.Null, false
+	}
+	if e.rand == nil {
+		e.rand = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+	return e.book.Pick(e.game, e.rand, e.bookBest)
+}
+
+// overhead returns the Move Overhead option, which defaults to
+// defaultMoveOverhead. e.mu must be held.
+func (e *Engine) overhead() time.Duration {
+	if !e.moveOverheadSet {
+		return defaultMoveOverhead * time.Millisecond
+	}
+	return e.moveOverhead
+}
+
+// hashTable returns the transposition table, creating it if needed. e.mu
+// must be held.
+func (e *Engine) hashTable() *search.Table {
+	if e.table == nil {
+		e.table = search.NewTable(search.DefaultHashSize)
+	}
+	return e.table
+}
+
 func (e *Engine) handlePosition(command []string) {
 	if len(command) == 0 {
 		return
@@ -122,7 +351,7 @@ func (e *Engine) handlePosition(command []string) {
 	}
 	if len(command) > movesIndex {
 		for _, mv := range command[movesIndex+1:] {
-			err := e.game.Make(mv)
+			err := e.game.MakeString(mv)
 			if err != nil {
 				e.sendCommand("info string " + err.Error())
 				break
@@ -135,8 +364,11 @@ func (e *Engine) handlePosition(command []string) {
 func (e *Engine) handleGo(options []string) {
 	e.mu.Lock()
 	defer e.mu.Unlock()
+	if e.game == nil {
+		e.game = game.Default()
+	}
 	moveReg := regexp.MustCompile(move.MoveRegex)
-	var moves []string
+	var searchMoves []move.Move
 	var ponder, infinite bool
 	var wtime, btime, winc, binc, movestogo, depth, nodes, mate, movetime int
 	var opt string
@@ -147,7 +379,12 @@ func (e *Engine) handleGo(options []string) {
 		switch strings.ToLower(opt) {
 		case "searchmoves":
 			for len(options) > 0 && moveReg.MatchString(options[0]) {
-				moves = append(moves, options[0])
+				m, err := e.game.ParseMove(options[0])
+				if err != nil {
+					e.sendCommand("info string " + strings.TrimSpace(err.Error()))
+				} else {
+					searchMoves = append(searchMoves, m)
+				}
 				options = options[1:]
 			}
 		case "ponder":
@@ -204,33 +441,134 @@ func (e *Engine) handleGo(options []string) {
 		}
 	}
 
-	output := fmt.Sprintf(
-		`Running search with the following parameters:
-		Search moves: %s
-		Ponder: %v
-		White time: %v
-		Black Time: %v
-		White Increment: %v
-		Black Increment: %v
-		Moves til Time Change: %v
-		Depth: %v
-		Nodes: %v
-		Mate: %v
-		Move Time: %v
-		Infinite: %v
-		`,
-		moves, ponder, wtime, btime, winc, binc, movestogo, depth, nodes, mate, movetime, infinite)
-	e.sendCommand(output)
-
-	mvs := e.game.AllLegalMoves()
-	ind := rand.Intn(len(mvs))
-	e.sendCommand(fmt.Sprintf("bestmove %v\n", mvs[ind]))
+	// Play from the book without searching when it has a move. Pondering and
+	// analysis always search.
+	if !ponder && !infinite && mate == 0 && len(searchMoves) == 0 {
+		if m, ok := e.bookMove(); ok {
+			e.sendCommand(fmt.Sprintf("bestmove %v", m))
+			return
+		}
+	}
+
+	clock, increment := wtime, winc
+	if !e.game.WhiteToMove {
+		clock, increment = btime, binc
+	}
+	limits := search.Limits{
+		Depth:     depth,
+		Nodes:     nodes,
+		MoveTime:  time.Duration(movetime) * time.Millisecond,
+		Infinite:  infinite,
+		Ponder:    ponder,
+		Time:      time.Duration(clock) * time.Millisecond,
+		Increment: time.Duration(increment) * time.Millisecond,
+		MovesToGo: movestogo,
+		Overhead:  e.overhead(),
+
+		Mate:        mate,
+		SearchMoves: searchMoves,
+	}
+	s := search.New(e.game, limits)
+	s.Report = e.sendInfo
+	s.Message = func(message string) { e.sendCommand("info string " + message) }
+	s.Table = e.hashTable()
+	s.Network = e.network
+	s.Threads = e.threads
+	s.MultiPV = e.multiPV
+	// Only when set, as a nil pointer is not a nil search.Tablebase
+	if e.tablebase != nil {
+		s.Tablebase = e.tablebase
+	} else if e.syzygy != nil {
+		s.Tablebase = e.syzygy
+	}
+	done := make(chan struct{})
+	e.searcher, e.searchDone = s, done
+	go e.runSearch(s, done)
 }
 
-func (e *Engine) handleStop() {
-	moves := e.game.AllLegalMoves()
-	ind := rand.Intn(len(moves))
-	e.sendCommand(fmt.Sprintf("bestmove %v\n", moves[ind]))
+// runSearch runs s to completion and sends exactly one bestmove, then
+// signals done
+func (e *Engine) runSearch(s *search.Searcher, done chan struct{}) {
+	pv := s.Run()
+	switch len(pv) {
+	case 0:
+		e.sendCommand("bestmove 0000")
+	case 1:
+		e.sendCommand(fmt.Sprintf("bestmove %v", pv[0]))
+	default:
+		e.sendCommand(fmt.Sprintf("bestmove %v ponder %v", pv[0], pv[1]))
+	}
+
+	e.mu.Lock()
+	e.searcher, e.searchDone = nil, nil
+	e.mu.Unlock()
+	close(done)
+}
+
+// printEval shows each term of the evaluation of the current position, in
+// centipawns from white's point of view
+func (e *Engine) printEval() {
+	if e.game == nil {
+		e.game = game.Default()
+	}
+	var evaluator eval.Evaluator
+	terms := evaluator.Trace(e.game)
+
+	fmt.Println("          Term  |    White    |    Black    |    Total")
+	fmt.Println("                |   MG    EG  |   MG    EG  |   MG    EG")
+	fmt.Println(" ---------------+-------------+-------------+-------------")
+	var total eval.Score
+	for _, t := range terms {
+		diff := t.White.Sub(t.Black)
+		total = total.Add(diff)
+		fmt.Printf(" %14s | %5d %5d | %5d %5d | %5d %5d\n", t.Name,
+			t.White.Midgame, t.White.Endgame, t.Black.Midgame, t.Black.Endgame, diff.Midgame, diff.Endgame)
+	}
+	fmt.Println(" ---------------+-------------+-------------+-------------")
+	fmt.Printf(" %14s |             |             | %5d %5d\n", "Total", total.Midgame, total.Endgame)
+	fmt.Printf("\nPhase: %v/%v\n", e.game.Phase, eval.MaxPhase)
+
+	score := evaluator.Evaluate(e.game)
+	if !e.game.WhiteToMove {
+		score = -score
+	}
+	fmt.Printf("Evaluation: %+.2f (white side)\n", float64(score)/100)
+
+	if e.network != nil {
+		score = nnue.NewAccumulator(e.network, e.game).Evaluate(e.game)
+		if !e.game.WhiteToMove {
+			score = -score
+		}
+		fmt.Printf("NNUE evaluation: %+.2f (white side)\n", float64(score)/100)
+	}
+}
+
+// stopSearch stops the running search, if any, and waits for its bestmove.
+// Commands that use the game or the options wait this way, so they can't
+// change either under the search.
+func (e *Engine) stopSearch() {
+	e.mu.Lock()
+	s, done := e.searcher, e.searchDone
+	e.mu.Unlock()
+	if s != nil {
+		s.Stop()
+		<-done
+	}
+}
+
+func (e *Engine) sendInfo(info search.Info) {
+	score := fmt.Sprintf("cp %v", search.Centipawns(info.Score))
+	if mate, ok := search.MateIn(info.Score); ok {
+		score = fmt.Sprintf("mate %v", mate)
+	}
+	ms := info.Time.Milliseconds()
+	nps := int64(info.Nodes) * 1000 / (ms + 1)
+	pv := make([]string, len(info.PV))
+	for i, m := range info.PV {
+		pv[i] = m.String()
+	}
+	e.sendCommand(fmt.Sprintf("info multipv %v depth %v score %v nodes %v nps %v hashfull %v tbhits %v time %v pv %v",
+		info.MultiPV, info.Depth, score, info.Nodes, nps, info.Hashfull, info.TBHits, ms, strings.Join(pv, " ")))
 }
 
 func (e *Engine) sendCommand(command string) bool {
@@ -0,0 +1,111 @@
+package engine
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"bareman.net/chess-engine/game"
+	"bareman.net/chess-engine/syzygy"
+)
+
+// run sends commands to e, waiting for each search to finish, and returns
+// what e printed
+func run(t *testing.T, e *Engine, commands ...string) string {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("Failed to create pipe: %v\n", err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	output := make(chan string)
+	go func() {
+		var b bytes.Buffer
+		io.Copy(&b, r)
+		output <- b.String()
+	}()
+
+	e.isRunning = true
+	for _, command := range commands {
+		e.handleCommand(command)
+		e.mu.Lock()
+		done := e.searchDone
+		e.mu.Unlock()
+		if done != nil {
+			<-done
+		}
+	}
+	os.Stdout = stdout
+	w.Close()
+	return <-output
+}
+
+func TestSyzygyRootMoves(t *testing.T) {
+	dir := filepath.Join("..", "syzygy", "testdata")
+	tb, err := syzygy.Open(dir)
+	if err != nil {
+		t.Fatalf("Failed to open tables: %v\n", err)
+	}
+
+	var e Engine
+	output := run(t, &e, "setoption name SyzygyPath value "+dir)
+	if want := "info string Found 7 Syzygy tables with up to 4 pieces"; !strings.Contains(output, want) {
+		t.Errorf("Expected %q, got %q\n", want, output)
+	}
+
+	// At depth 1 the search can't see the mate, so only the tables keep it
+	// on the shortest way
+	for _, fen := range []string{
+		"8/8/8/3k4/8/8/8/KQ6 w - - 10 40",
+		"8/8/8/8/8/2k5/8/K6Q w - - 0 1",
+		"3k4/8/3K4/8/8/8/8/7Q w - - 3 60",
+		"6q1/8/8/8/4k3/8/8/7K b - - 0 1",
+	} {
+		output := run(t, &e, "position fen "+fen, "go depth 1")
+		var best string
+		for _, line := range strings.Split(output, "\n") {
+			if fields := strings.Fields(line); len(fields) > 1 && fields[0] == "bestmove" {
+				best = fields[1]
+			}
+		}
+		g, err := game.FromFEN(fen)
+		if err != nil {
+			t.Fatalf("Failed to create game: %v\n", err)
+		}
+		dtz, _ := tb.ProbeDTZ(g)
+		m, err := g.ParseMove(best)
+		if err != nil {
+			t.Fatalf("Expected a bestmove for %v, got %q\n", fen, output)
+		}
+		g.Make(m)
+		want := -(dtz - 1)
+		if dtz == 1 {
+			// Mated
+			want = -1
+		}
+		if next, _ := tb.ProbeDTZ(g); next != want {
+			t.Errorf("Expected %v to leave a DTZ of %v in %v, got %v\n", best, want, fen, next)
+		}
+	}
+}
+
+func TestGoMateNotFound(t *testing.T) {
+	var e Engine
+	output := run(t, &e, "position startpos", "go mate 1")
+	if !strings.Contains(output, "info string no mate in 1\n") || !strings.Contains(output, "bestmove ") {
+		t.Errorf("Expected no mate and a bestmove, got %q\n", output)
+	}
+}
+
+func TestUCIIdentifies(t *testing.T) {
+	var e Engine
+	output := run(t, &e, "uci")
+	for _, want := range []string{"id name Bareman\n", "id author Caleb B\n", "uciok\n"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("Expected %q in %q\n", want, output)
+		}
+	}
+}
@@ -0,0 +1,237 @@
+// Package eval scores positions for the search.
+//
+// The score blends midgame and endgame terms by how much material is left.
+// Piece-square table sums are kept up to date by game.Game as moves are made
+// and unmade, so evaluating a position doesn't scan the board. Pawn
+// structure is cached by the pawns' own hash, since it rarely changes.
+package eval
+
+import (
+	"bareman.net/chess-engine/game"
+	"bareman.net/chess-engine/game/piece"
+)
+
+// Phase of a position with all pieces on the board. Positions with more
+// (after promotions) count as pure midgame.
+const MaxPhase = 24
+
+// Piece values in centipawns, indexed by piece type
+var (
+	MidgameValues = [7]int{piece.Pawn: 82, piece.Knight: 337, piece.Bishop: 365, piece.Rook: 477, piece.Queen: 1025}
+	EndgameValues = [7]int{piece.Pawn: 94, piece.Knight: 281, piece.Bishop: 297, piece.Rook: 512, piece.Queen: 936}
+	// How much each piece counts towards the midgame phase
+	PhaseWeights = [7]int{piece.Knight: 1, piece.Bishop: 1, piece.Rook: 2, piece.Queen: 4}
+)
+
+// Piece-square tables for white, written with rank 8 at the top so they read
+// like a board. Black uses the same tables mirrored.
+var (
+	midgameTables = [7][64]int{
+		piece.Pawn: {
+			0, 0, 0, 0, 0, 0, 0, 0,
+			50, 50, 50, 50, 50, 50, 50, 50,
+			10, 10, 20, 30, 30, 20, 10, 10,
+			5, 5, 10, 25, 25, 10, 5, 5,
+			0, 0, 0, 20, 20, 0, 0, 0,
+			5, -5, -10, 0, 0, -10, -5, 5,
+			5, 10, 10, -20, -20, 10, 10, 5,
+			0, 0, 0, 0, 0, 0, 0, 0,
+		},
+		piece.Knight: {
+			-50, -40, -30, -30, -30, -30, -40, -50,
+			-40, -20, 0, 0, 0, 0, -20, -40,
+			-30, 0, 10, 15, 15, 10, 0, -30,
+			-30, 5, 15, 20, 20, 15, 5, -30,
+			-30, 0, 15, 20, 20, 15, 0, -30,
+			-30, 5, 10, 15, 15, 10, 5, -30,
+			-40, -20, 0, 5, 5, 0, -20, -40,
+			-50, -40, -30, -30, -30, -30, -40, -50,
+		},
+		piece.Bishop: {
+			-20, -10, -10, -10, -10, -10, -10, -20,
+			-10, 0, 0, 0, 0, 0, 0, -10,
+			-10, 0, 5, 10, 10, 5, 0, -10,
+			-10, 5, 5, 10, 10, 5, 5, -10,
+			-10, 0, 10, 10, 10, 10, 0, -10,
+			-10, 10, 10, 10, 10, 10, 10, -10,
+			-10, 5, 0, 0, 0, 0, 5, -10,
+			-20, -10, -10, -10, -10, -10, -10, -20,
+		},
+		piece.Rook: {
+			0, 0, 0, 0, 0, 0, 0, 0,
+			5, 10, 10, 10, 10, 10, 10, 5,
+			-5, 0, 0, 0, 0, 0, 0, -5,
+			-5, 0, 0, 0, 0, 0, 0, -5,
+			-5, 0, 0, 0, 0, 0, 0, -5,
+			-5, 0, 0, 0, 0, 0, 0, -5,
+			-5, 0, 0, 0, 0, 0, 0, -5,
+			0, 0, 0, 5, 5, 0, 0, 0,
+		},
+		piece.Queen: {
+			-20, -10, -10, -5, -5, -10, -10, -20,
+			-10, 0, 0, 0, 0, 0, 0, -10,
+			-10, 0, 5, 5, 5, 5, 0, -10,
+			-5, 0, 5, 5, 5, 5, 0, -5,
+			0, 0, 5, 5, 5, 5, 0, -5,
+			-10, 5, 5, 5, 5, 5, 0, -10,
+			-10, 0, 5, 0, 0, 0, 0, -10,
+			-20, -10, -10, -5, -5, -10, -10, -20,
+		},
+		piece.King: {
+			-30, -40, -40, -50, -50, -40, -40, -30,
+			-30, -40, -40, -50, -50, -40, -40, -30,
+			-30, -40, -40, -50, -50, -40, -40, -30,
+			-30, -40, -40, -50, -50, -40, -40, -30,
+			-20, -30, -30, -40, -40, -30, -30, -20,
+			-10, -20, -20, -20, -20, -20, -20, -10,
+			20, 20, 0, 0, 0, 0, 20, 20,
+			20, 30, 10, 0, 0, 10, 30, 20,
+		},
+	}
+
+	endgameTables = [7][64]int{
+		piece.Pawn: {
+			0, 0, 0, 0, 0, 0, 0, 0,
+			80, 80, 80, 80, 80, 80, 80, 80,
+			50, 50, 50, 50, 50, 50, 50, 50,
+			30, 30, 30, 30, 30, 30, 30, 30,
+			15, 15, 15, 15, 15, 15, 15, 15,
+			5, 5, 5, 5, 5, 5, 5, 5,
+			0, 0, 0, 0, 0, 0, 0, 0,
+			0, 0, 0, 0, 0, 0, 0, 0,
+		},
+		piece.Knight: {
+			-50, -40, -30, -30, -30, -30, -40, -50,
+			-40, -20, 0, 0, 0, 0, -20, -40,
+			-30, 0, 10, 15, 15, 10, 0, -30,
+			-30, 5, 15, 20, 20, 15, 5, -30,
+			-30, 0, 15, 20, 20, 15, 0, -30,
+			-30, 5, 10, 15, 15, 10, 5, -30,
+			-40, -20, 0, 5, 5, 0, -20, -40,
+			-50, -40, -30, -30, -30, -30, -40, -50,
+		},
+		piece.Bishop: {
+			-20, -10, -10, -10, -10, -10, -10, -20,
+			-10, 0, 0, 0, 0, 0, 0, -10,
+			-10, 0, 5, 10, 10, 5, 0, -10,
+			-10, 5, 10, 15, 15, 10, 5, -10,
+			-10, 5, 10, 15, 15, 10, 5, -10,
+			-10, 0, 5, 10, 10, 5, 0, -10,
+			-10, 0, 0, 0, 0, 0, 0, -10,
+			-20, -10, -10, -10, -10, -10, -10, -20,
+		},
+		piece.Rook: {
+			0, 0, 0, 0, 0, 0, 0, 0,
+			5, 5, 5, 5, 5, 5, 5, 5,
+			0, 0, 0, 0, 0, 0, 0, 0,
+			0, 0, 0, 0, 0, 0, 0, 0,
+			0, 0, 0, 0, 0, 0, 0, 0,
+			0, 0, 0, 0, 0, 0, 0, 0,
+			0, 0, 0, 0, 0, 0, 0, 0,
+			0, 0, 0, 0, 0, 0, 0, 0,
+		},
+		piece.Queen: {
+			-20, -10, -10, -5, -5, -10, -10, -20,
+			-10, 0, 0, 0, 0, 0, 0, -10,
+			-10, 0, 5, 5, 5, 5, 0, -10,
+			-5, 0, 5, 10, 10, 5, 0, -5,
+			-5, 0, 5, 10, 10, 5, 0, -5,
+			-10, 0, 5, 5, 5, 5, 0, -10,
+			-10, 0, 0, 0, 0, 0, 0, -10,
+			-20, -10, -10, -5, -5, -10, -10, -20,
+		},
+		piece.King: {
+			-50, -40, -30, -20, -20, -30, -40, -50,
+			-30, -20, -10, 0, 0, -10, -20, -30,
+			-30, -10, 20, 30, 30, 20, -10, -30,
+			-30, -10, 30, 40, 40, 30, -10, -30,
+			-30, -10, 30, 40, 40, 30, -10, -30,
+			-30, -10, 20, 30, 30, 20, -10, -30,
+			-30, -30, 0, 0, 0, 0, -30, -30,
+			-50, -30, -30, -30, -30, -30, -30, -50,
+		},
+	}
+)
+
+// Tables combines the piece values and piece-square tables in use into the
+// form game.Game sums incrementally
+func Tables() *game.PieceSquareTables {
+	t := &game.PieceSquareTables{Phase: PhaseWeights}
+	for p := piece.King; p <= piece.Queen; p++ {
+		for sq := 0; sq < 64; sq++ {
+			// The tables are written rank 8 first, squares count from a1
+			t.Midgame[p][sq] = MidgameValues[p] + midgameTables[p][sq^56]
+			t.Endgame[p][sq] = EndgameValues[p] + endgameTables[p][sq^56]
+		}
+	}
+	return t
+}
+
+// Score is a pair of midgame and endgame values, in centipawns
+type Score struct {
+	Midgame int
+	Endgame int
+}
+
+func (s Score) Add(o Score) Score {
+	return Score{s.Midgame + o.Midgame, s.Endgame + o.Endgame}
+}
+
+func (s Score) Sub(o Score) Score {
+	return Score{s.Midgame - o.Midgame, s.Endgame - o.Endgame}
+}
+
+// Taper blends the midgame and endgame values by the phase of the position
+func (s Score) Taper(phase int) int {
+	if phase > MaxPhase {
+		phase = MaxPhase
+	}
+	return (s.Midgame*phase + s.Endgame*(MaxPhase-phase)) / MaxPhase
+}
+
+// Names of the terms scored on top of the piece-square tables, in the order
+// Evaluator.terms returns them
+var termNames = [...]string{"Pawn structure", "Free passers", "Mobility", "King safety"}
+
+// Evaluate scores g in centipawns from the point of view of the side to
+// move, without caching
+func Evaluate(g *game.Game) int {
+	var e Evaluator
+	return e.Evaluate(g)
+}
+
+// Evaluate scores g in centipawns from the point of view of the side to move
+func (e *Evaluator) Evaluate(g *game.Game) int {
+	e.useTables(g)
+	total := Score{g.Midgame, g.Endgame}
+	for _, term := range e.terms(g) {
+		total = total.Add(term[0]).Sub(term[1])
+	}
+	score := total.Taper(g.Phase)
+	if !g.WhiteToMove {
+		return -score
+	}
+	return score
+}
+
+// useTables makes g sum the evaluator's piece-square tables. Without any,
+// the game keeps those it has, or takes the ones in use if it has none.
+func (e *Evaluator) useTables(g *game.Game) {
+	switch {
+	case e.tables != nil && g.PieceSquareTables() != e.tables:
+		g.SetPieceSquareTables(e.tables)
+	case e.tables == nil && g.PieceSquareTables() == nil:
+		g.SetPieceSquareTables(Tables())
+	}
+}
+
+// terms scores each of termNames for both sides, by colorIndex
+func (e *Evaluator) terms(g *game.Game) [len(termNames)][2]Score {
+	pawns := e.pawnStructure(g)
+	return [...][2]Score{
+		pawns.scores,
+		freePassers(g, pawns.passed),
+		mobility(g),
+		kingSafety(g),
+	}
+}
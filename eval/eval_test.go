@@ -0,0 +1,77 @@
+package eval_test
+
+import (
+	"math/rand"
+	"testing"
+
+	"bareman.net/chess-engine/eval"
+	"bareman.net/chess-engine/game"
+)
+
+func TestStartIsEven(t *testing.T) {
+	g := game.Default()
+	if score := eval.Evaluate(g); score != 0 {
+		t.Errorf("Expected the start position to score 0, got %v\n", score)
+	}
+	if g.Phase != eval.MaxPhase {
+		t.Errorf("Expected phase %v, got %v\n", eval.MaxPhase, g.Phase)
+	}
+}
+
+func TestSymmetry(t *testing.T) {
+	// Each position and its color-flipped mirror
+	cases := [][2]string{
+		{"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1",
+			"r3k2r/pppbbppp/2n2q1P/1P2p3/3pn3/BN2PNP1/P1PPQPB1/R3K2R b KQkq - 0 1"},
+		{"8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 1",
+			"8/4p1p1/8/1r3P1K/kp5R/3P4/2P5/8 b - - 0 1"},
+	}
+	for _, c := range cases {
+		a, _ := game.FromFEN(c[0])
+		b, _ := game.FromFEN(c[1])
+		if eval.Evaluate(a) != eval.Evaluate(b) {
+			t.Errorf("Expected mirrored positions to score the same, got %v and %v\n", eval.Evaluate(a), eval.Evaluate(b))
+		}
+	}
+}
+
+func TestMaterial(t *testing.T) {
+	g, _ := game.FromFEN("4k3/8/8/8/8/8/8/3QK3 w - - 0 1")
+	if score := eval.Evaluate(g); score < 800 {
+		t.Errorf("Expected white to be a queen up, got %v\n", score)
+	}
+	g, _ = game.FromFEN("4k3/8/8/8/8/8/8/3QK3 b - - 0 1")
+	if score := eval.Evaluate(g); score > -800 {
+		t.Errorf("Expected black to be a queen down, got %v\n", score)
+	}
+}
+
+func TestIncremental(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	g, _ := game.FromFEN("r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1")
+	tables := eval.Tables()
+	g.SetPieceSquareTables(tables)
+	midgame, endgame, phase := g.Midgame, g.Endgame, g.Phase
+	for i := 0; i < 200; i++ {
+		moves := g.AllLegalMoves()
+		if len(moves) == 0 {
+			break
+		}
+		g.MakeUnchecked(moves[r.Intn(len(moves))])
+		fresh, err := game.FromFEN(g.ToFEN())
+		if err != nil {
+			t.Fatalf("Failed to create game: %v\n", err)
+		}
+		fresh.SetPieceSquareTables(tables)
+		if g.Midgame != fresh.Midgame || g.Endgame != fresh.Endgame || g.Phase != fresh.Phase {
+			t.Fatalf("%v: incremental sums %v %v %v differ from %v %v %v\n", g.ToFEN(),
+				g.Midgame, g.Endgame, g.Phase, fresh.Midgame, fresh.Endgame, fresh.Phase)
+		}
+	}
+	for len(g.Moves) > 0 {
+		g.Unmake()
+	}
+	if g.Midgame != midgame || g.Endgame != endgame || g.Phase != phase {
+		t.Errorf("Expected unmaking to restore the sums\n")
+	}
+}
@@ -0,0 +1,139 @@
+package eval
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+)
+
+// Params holds every weight of the handcrafted evaluation, so they can be
+// tuned and saved. Field names match the package variables they set.
+// Piece-square tables are written rank 8 first, like the source.
+type Params struct {
+	MidgameValues [7]int
+	EndgameValues [7]int
+	PhaseWeights  [7]int
+	MidgameTables [7][64]int
+	EndgameTables [7][64]int
+
+	DoubledMidgame    int
+	DoubledEndgame    int
+	IsolatedMidgame   int
+	IsolatedEndgame   int
+	BackwardMidgame   int
+	BackwardEndgame   int
+	ConnectedBonus    [8]int
+	PassedMidgame     [8]int
+	PassedEndgame     [8]int
+	FreePassedEndgame [8]int
+
+	MobilityMidgame [7]int
+	MobilityEndgame [7]int
+	MobilityBase    [7]int
+
+	KingAttackWeights [7]int
+	KingDangerScale   int
+	MaxKingDanger     int
+	PawnShield        [2]int
+	SemiOpenKingFile  int
+	OpenKingFile      int
+}
+
+// CurrentParams returns the weights in use
+func CurrentParams() Params {
+	return Params{
+		MidgameValues: MidgameValues,
+		EndgameValues: EndgameValues,
+		PhaseWeights:  PhaseWeights,
+		MidgameTables: midgameTables,
+		EndgameTables: endgameTables,
+
+		DoubledMidgame:    DoubledMidgame,
+		DoubledEndgame:    DoubledEndgame,
+		IsolatedMidgame:   IsolatedMidgame,
+		IsolatedEndgame:   IsolatedEndgame,
+		BackwardMidgame:   BackwardMidgame,
+		BackwardEndgame:   BackwardEndgame,
+		ConnectedBonus:    ConnectedBonus,
+		PassedMidgame:     PassedMidgame,
+		PassedEndgame:     PassedEndgame,
+		FreePassedEndgame: FreePassedEndgame,
+
+		MobilityMidgame: MobilityMidgame,
+		MobilityEndgame: MobilityEndgame,
+		MobilityBase:    MobilityBase,
+
+		KingAttackWeights: KingAttackWeights,
+		KingDangerScale:   KingDangerScale,
+		MaxKingDanger:     MaxKingDanger,
+		PawnShield:        PawnShield,
+		SemiOpenKingFile:  SemiOpenKingFile,
+		OpenKingFile:      OpenKingFile,
+	}
+}
+
+// SetParams replaces the weights in use. Evaluators created earlier keep
+// their piece-square tables, and games keep theirs until given new ones with
+// Game.SetPieceSquareTables. Not safe to call during a search.
+func SetParams(p Params) {
+	MidgameValues = p.MidgameValues
+	EndgameValues = p.EndgameValues
+	PhaseWeights = p.PhaseWeights
+	midgameTables = p.MidgameTables
+	endgameTables = p.EndgameTables
+
+	DoubledMidgame = p.DoubledMidgame
+	DoubledEndgame = p.DoubledEndgame
+	IsolatedMidgame = p.IsolatedMidgame
+	IsolatedEndgame = p.IsolatedEndgame
+	BackwardMidgame = p.BackwardMidgame
+	BackwardEndgame = p.BackwardEndgame
+	ConnectedBonus = p.ConnectedBonus
+	PassedMidgame = p.PassedMidgame
+	PassedEndgame = p.PassedEndgame
+	FreePassedEndgame = p.FreePassedEndgame
+
+	MobilityMidgame = p.MobilityMidgame
+	MobilityEndgame = p.MobilityEndgame
+	MobilityBase = p.MobilityBase
+
+	KingAttackWeights = p.KingAttackWeights
+	// Used as a divisor
+	if p.KingDangerScale > 0 {
+		KingDangerScale = p.KingDangerScale
+	}
+	MaxKingDanger = p.MaxKingDanger
+	PawnShield = p.PawnShield
+	SemiOpenKingFile = p.SemiOpenKingFile
+	OpenKingFile = p.OpenKingFile
+}
+
+// ReadParams decodes parameters written by WriteParams. Weights missing from
+// the input keep their current values.
+func ReadParams(r io.Reader) (Params, error) {
+	p := CurrentParams()
+	err := json.NewDecoder(r).Decode(&p)
+	return p, err
+}
+
+// WriteParams encodes p as JSON
+func WriteParams(w io.Writer, p Params) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(p)
+}
+
+// LoadParams reads parameters from the file at path and puts them in use
+func LoadParams(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	p, err := ReadParams(f)
+	if err != nil {
+		return err
+	}
+	SetParams(p)
+	return nil
+}
@@ -0,0 +1,79 @@
+package eval_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"bareman.net/chess-engine/eval"
+	"bareman.net/chess-engine/game"
+	"bareman.net/chess-engine/game/piece"
+)
+
+func TestParamsRoundTrip(t *testing.T) {
+	original := eval.CurrentParams()
+	defer eval.SetParams(original)
+
+	p := original
+	p.MidgameValues[1] += 7
+	p.MidgameTables[3][10] -= 5
+	p.PassedEndgame[6] += 11
+	var buf bytes.Buffer
+	if err := eval.WriteParams(&buf, p); err != nil {
+		t.Fatalf("Failed to write params: %v\n", err)
+	}
+	read, err := eval.ReadParams(&buf)
+	if err != nil {
+		t.Fatalf("Failed to read params: %v\n", err)
+	}
+	if read != p {
+		t.Errorf("Params read differ from those written\n")
+	}
+
+	// Missing weights keep their values
+	partial, err := eval.ReadParams(strings.NewReader(`{"OpenKingFile": -30}`))
+	if err != nil {
+		t.Fatalf("Failed to read params: %v\n", err)
+	}
+	want := original
+	want.OpenKingFile = -30
+	if partial != want {
+		t.Errorf("Expected only OpenKingFile to change\n")
+	}
+}
+
+func TestSetParams(t *testing.T) {
+	original := eval.CurrentParams()
+	defer eval.SetParams(original)
+
+	g, _ := game.FromFEN("4k3/8/8/8/8/8/8/3QK3 w - - 0 1")
+	before := eval.Evaluate(g)
+	p := original
+	p.MidgameValues[piece.Queen] += 100
+	p.EndgameValues[piece.Queen] += 100
+	eval.SetParams(p)
+	g.SetPieceSquareTables(eval.Tables())
+	if after := eval.Evaluate(g); after != before+100 {
+		t.Errorf("Expected raising the queen's value by 100 to give %v, got %v\n", before+100, after)
+	}
+}
+
+func TestEvaluatorKeepsTables(t *testing.T) {
+	original := eval.CurrentParams()
+	defer eval.SetParams(original)
+
+	g, _ := game.FromFEN("4k3/8/8/8/8/8/8/3QK3 w - - 0 1")
+	old := eval.New()
+	before := old.Evaluate(g)
+	p := original
+	p.MidgameValues[piece.Queen] += 100
+	p.EndgameValues[piece.Queen] += 100
+	eval.SetParams(p)
+	if after := eval.New().Evaluate(g); after != before+100 {
+		t.Errorf("Expected a new evaluator to give %v, got %v\n", before+100, after)
+	}
+	// Games are given back the tables of the evaluator that scores them
+	if again := old.Evaluate(g); again != before {
+		t.Errorf("Expected the earlier evaluator to still give %v, got %v\n", before, again)
+	}
+}
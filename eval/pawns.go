@@ -0,0 +1,181 @@
+package eval
+
+import (
+	"bareman.net/chess-engine/game"
+	"bareman.net/chess-engine/game/bitboard"
+	"bareman.net/chess-engine/game/piece"
+)
+
+// Number of entries in the pawn hash table of an Evaluator
+const pawnTableSize = 1 << 14
+
+// Pawn structure terms in centipawns. Tables are indexed by rank relative to
+// the pawn's side, so index 6 is one step from promoting.
+var (
+	DoubledMidgame  = -10
+	DoubledEndgame  = -20
+	IsolatedMidgame = -10
+	IsolatedEndgame = -15
+	BackwardMidgame = -8
+	BackwardEndgame = -12
+
+	ConnectedBonus = [8]int{0, 5, 7, 10, 15, 25, 40, 0}
+	PassedMidgame  = [8]int{0, 0, 5, 10, 20, 35, 60, 0}
+	PassedEndgame  = [8]int{0, 10, 15, 25, 45, 75, 120, 0}
+	// Extra endgame bonus for a passed pawn with nothing in front of it
+	FreePassedEndgame = [8]int{0, 0, 5, 10, 20, 35, 60, 0}
+)
+
+var (
+	adjacentFiles [8]bitboard.Bitboard
+	// Squares in front of a pawn on its file, indexed by colorIndex
+	forwardFile [2][64]bitboard.Bitboard
+	// Squares in front of a pawn on its own and adjacent files. A pawn is
+	// passed when no enemy pawns stand there.
+	passedMask [2][64]bitboard.Bitboard
+	// Squares on adjacent files level with or behind a pawn, where pawns
+	// that could defend it as it advances stand
+	supportMask [2][64]bitboard.Bitboard
+)
+
+func init() {
+	for f := 0; f < 8; f++ {
+		if f > 0 {
+			adjacentFiles[f] |= bitboard.File(f - 1)
+		}
+		if f < 7 {
+			adjacentFiles[f] |= bitboard.File(f + 1)
+		}
+	}
+	for sq := 0; sq < 64; sq++ {
+		var above, below bitboard.Bitboard
+		for r := sq>>3 + 1; r < 8; r++ {
+			above |= bitboard.Rank(8 * r)
+		}
+		for r := 0; r < sq>>3; r++ {
+			below |= bitboard.Rank(8 * r)
+		}
+		file, sides := bitboard.File(sq), adjacentFiles[sq&7]
+		forwardFile[0][sq] = file & above
+		forwardFile[1][sq] = file & below
+		passedMask[0][sq] = (file | sides) & above
+		passedMask[1][sq] = (file | sides) & below
+		supportMask[0][sq] = sides &^ above
+		supportMask[1][sq] = sides &^ below
+	}
+}
+
+// pawnEntry caches the parts of the pawn evaluation that depend only on
+// where the pawns are
+type pawnEntry struct {
+	key uint64
+	// Scores by colorIndex
+	scores [2]Score
+	// Passed pawns by colorIndex, scored again for whether their path is free
+	passed [2]bitboard.Bitboard
+}
+
+// Evaluator scores positions, caching pawn structure evaluation between
+// calls. It keeps the piece-square tables in use when it was created, and
+// sets them on the games it evaluates, so changing the weights later
+// doesn't affect a search already running. The zero Evaluator works without
+// a cache or tables of its own. It isn't safe for concurrent use, so each
+// search thread needs its own.
+type Evaluator struct {
+	pawns  []pawnEntry
+	tables *game.PieceSquareTables
+}
+
+func New() *Evaluator {
+	return &Evaluator{pawns: make([]pawnEntry, pawnTableSize), tables: Tables()}
+}
+
+// pawnStructure returns the pawn entry for g, from the cache if possible
+func (e *Evaluator) pawnStructure(g *game.Game) pawnEntry {
+	if e.pawns == nil {
+		return evaluatePawns(g)
+	}
+	slot := &e.pawns[g.PawnHash%pawnTableSize]
+	// Positions without pawns have a key of 0, matching the empty entry
+	if slot.key != g.PawnHash {
+		*slot = evaluatePawns(g)
+	}
+	return *slot
+}
+
+// evaluatePawns scores the pawn structure of g for each side
+func evaluatePawns(g *game.Game) pawnEntry {
+	entry := pawnEntry{key: g.PawnHash}
+	pawns := [2]bitboard.Bitboard{g.Bitboard(piece.Pawn | piece.White), g.Bitboard(piece.Pawn | piece.Black)}
+
+	for c := range pawns {
+		us, them := pawns[c], pawns[1-c]
+		var midgame, endgame int
+		for b := us; b != 0; {
+			sq := b.PopLSB()
+			rank := relativeRank(sq, c)
+
+			doubled := us&forwardFile[c][sq] != 0
+			isolated := us&adjacentFiles[sq&7] == 0
+			supported := us&bitboard.PawnAttacks(sq, colors[1-c]) != 0
+			phalanx := us&adjacentFiles[sq&7]&bitboard.Rank(sq) != 0
+
+			if doubled {
+				midgame += DoubledMidgame
+				endgame += DoubledEndgame
+			}
+			if isolated {
+				midgame += IsolatedMidgame
+				endgame += IsolatedEndgame
+			} else if us&supportMask[c][sq] == 0 && them&bitboard.PawnAttacks(stopSquare(sq, c), colors[c]) != 0 {
+				// No pawn can come to its defence, and it can't advance safely
+				midgame += BackwardMidgame
+				endgame += BackwardEndgame
+			}
+			if supported || phalanx {
+				midgame += ConnectedBonus[rank]
+				endgame += ConnectedBonus[rank]
+			}
+			// Only the front pawn of a doubled pair can be passed
+			if !doubled && them&passedMask[c][sq] == 0 {
+				entry.passed[c] |= bitboard.FromSquare(sq)
+				midgame += PassedMidgame[rank]
+				endgame += PassedEndgame[rank]
+			}
+		}
+		entry.scores[c] = Score{midgame, endgame}
+	}
+	return entry
+}
+
+// freePassers scores passed pawns with nothing in front of them. It depends
+// on the other pieces, so isn't cached.
+func freePassers(g *game.Game, passed [2]bitboard.Bitboard) [2]Score {
+	occupied := g.Occupied()
+	var scores [2]Score
+	for c := range passed {
+		for b := passed[c]; b != 0; {
+			sq := b.PopLSB()
+			if forwardFile[c][sq]&occupied == 0 {
+				scores[c].Endgame += FreePassedEndgame[relativeRank(sq, c)]
+			}
+		}
+	}
+	return scores
+}
+
+// relativeRank counts ranks from the side of the given colorIndex, from 0
+func relativeRank(sq, c int) int {
+	if c == 1 {
+		return 7 - sq>>3
+	}
+	return sq >> 3
+}
+
+// stopSquare is the square in front of a pawn
+func stopSquare(sq, c int) int {
+	if c == 1 {
+		return sq - 8
+	}
+	return sq + 8
+}
@@ -0,0 +1,69 @@
+package eval
+
+import (
+	"math/rand"
+	"testing"
+
+	"bareman.net/chess-engine/game"
+)
+
+func TestPawnTerms(t *testing.T) {
+	cases := []struct {
+		name    string
+		fen     string
+		midgame int
+		endgame int
+	}{
+		{"Isolated", "4k3/8/8/8/8/8/3P4/4K3 w - - 0 1",
+			IsolatedMidgame + PassedMidgame[1], IsolatedEndgame + PassedEndgame[1]},
+		{"Doubled", "4k3/p7/8/8/8/P7/P7/4K3 w - - 0 1",
+			// Both sides have isolated pawns, white has two
+			DoubledMidgame + IsolatedMidgame, DoubledEndgame + IsolatedEndgame},
+		{"Connected passers", "4k3/8/8/3PP3/8/8/8/4K3 w - - 0 1",
+			2 * (ConnectedBonus[4] + PassedMidgame[4]), 2 * (ConnectedBonus[4] + PassedEndgame[4])},
+		// The pawn on d3 can't advance past e5, c4 is passed and defended
+		{"Backward", "4k3/8/8/4p3/2P5/3P4/8/4K3 w - - 0 1",
+			BackwardMidgame + ConnectedBonus[3] + PassedMidgame[3] - IsolatedMidgame,
+			BackwardEndgame + ConnectedBonus[3] + PassedEndgame[3] - IsolatedEndgame},
+		{"Black passer", "4k3/8/8/8/8/3p4/8/4K3 w - - 0 1",
+			-(IsolatedMidgame + PassedMidgame[5]), -(IsolatedEndgame + PassedEndgame[5])},
+	}
+	for _, c := range cases {
+		g, err := game.FromFEN(c.fen)
+		if err != nil {
+			t.Fatalf("Failed to create game with fen '%v'\n", c.fen)
+		}
+		score := evaluatePawns(g).scores
+		midgame, endgame := score[0].Midgame-score[1].Midgame, score[0].Endgame-score[1].Endgame
+		if midgame != c.midgame || endgame != c.endgame {
+			t.Errorf("%v: expected %v %v, got %v %v\n", c.name, c.midgame, c.endgame, midgame, endgame)
+		}
+	}
+}
+
+func TestFreePassers(t *testing.T) {
+	free, _ := game.FromFEN("4k3/8/3P4/8/8/8/8/4K3 w - - 0 1")
+	blocked, _ := game.FromFEN("3k4/8/3P4/8/8/8/8/4K3 w - - 0 1")
+	if score := freePassers(free, evaluatePawns(free).passed); score[0].Endgame != FreePassedEndgame[5] {
+		t.Errorf("Expected a free passer bonus of %v, got %v\n", FreePassedEndgame[5], score[0])
+	}
+	if score := freePassers(blocked, evaluatePawns(blocked).passed); score[0].Endgame != 0 {
+		t.Errorf("Expected no bonus for a blocked passer, got %v\n", score[0])
+	}
+}
+
+func TestPawnCache(t *testing.T) {
+	r := rand.New(rand.NewSource(2))
+	cached := New()
+	g, _ := game.FromFEN("8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 1")
+	for i := 0; i < 300; i++ {
+		moves := g.AllLegalMoves()
+		if len(moves) == 0 {
+			break
+		}
+		g.MakeUnchecked(moves[r.Intn(len(moves))])
+		if a, b := cached.Evaluate(g), Evaluate(g); a != b {
+			t.Fatalf("%v: cached evaluation %v differs from %v\n", g.ToFEN(), a, b)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package eval
+
+import (
+	"bareman.net/chess-engine/game"
+	"bareman.net/chess-engine/game/bitboard"
+	"bareman.net/chess-engine/game/piece"
+)
+
+// Mobility terms in centipawns per safe square attacked, indexed by piece
+// type. Squares up to the base count don't score, so an average piece
+// scores about 0.
+var (
+	MobilityMidgame = [7]int{piece.Knight: 4, piece.Bishop: 5, piece.Rook: 2, piece.Queen: 1}
+	MobilityEndgame = [7]int{piece.Knight: 4, piece.Bishop: 5, piece.Rook: 4, piece.Queen: 2}
+	MobilityBase    = [7]int{piece.Knight: 4, piece.Bishop: 6, piece.Rook: 7, piece.Queen: 13}
+)
+
+// King safety terms in centipawns, only scored in the midgame
+var (
+	// How dangerous each piece type is for every king zone square it attacks
+	KingAttackWeights = [7]int{piece.Knight: 2, piece.Bishop: 2, piece.Rook: 3, piece.Queen: 5}
+	// The squared danger is divided by this to get the penalty
+	KingDangerScale = 4
+	MaxKingDanger   = 500
+	// Bonus for each pawn one and two ranks in front of a castled king
+	PawnShield = [2]int{12, 6}
+	// Penalties for a file next to the king without friendly pawns, and
+	// without any pawns
+	SemiOpenKingFile = -10
+	OpenKingFile     = -20
+)
+
+var (
+	colors         = [2]piece.Piece{piece.White, piece.Black}
+	mobilityPieces = [4]piece.Piece{piece.Knight, piece.Bishop, piece.Rook, piece.Queen}
+)
+
+// mobility counts the squares each piece attacks which aren't occupied by
+// its own side or attacked by enemy pawns
+func mobility(g *game.Game) [2]Score {
+	var scores [2]Score
+	for c, color := range colors {
+		them := colors[1-c]
+		safe := ^(g.Colors[c] | g.PawnAttackMap(them))
+		for _, t := range mobilityPieces {
+			for b := g.Bitboard(t | color); b != 0; {
+				n := (g.AttacksFrom(b.PopLSB()) & safe).Count() - MobilityBase[t]
+				scores[c].Midgame += n * MobilityMidgame[t]
+				scores[c].Endgame += n * MobilityEndgame[t]
+			}
+		}
+	}
+	return scores
+}
+
+// kingSafety scores each king by the enemy pieces attacking the squares
+// around it, the pawns sheltering it and the open files next to it
+func kingSafety(g *game.Game) [2]Score {
+	var scores [2]Score
+	pawns := g.Pieces[piece.Pawn]
+	for c, color := range colors {
+		king := g.Bitboard(piece.King | color).LSB()
+		if king == 64 {
+			continue
+		}
+		zone := bitboard.KingAttacks(king) | bitboard.FromSquare(king)
+
+		attackers, danger := 0, 0
+		for b := g.Colors[1-c] &^ pawns &^ g.Pieces[piece.King]; b != 0; {
+			sq := b.PopLSB()
+			if n := (g.AttacksFrom(sq) & zone).Count(); n > 0 {
+				attackers++
+				danger += n * KingAttackWeights[g.Board[sq].Type()]
+			}
+		}
+		// A lone attacker can rarely break through
+		if attackers >= 2 {
+			penalty := danger * danger / KingDangerScale
+			if penalty > MaxKingDanger {
+				penalty = MaxKingDanger
+			}
+			scores[c].Midgame -= penalty
+		}
+
+		ours := pawns & g.Colors[c]
+		file := king & 7
+		files := bitboard.File(king) | adjacentFiles[file]
+		if relativeRank(king, c) <= 1 {
+			one := stopSquare(king, c)
+			two := stopSquare(one, c)
+			scores[c].Midgame += (ours & files & bitboard.Rank(one)).Count() * PawnShield[0]
+			scores[c].Midgame += (ours & files & bitboard.Rank(two)).Count() * PawnShield[1]
+		}
+		for f := file - 1; f <= file+1; f++ {
+			if f < 0 || f > 7 {
+				continue
+			}
+			switch {
+			case pawns&bitboard.File(f) == 0:
+				scores[c].Midgame += OpenKingFile
+			case ours&bitboard.File(f) == 0:
+				scores[c].Midgame += SemiOpenKingFile
+			}
+		}
+	}
+	return scores
+}
+
+// Term is one part of the evaluation, for the breakdown given by Trace
+type Term struct {
+	Name  string
+	White Score
+	Black Score
+}
+
+// Trace breaks the evaluation of g down into its terms. Material and
+// piece-square values are separated by recounting the pieces.
+func (e *Evaluator) Trace(g *game.Game) []Term {
+	e.useTables(g)
+	material := Term{Name: "Material"}
+	for t := piece.Piece(piece.Pawn); t <= piece.Queen; t++ {
+		white, black := g.Bitboard(t|piece.White).Count(), g.Bitboard(t|piece.Black).Count()
+		material.White = material.White.Add(Score{white * MidgameValues[t], white * EndgameValues[t]})
+		material.Black = material.Black.Add(Score{black * MidgameValues[t], black * EndgameValues[t]})
+	}
+	// Only the difference of the table sums is kept, so that goes to white
+	position := Term{
+		Name:  "Piece-square",
+		White: Score{g.Midgame, g.Endgame}.Sub(material.White).Add(material.Black),
+	}
+
+	terms := []Term{material, position}
+	for i, scores := range e.terms(g) {
+		terms = append(terms, Term{Name: termNames[i], White: scores[0], Black: scores[1]})
+	}
+	return terms
+}
@@ -0,0 +1,56 @@
+package eval
+
+import (
+	"testing"
+
+	"bareman.net/chess-engine/game"
+)
+
+func TestMobility(t *testing.T) {
+	// A centralised knight has more safe squares than one in the corner
+	center, _ := game.FromFEN("4k3/8/8/8/3N4/8/8/4K3 w - - 0 1")
+	corner, _ := game.FromFEN("4k3/8/8/8/8/8/8/N3K3 w - - 0 1")
+	if a, b := mobility(center)[0], mobility(corner)[0]; a.Midgame <= b.Midgame {
+		t.Errorf("Expected the central knight to be more mobile, got %v and %v\n", a, b)
+	}
+	// Squares attacked by enemy pawns aren't safe
+	covered, _ := game.FromFEN("4k3/8/2p1p3/8/3N4/8/8/4K3 w - - 0 1")
+	if a, b := mobility(covered)[0], mobility(center)[0]; a.Midgame >= b.Midgame {
+		t.Errorf("Expected fewer safe squares next to pawns, got %v and %v\n", a, b)
+	}
+}
+
+func TestKingSafety(t *testing.T) {
+	sheltered, _ := game.FromFEN("4k3/8/8/8/8/8/5PPP/6K1 w - - 0 1")
+	exposed, _ := game.FromFEN("4k3/8/8/8/8/5PPP/8/6K1 w - - 0 1")
+	open, _ := game.FromFEN("4k3/8/8/8/8/8/5P2/6K1 w - - 0 1")
+	a, b, c := kingSafety(sheltered)[0], kingSafety(exposed)[0], kingSafety(open)[0]
+	if a.Midgame != 3*PawnShield[0] {
+		t.Errorf("Expected a full shield, got %v\n", a)
+	}
+	if b.Midgame != 3*PawnShield[1] {
+		t.Errorf("Expected an advanced shield, got %v\n", b)
+	}
+	if c.Midgame != PawnShield[0]+2*OpenKingFile {
+		t.Errorf("Expected two open files, got %v\n", c)
+	}
+
+	// A queen and knight bearing down on the king
+	attacked, _ := game.FromFEN("6k1/5ppp/8/6NQ/8/8/5PPP/6K1 b - - 0 1")
+	quiet, _ := game.FromFEN("6k1/5ppp/8/8/Q7/8/5PPP/N5K1 b - - 0 1")
+	if a, b := kingSafety(attacked)[1], kingSafety(quiet)[1]; a.Midgame >= b.Midgame {
+		t.Errorf("Expected attackers on the king zone to be penalised, got %v and %v\n", a, b)
+	}
+}
+
+func TestTrace(t *testing.T) {
+	g, _ := game.FromFEN("r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R b KQkq - 0 1")
+	var e Evaluator
+	var total Score
+	for _, term := range e.Trace(g) {
+		total = total.Add(term.White).Sub(term.Black)
+	}
+	if score := -total.Taper(g.Phase); score != e.Evaluate(g) {
+		t.Errorf("Expected the terms to add up to %v, got %v\n", e.Evaluate(g), score)
+	}
+}
@@ -0,0 +1,17 @@
+package game
+
+import "bareman.net/chess-engine/game/piece"
+
+// Accumulator is told about every piece added to or removed from the board,
+// so evaluation state can follow the position as moves are made and unmade.
+// Unmaking a move reports the same changes in reverse.
+type Accumulator interface {
+	Add(p piece.Piece, index int)
+	Remove(p piece.Piece, index int)
+}
+
+// SetAccumulator attaches a, which must already reflect the current position,
+// to be updated as the board changes. A nil a detaches the current one.
+func (g *Game) SetAccumulator(a Accumulator) {
+	g.accumulator = a
+}
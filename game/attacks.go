@@ -0,0 +1,41 @@
+package game
+
+import (
+	"bareman.net/chess-engine/game/bitboard"
+	"bareman.net/chess-engine/game/piece"
+)
+
+// AttacksFrom returns the squares attacked by the piece on index, given the
+// current occupancy. Returns Empty if the square is empty.
+func (g *Game) AttacksFrom(index int) bitboard.Bitboard {
+	p := g.Board[index]
+	switch p.Type() {
+	case piece.Empty:
+		return bitboard.Empty
+	case piece.Pawn:
+		return bitboard.PawnAttacks(index, p.Color())
+	default:
+		return bitboard.Attacks(p.Type(), index, g.Occupied())
+	}
+}
+
+// AttackMap returns every square attacked by a piece of color
+func (g *Game) AttackMap(color piece.Piece) bitboard.Bitboard {
+	us := g.Colors[colorIndex(color)]
+	attacks := g.PawnAttackMap(color)
+	others := us &^ g.Pieces[piece.Pawn]
+	for others != 0 {
+		attacks |= g.AttacksFrom(others.PopLSB())
+	}
+	return attacks
+}
+
+// PawnAttackMap returns every square attacked by a pawn of color
+func (g *Game) PawnAttackMap(color piece.Piece) bitboard.Bitboard {
+	return bitboard.PawnSetAttacks(g.Bitboard(piece.Pawn|color), color)
+}
+
+// AttackersOf returns the pieces of color attacking index
+func (g *Game) AttackersOf(index int, color piece.Piece) bitboard.Bitboard {
+	return g.attackers(index, color, g.Occupied())
+}
@@ -0,0 +1,48 @@
+package game_test
+
+import (
+	"testing"
+
+	"bareman.net/chess-engine/game"
+	"bareman.net/chess-engine/game/bitboard"
+	"bareman.net/chess-engine/game/piece"
+)
+
+func TestAttackMap(t *testing.T) {
+	for _, position := range TestingPositions() {
+		g, err := game.FromFEN(position.Fen)
+		if err != nil {
+			t.Fatalf("Failed to create game with fen '%v'\n", position.Fen)
+		}
+		for _, color := range []piece.Piece{piece.White, piece.Black} {
+			attacks := g.AttackMap(color)
+			for sq := 0; sq < 64; sq++ {
+				if attacks.Has(sq) != g.AttackedBy(sq, color) {
+					t.Errorf("%v: attack map disagrees with AttackedBy on square %v\n", position.Fen, sq)
+				}
+				attackers := g.AttackersOf(sq, color)
+				for b := attackers; b != 0; {
+					if from := b.PopLSB(); !g.AttacksFrom(from).Has(sq) {
+						t.Errorf("%v: piece on %v attacks %v but AttacksFrom disagrees\n", position.Fen, from, sq)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestAttacksFrom(t *testing.T) {
+	g := game.Default()
+	// b1 knight, d1 queen and e2 pawn
+	cases := map[int]bitboard.Bitboard{
+		1:  bitboard.FromSquare(16) | bitboard.FromSquare(18) | bitboard.FromSquare(11),
+		3:  bitboard.FromSquare(2) | bitboard.FromSquare(4) | bitboard.FromSquare(10) | bitboard.FromSquare(11) | bitboard.FromSquare(12),
+		12: bitboard.FromSquare(19) | bitboard.FromSquare(21),
+		30: bitboard.Empty,
+	}
+	for sq, expected := range cases {
+		if a := g.AttacksFrom(sq); a != expected {
+			t.Errorf("Wrong attacks from %v:\n%v", sq, a)
+		}
+	}
+}
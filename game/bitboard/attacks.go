@@ -0,0 +1,117 @@
+package bitboard
+
+import "bareman.net/chess-engine/game/piece"
+
+var (
+	between [64][64]Bitboard
+	line    [64][64]Bitboard
+
+	knightAttacks [64]Bitboard
+	kingAttacks   [64]Bitboard
+	// Indexed by color: 0 for white, 1 for black
+	pawnAttacks [2][64]Bitboard
+)
+
+func init() {
+	for sq := 0; sq < 64; sq++ {
+		b := FromSquare(sq)
+
+		knightAttacks[sq] = (b<<17|b>>15)&^FileA |
+			(b<<15|b>>17)&^FileH |
+			(b<<10|b>>6)&^(FileA|FileB) |
+			(b<<6|b>>10)&^(FileG|FileH)
+
+		kingAttacks[sq] = (b<<9|b<<1|b>>7)&^FileA |
+			(b<<7|b>>1|b>>9)&^FileH |
+			b<<8 | b>>8
+
+		pawnAttacks[0][sq] = b<<9&^FileA | b<<7&^FileH
+		pawnAttacks[1][sq] = b>>7&^FileA | b>>9&^FileH
+	}
+	initMagics()
+	initLines()
+}
+
+func initLines() {
+	for a := 0; a < 64; a++ {
+		for b := 0; b < 64; b++ {
+			if a == b {
+				continue
+			}
+			ends := FromSquare(a) | FromSquare(b)
+			for _, attacks := range []func(int, Bitboard) Bitboard{BishopAttacks, RookAttacks} {
+				if attacks(a, Empty).Has(b) {
+					between[a][b] = attacks(a, ends) & attacks(b, ends)
+					line[a][b] = attacks(a, Empty)&attacks(b, Empty) | ends
+				}
+			}
+		}
+	}
+}
+
+// Between returns the squares strictly between a and b if they share a
+// rank, file or diagonal, and Empty otherwise
+func Between(a, b int) Bitboard {
+	return between[a][b]
+}
+
+// Line returns the full rank, file or diagonal through a and b, or Empty if
+// they aren't aligned
+func Line(a, b int) Bitboard {
+	return line[a][b]
+}
+
+func KnightAttacks(sq int) Bitboard {
+	return knightAttacks[sq]
+}
+
+func KingAttacks(sq int) Bitboard {
+	return kingAttacks[sq]
+}
+
+// PawnAttacks returns the squares a pawn of the given color on sq attacks
+func PawnAttacks(sq int, color piece.Piece) Bitboard {
+	return pawnAttacks[color>>4][sq]
+}
+
+func BishopAttacks(sq int, occupied Bitboard) Bitboard {
+	m := &bishopMagics[sq]
+	return m.attacks[((occupied&m.mask)*m.magic)>>m.shift]
+}
+
+func RookAttacks(sq int, occupied Bitboard) Bitboard {
+	m := &rookMagics[sq]
+	return m.attacks[((occupied&m.mask)*m.magic)>>m.shift]
+}
+
+func QueenAttacks(sq int, occupied Bitboard) Bitboard {
+	return BishopAttacks(sq, occupied) | RookAttacks(sq, occupied)
+}
+
+// Attacks returns the squares a piece of type t on sq attacks. Pawns need a
+// color, so use PawnAttacks for those.
+func Attacks(t piece.Piece, sq int, occupied Bitboard) Bitboard {
+	switch t {
+	case piece.Knight:
+		return knightAttacks[sq]
+	case piece.Bishop:
+		return BishopAttacks(sq, occupied)
+	case piece.Rook:
+		return RookAttacks(sq, occupied)
+	case piece.Queen:
+		return QueenAttacks(sq, occupied)
+	case piece.King:
+		return kingAttacks[sq]
+	default:
+		return Empty
+	}
+}
+
+// PawnSetAttacks returns the squares attacked by any of the pawns of the
+// given color
+func PawnSetAttacks(pawns Bitboard, color piece.Piece) Bitboard {
+	if color == piece.White {
+		return pawns<<9&^FileA | pawns<<7&^FileH
+	}
+	return pawns>>7&^FileA | pawns>>9&^FileH
+}
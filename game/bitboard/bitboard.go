@@ -0,0 +1,78 @@
+// Package bitboard provides a 64-bit set of squares along with precomputed
+// attack tables for every piece type.
+//
+// Squares are numbered 0 (a1) to 63 (h8), rank by rank.
+package bitboard
+
+import (
+	"math/bits"
+	"strings"
+)
+
+type Bitboard uint64
+
+const (
+	Empty Bitboard = 0
+	Full  Bitboard = ^Empty
+
+	FileA Bitboard = 0x0101010101010101
+	FileB Bitboard = FileA << 1
+	FileG Bitboard = FileA << 6
+	FileH Bitboard = FileA << 7
+
+	Rank1 Bitboard = 0xFF
+	Rank2 Bitboard = Rank1 << (8 * 1)
+	Rank3 Bitboard = Rank1 << (8 * 2)
+	Rank4 Bitboard = Rank1 << (8 * 3)
+	Rank5 Bitboard = Rank1 << (8 * 4)
+	Rank6 Bitboard = Rank1 << (8 * 5)
+	Rank7 Bitboard = Rank1 << (8 * 6)
+	Rank8 Bitboard = Rank1 << (8 * 7)
+)
+
+func FromSquare(sq int) Bitboard {
+	return 1 << sq
+}
+
+func File(sq int) Bitboard {
+	return FileA << (sq & 7)
+}
+
+func Rank(sq int) Bitboard {
+	return Rank1 << (sq &^ 7)
+}
+
+func (b Bitboard) Has(sq int) bool {
+	return b&(1<<sq) != 0
+}
+
+func (b Bitboard) Count() int {
+	return bits.OnesCount64(uint64(b))
+}
+
+// LSB returns the lowest set square. Returns 64 if the bitboard is empty
+func (b Bitboard) LSB() int {
+	return bits.TrailingZeros64(uint64(b))
+}
+
+// PopLSB removes and returns the lowest set square
+func (b *Bitboard) PopLSB() int {
+	sq := bits.TrailingZeros64(uint64(*b))
+	*b &= *b - 1
+	return sq
+}
+
+func (b Bitboard) String() string {
+	var sb strings.Builder
+	for y := 7; y >= 0; y-- {
+		for x := 0; x < 8; x++ {
+			if b.Has(8*y + x) {
+				sb.WriteString("1 ")
+			} else {
+				sb.WriteString(". ")
+			}
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
@@ -0,0 +1,88 @@
+package bitboard
+
+import (
+	"testing"
+
+	"bareman.net/chess-engine/game/piece"
+)
+
+func TestLeaperAttacks(t *testing.T) {
+	// a1, d4 and h8
+	knights := map[int]int{0: 2, 27: 8, 63: 2}
+	for sq, count := range knights {
+		if n := KnightAttacks(sq).Count(); n != count {
+			t.Errorf("Expected %v knight attacks from %v, got %v\n", count, sq, n)
+		}
+	}
+	kings := map[int]int{0: 3, 27: 8, 63: 3}
+	for sq, count := range kings {
+		if n := KingAttacks(sq).Count(); n != count {
+			t.Errorf("Expected %v king attacks from %v, got %v\n", count, sq, n)
+		}
+	}
+	// e2 pawn attacks d3 and f3
+	if a := PawnAttacks(12, piece.White); a != FromSquare(19)|FromSquare(21) {
+		t.Errorf("Wrong white pawn attacks from e2:\n%v", a)
+	}
+	// a7 pawn attacks b6
+	if a := PawnAttacks(48, piece.Black); a != FromSquare(41) {
+		t.Errorf("Wrong black pawn attacks from a7:\n%v", a)
+	}
+
+	pawns := Rank2 | Rank7 | FromSquare(27)
+	for _, color := range []piece.Piece{piece.White, piece.Black} {
+		var expected Bitboard
+		for b := pawns; b != 0; {
+			expected |= PawnAttacks(b.PopLSB(), color)
+		}
+		if a := PawnSetAttacks(pawns, color); a != expected {
+			t.Errorf("Wrong set-wise pawn attacks for %v:\n%v", color, a)
+		}
+	}
+}
+
+func TestSlidingAttacks(t *testing.T) {
+	rng := uint64(42)
+	next := func() uint64 {
+		rng ^= rng << 13
+		rng ^= rng >> 7
+		rng ^= rng << 17
+		return rng
+	}
+	for sq := 0; sq < 64; sq++ {
+		for i := 0; i < 100; i++ {
+			occ := Bitboard(next() & next())
+			if got, want := RookAttacks(sq, occ), slidingAttacks(sq, occ, rookDirections); got != want {
+				t.Fatalf("Rook attacks from %v differ.\nOccupancy:\n%vGot:\n%vWant:\n%v", sq, occ, got, want)
+			}
+			if got, want := BishopAttacks(sq, occ), slidingAttacks(sq, occ, bishopDirections); got != want {
+				t.Fatalf("Bishop attacks from %v differ.\nOccupancy:\n%vGot:\n%vWant:\n%v", sq, occ, got, want)
+			}
+		}
+	}
+}
+
+func BenchmarkRookAttacks(b *testing.B) {
+	var occ Bitboard = 0x00FF00000000FF00
+	for i := 0; i < b.N; i++ {
+		RookAttacks(i&63, occ)
+	}
+}
+
+func TestLines(t *testing.T) {
+	// a1 to h8
+	if b := Between(0, 63); b.Count() != 6 || !b.Has(27) {
+		t.Errorf("Wrong squares between a1 and h8:\n%v", b)
+	}
+	if l := Line(9, 18); l.Count() != 8 || !l.Has(0) || !l.Has(63) {
+		t.Errorf("Wrong line through b2 and c3:\n%v", l)
+	}
+	// e1 to e4
+	if b := Between(4, 28); b != FromSquare(12)|FromSquare(20) {
+		t.Errorf("Wrong squares between e1 and e4:\n%v", b)
+	}
+	// b1 and c3 aren't aligned
+	if Between(1, 18) != Empty || Line(1, 18) != Empty {
+		t.Errorf("Expected b1 and c3 not to be aligned\n")
+	}
+}
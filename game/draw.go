@@ -0,0 +1,55 @@
+package game
+
+import (
+	"bareman.net/chess-engine/game/bitboard"
+	"bareman.net/chess-engine/game/piece"
+)
+
+// Repetitions returns how many times the current position has occurred
+// before in the game. Only positions since the last capture or pawn move
+// can repeat, and only those with the same side to move.
+func (g *Game) Repetitions() int {
+	count := 0
+	limit := len(g.history) - g.HalfMove
+	if limit < 0 {
+		limit = 0
+	}
+	for i := len(g.history) - 2; i >= limit; i -= 2 {
+		if g.history[i].Hash == g.Hash {
+			count++
+		}
+	}
+	return count
+}
+
+// IsThreefoldRepetition reports whether the current position has occurred
+// at least three times
+func (g *Game) IsThreefoldRepetition() bool {
+	return g.Repetitions() >= 2
+}
+
+// IsFiftyMoveDraw reports whether fifty moves by each side have been played
+// without a capture or pawn move
+func (g *Game) IsFiftyMoveDraw() bool {
+	return g.HalfMove >= 100
+}
+
+// IsInsufficientMaterial reports whether neither side can possibly
+// checkmate: king against king, a lone minor piece, or only bishops that all
+// stand on the same color of square.
+func (g *Game) IsInsufficientMaterial() bool {
+	heavy := g.Pieces[piece.Pawn] | g.Pieces[piece.Rook] | g.Pieces[piece.Queen]
+	if heavy != 0 {
+		return false
+	}
+	minors := g.Pieces[piece.Knight] | g.Pieces[piece.Bishop]
+	if minors.Count() <= 1 {
+		return true
+	}
+	if g.Pieces[piece.Knight] != 0 {
+		return false
+	}
+	const darkSquares bitboard.Bitboard = 0xAA55AA55AA55AA55
+	bishops := g.Pieces[piece.Bishop]
+	return bishops&darkSquares == 0 || bishops&^darkSquares == 0
+}
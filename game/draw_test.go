@@ -0,0 +1,93 @@
+package game_test
+
+import (
+	"testing"
+
+	"bareman.net/chess-engine/game"
+)
+
+func TestThreefoldRepetition(t *testing.T) {
+	g := game.Default()
+	shuffle := []string{"g1f3", "g8f6", "f3g1", "f6g8"}
+	for i := 0; i < 2; i++ {
+		for _, mv := range shuffle {
+			if g.IsThreefoldRepetition() {
+				t.Fatalf("Repetition detected too early, before %v in round %v\n", mv, i)
+			}
+			if err := g.MakeString(mv); err != nil {
+				t.Fatalf("Failed to make %v: %v\n", mv, err)
+			}
+		}
+	}
+	if !g.IsThreefoldRepetition() {
+		t.Errorf("Expected threefold repetition after shuffling knights twice\n")
+	}
+	g.Unmake()
+	if g.IsThreefoldRepetition() {
+		t.Errorf("Expected no repetition after unmaking\n")
+	}
+}
+
+func TestRepetitionResetByPawnMove(t *testing.T) {
+	g := game.Default()
+	moves := []string{"g1f3", "g8f6", "f3g1", "f6g8", "e2e3", "e7e6", "g1f3", "g8f6", "f3g1", "f6g8"}
+	for _, mv := range moves {
+		if err := g.MakeString(mv); err != nil {
+			t.Fatalf("Failed to make %v: %v\n", mv, err)
+		}
+	}
+	if n := g.Repetitions(); n != 1 {
+		t.Errorf("Expected 1 earlier occurrence, got %v\n", n)
+	}
+}
+
+func TestHalfMoveClock(t *testing.T) {
+	g, err := game.FromFEN("4k3/8/8/8/8/8/4P3/R3K3 w - - 98 60")
+	if err != nil {
+		t.Fatalf("Failed to create game: %v\n", err)
+	}
+	if g.IsFiftyMoveDraw() {
+		t.Errorf("Expected no fifty move draw at 98 half moves\n")
+	}
+	g.MakeString("a1a2")
+	g.MakeString("e8d8")
+	if !g.IsFiftyMoveDraw() || g.HalfMove != 100 {
+		t.Errorf("Expected fifty move draw, half move clock is %v\n", g.HalfMove)
+	}
+	g.MakeString("e2e4")
+	if g.HalfMove != 0 {
+		t.Errorf("Expected pawn move to reset the clock, got %v\n", g.HalfMove)
+	}
+	g.Unmake()
+	g.Unmake()
+	g.Unmake()
+	if g.HalfMove != 98 {
+		t.Errorf("Expected unmaking to restore the clock to 98, got %v\n", g.HalfMove)
+	}
+}
+
+func TestInsufficientMaterial(t *testing.T) {
+	cases := map[string]bool{
+		"8/8/4k3/8/8/3K4/8/8 w - - 0 1":      true,
+		"8/8/4k3/8/8/3KN3/8/8 w - - 0 1":     true,
+		"8/8/4kb2/8/8/3K4/8/8 w - - 0 1":     true,
+		"8/8/4kb2/8/8/3KB3/8/8 w - - 0 1":    true,
+		"8/8/4k1b1/8/8/3KB3/8/8 w - - 0 1":   false,
+		"8/8/4k3/8/8/3KNN2/8/8 w - - 0 1":    false,
+		"8/8/4kn2/8/8/3KB3/8/8 w - - 0 1":    false,
+		"8/8/4k3/8/8/3KP3/8/8 w - - 0 1":     false,
+		"8/8/4k3/8/8/3K1R2/8/8 w - - 0 1":    false,
+		"8/8/4k3/8/8/3K1q2/8/8 w - - 0 1":    false,
+		"8/8/4k1b1/8/8/3KB1B1/8/8 w - - 0 1": false,
+		"8/8/4k1b1/8/8/3K1B2/8/8 w - - 0 1":  true,
+	}
+	for fen, expected := range cases {
+		g, err := game.FromFEN(fen)
+		if err != nil {
+			t.Fatalf("Failed to create game with fen '%v'\n", fen)
+		}
+		if g.IsInsufficientMaterial() != expected {
+			t.Errorf("%v: expected insufficient material to be %v\n", fen, expected)
+		}
+	}
+}
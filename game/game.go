@@ -2,16 +2,20 @@ package game
 
 import (
 	"fmt"
-	"sync"
 
+	"bareman.net/chess-engine/game/bitboard"
 	"bareman.net/chess-engine/game/move"
 	"bareman.net/chess-engine/game/piece"
 )
 
 type Game struct {
-	Mu          sync.Mutex
-	Board       [64]piece.Piece
-	Moves       []*move.Move
+	Board [64]piece.Piece
+	// Bitboards indexed by piece type, holding both colors
+	Pieces [7]bitboard.Bitboard
+	// Bitboards indexed by colorIndex
+	Colors      [2]bitboard.Bitboard
+	Moves       []move.Move
+	history     []boardState
 	MoveCount   int
 	HalfMove    int
 	WhiteToMove bool
@@ -20,8 +24,30 @@ type Game struct {
 	BQCastle    bool
 	BKCastle    bool
 	EPTarget    int
-	hashKeys    [781]uint64
 	Hash        uint64
+	// Hash of the pawns alone, for caching pawn structure evaluation
+	PawnHash uint64
+	// Sums of the piece-square tables, white minus black, kept up to date as
+	// pieces move. See SetPieceSquareTables.
+	Midgame int
+	Endgame int
+	// Total phase weight of the pieces on the board, for tapering between
+	// the midgame and endgame
+	Phase int
+	// Optional, see SetPieceSquareTables
+	tables *PieceSquareTables
+	// Optional, see SetAccumulator
+	accumulator Accumulator
+}
+
+// Clone returns a copy of g that can be played on independently, for
+// example by another search thread. The copy has no accumulator.
+func (g *Game) Clone() *Game {
+	c := *g
+	c.Moves = append([]move.Move(nil), g.Moves...)
+	c.history = append([]boardState(nil), g.history...)
+	c.accumulator = nil
+	return &c
 }
 
 func (g *Game) String() string {
@@ -56,132 +82,109 @@ func (g *Game) Piece(position string) piece.Piece {
 	return g.Board[index]
 }
 
-func (g *Game) Score() int {
-	score := 0
-	for _, p := range g.Board {
-		if p.IsWhite() == g.WhiteToMove {
-			score += p.Score()
-		} else {
-			score -= p.Score()
-		}
-	}
-	return 0
+func (g *Game) Occupied() bitboard.Bitboard {
+	return g.Colors[0] | g.Colors[1]
 }
 
-// Will ignore En-Passant
-func (g *Game) Attackers(position string) []string {
-
-	p := g.Piece(position)
-	if p == piece.Empty {
-		if g.WhiteToMove {
-			p = piece.Black
-		} else {
-			p = piece.White
-		}
-	}
+// PieceCount counts the pieces on the board, kings and pawns included
+func (g *Game) PieceCount() int {
+	return g.Occupied().Count()
+}
 
-	atks := []string{}
+// CanCastle reports whether either side still has a castling right
+func (g *Game) CanCastle() bool {
+	return g.WKCastle || g.WQCastle || g.BKCastle || g.BQCastle
+}
 
-	start := indexFromPosition(position)
+// Bitboard returns the squares holding p
+func (g *Game) Bitboard(p piece.Piece) bitboard.Bitboard {
+	return g.Pieces[p.Type()] & g.Colors[colorIndex(p.Color())]
+}
 
-	// Check pawns
-	pMoves := g.pawnMoves(start, p.Color())
-	for _, m := range pMoves {
-		if g.Piece(m[2:4]).Type() == piece.Pawn {
-			atks = append(atks, m[2:4])
-		}
+func (g *Game) sideToMove() piece.Piece {
+	if g.WhiteToMove {
+		return piece.White
 	}
+	return piece.Black
+}
 
-	// Check king
-	kMoves := g.kingMoves(start, p.Color())
-	for _, m := range kMoves {
-		if g.Piece(m[2:4]).Type() == piece.King {
-			atks = append(atks, m[2:4])
-		}
+// put places p on the empty square index
+func (g *Game) put(p piece.Piece, index int) {
+	b := bitboard.FromSquare(index)
+	g.Board[index] = p
+	g.Pieces[p.Type()] |= b
+	g.Colors[colorIndex(p.Color())] |= b
+	g.updateTables(p, index, 1)
+	if g.accumulator != nil {
+		g.accumulator.Add(p, index)
 	}
+}
 
-	// Check bishop/half queen
-	bMoves := g.bishopMoves(start, p.Color())
-	for _, m := range bMoves {
-		if g.Piece(m[2:4]).Type() == piece.Bishop || g.Piece(m[2:4]).Type() == piece.Queen {
-			atks = append(atks, m[2:4])
-		}
+// remove clears index and returns the piece that was there
+func (g *Game) remove(index int) piece.Piece {
+	p := g.Board[index]
+	if p == piece.Empty {
+		return p
 	}
-
-	// Check rook/other half queen
-	rMoves := g.rookMoves(start, p.Color())
-	for _, m := range rMoves {
-		if g.Piece(m[2:4]).Type() == piece.Rook || g.Piece(m[2:4]).Type() == piece.Queen {
-			atks = append(atks, m[2:4])
-		}
+	b := bitboard.FromSquare(index)
+	g.Board[index] = piece.Empty
+	g.Pieces[p.Type()] &^= b
+	g.Colors[colorIndex(p.Color())] &^= b
+	g.updateTables(p, index, -1)
+	if g.accumulator != nil {
+		g.accumulator.Remove(p, index)
 	}
+	return p
+}
 
-	// Check knight
-	nMoves := g.knightMoves(start, p.Color())
-	for _, m := range nMoves {
-		if g.Piece(m[2:4]).Type() == piece.Knight {
-			atks = append(atks, m[2:4])
-		}
+// Will ignore En-Passant
+func (g *Game) Attackers(position string) []string {
+	start := indexFromPosition(position)
+	if start == -1 {
+		return []string{}
 	}
 
+	atks := []string{}
+	attackers := g.attackers(start, g.attackingColor(start), g.Occupied())
+	for attackers != 0 {
+		atks = append(atks, positionFromIndex(attackers.PopLSB()))
+	}
 	return atks
 }
 
 // Will Ignore EnPassant
 func (g *Game) IsAttacked(position string) bool {
-
-	p := g.Piece(position)
-	if p == piece.Empty {
-		if g.WhiteToMove {
-			p = piece.Black
-		} else {
-			p = piece.White
-		}
-	}
-
 	start := indexFromPosition(position)
-
-	// Check pawns
-	pMoves := g.pawnMoves(start, p.Color())
-	for _, m := range pMoves {
-		if g.Piece(m[2:4]).Type() == piece.Pawn {
-			return true
-		}
-	}
-
-	// Check king
-	kMoves := g.kingMoves(start, p.Color())
-	for _, m := range kMoves {
-		if g.Piece(m[2:4]).Type() == piece.King {
-			return true
-		}
-	}
-
-	// Check bishop/half queen
-	bMoves := g.bishopMoves(start, p.Color())
-	for _, m := range bMoves {
-		if g.Piece(m[2:4]).Type() == piece.Bishop || g.Piece(m[2:4]).Type() == piece.Queen {
-			return true
-		}
+	if start == -1 {
+		return false
 	}
+	return g.isAttacked(start, g.attackingColor(start))
+}
 
-	// Check rook/other half queen
-	rMoves := g.rookMoves(start, p.Color())
-	for _, m := range rMoves {
-		if g.Piece(m[2:4]).Type() == piece.Rook || g.Piece(m[2:4]).Type() == piece.Queen {
-			return true
-		}
+// attackingColor is the color that would attack the piece on index. Empty
+// squares are treated as if they held a piece of the side not to move.
+func (g *Game) attackingColor(index int) piece.Piece {
+	p := g.Board[index]
+	if p == piece.Empty {
+		return g.sideToMove()
 	}
+	return opponent(p.Color())
+}
 
-	// Check knight
-	nMoves := g.knightMoves(start, p.Color())
-	for _, m := range nMoves {
-		if g.Piece(m[2:4]).Type() == piece.Knight {
-			return true
-		}
-	}
+// attackers returns the pieces of color attacking index, given the occupied squares
+func (g *Game) attackers(index int, color piece.Piece, occupied bitboard.Bitboard) bitboard.Bitboard {
+	diagonal := g.Pieces[piece.Bishop] | g.Pieces[piece.Queen]
+	orthogonal := g.Pieces[piece.Rook] | g.Pieces[piece.Queen]
+	return g.Colors[colorIndex(color)] &
+		(bitboard.PawnAttacks(index, opponent(color))&g.Pieces[piece.Pawn] |
+			bitboard.KnightAttacks(index)&g.Pieces[piece.Knight] |
+			bitboard.KingAttacks(index)&g.Pieces[piece.King] |
+			bitboard.BishopAttacks(index, occupied)&diagonal |
+			bitboard.RookAttacks(index, occupied)&orthogonal)
+}
 
-	return false
+func (g *Game) isAttacked(index int, color piece.Piece) bool {
+	return g.attackers(index, color, g.Occupied()) != 0
 }
 
 func (g *Game) ToFEN() string {
@@ -237,46 +240,55 @@ func (g *Game) ToFEN() string {
 	return fmt.Sprintf("%v %v %v %v %v %v", boardString, playerToMove, castlingRights, epPosition, g.HalfMove, g.MoveCount)
 }
 
+// Perft results are cached by hash and remaining depth
+type perftEntry struct {
+	hash  uint64
+	depth int
+	nodes int
+}
+
+const perftTableSize = 1 << 20
+
 func (g *Game) Perft(depth int) int {
-	transpositions := make(map[uint64]int)
-	return g.perft(depth, transpositions)
+	transpositions := make([]perftEntry, perftTableSize)
+	lists := make([]move.List, depth+1)
+	return g.perft(depth, transpositions, lists)
 }
 
-func (g *Game) perft(depth int, transpositions map[uint64]int) int {
+func (g *Game) perft(depth int, transpositions []perftEntry, lists []move.List) int {
 	if depth == 0 {
 		return 1
 	}
+	entry := &transpositions[g.Hash&(perftTableSize-1)]
+	if entry.hash == g.Hash && entry.depth == depth {
+		return entry.nodes
+	}
 
-	moves := g.AllLegalMoves()
+	list := &lists[depth]
+	g.LegalMoves(list)
+	if depth == 1 {
+		return list.Len()
+	}
 	var moveCount int
-	for _, mv := range moves {
-		m, _ := move.EmptyMove(mv)
+	for _, m := range list.Slice() {
 		g.make(m)
-
-		mvs, ok := transpositions[g.Hash]
-		if !ok {
-			mvs = g.perft(depth-1, transpositions)
-			transpositions[g.Hash] = mvs
-		}
-		moveCount += mvs
+		moveCount += g.perft(depth-1, transpositions, lists)
 		g.Unmake()
 	}
+	*entry = perftEntry{hash: g.Hash, depth: depth, nodes: moveCount}
 	return moveCount
 }
 
-func (g *Game) DividedPerft(depth int) map[string]int {
+func (g *Game) DividedPerft(depth int) map[move.Move]int {
+	results := make(map[move.Move]int)
 	if depth == 0 {
-		return make(map[string]int)
+		return results
 	}
-	transpositions := make(map[uint64]int)
-	moves := g.PseudoLegalMoves("")
-	results := make(map[string]int)
-	for _, mv := range moves {
-		err := g.Make(mv)
-		if err != nil {
-			continue
-		}
-		results[mv] = g.perft(depth-1, transpositions)
+	transpositions := make([]perftEntry, perftTableSize)
+	lists := make([]move.List, depth+1)
+	for _, m := range g.AllLegalMoves() {
+		g.make(m)
+		results[m] = g.perft(depth-1, transpositions, lists)
 		g.Unmake()
 	}
 	return results
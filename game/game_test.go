@@ -2,9 +2,12 @@ package game_test
 
 import (
 	"fmt"
+	"strings"
 	"testing"
 
 	"bareman.net/chess-engine/game"
+	"bareman.net/chess-engine/game/move"
+	"bareman.net/chess-engine/game/piece"
 )
 
 type Position struct {
@@ -27,7 +30,7 @@ func TestingPositions() []Position {
 			Name:  "Kiwipete",
 			Fen:   "r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1",
 			Depth: []int{1, 2, 3, 5},
-			Nodes: []int{48, 2039, 97_862, 1_936_900_690},
+			Nodes: []int{48, 2039, 97_862, 193_690_690},
 		},
 		{
 			Name:  "Endgame",
@@ -53,6 +56,24 @@ func TestingPositions() []Position {
 			Depth: []int{1, 2, 3, 5},
 			Nodes: []int{46, 2_079, 89_890, 164_075_551},
 		},
+		{
+			Name:  "Castling Rights",
+			Fen:   "r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1",
+			Depth: []int{1, 2, 3, 4},
+			Nodes: []int{26, 568, 13_744, 314_346},
+		},
+		{
+			Name:  "Castling Rights Lost",
+			Fen:   "r3k2r/1b4bq/8/8/8/8/7B/R3K2R w KQkq - 0 1",
+			Depth: []int{1, 2, 3, 4},
+			Nodes: []int{26, 1_141, 27_826, 1_274_206},
+		},
+		{
+			Name:  "Castling Prevented",
+			Fen:   "r3k2r/8/3Q4/8/8/5q2/8/R3K2R b KQkq - 0 1",
+			Depth: []int{1, 2, 3, 4},
+			Nodes: []int{44, 1_494, 50_509, 1_720_476},
+		},
 	}
 }
 
@@ -77,6 +98,18 @@ func TestFEN(t *testing.T) {
 	}
 }
 
+func TestFromBoard(t *testing.T) {
+	var board [64]piece.Piece
+	board[4] = piece.King | piece.White
+	board[12] = piece.Pawn | piece.White
+	board[60] = piece.King | piece.Black
+	g := game.FromBoard(board, false)
+	want, _ := game.FromFEN("4k3/8/8/8/8/8/4P3/4K3 b - - 0 1")
+	if g.ToFEN() != want.ToFEN() || g.Hash != want.Hash || g.PawnHash != want.PawnHash {
+		t.Errorf("Expected %v, got %v\n", want.ToFEN(), g.ToFEN())
+	}
+}
+
 func TestMoves(t *testing.T) {
 	positions := TestingPositions()
 
@@ -88,8 +121,8 @@ func TestMoves(t *testing.T) {
 			continue
 		}
 		for i, depth := range position.Depth {
-			if position.Nodes[i] > 90_000 {
-				t.Logf("Skipping depth %v. Too slow\n", depth)
+			if testing.Short() && position.Nodes[i] > 90_000 {
+				t.Logf("Skipping depth %v in short mode\n", depth)
 				break
 			}
 			calculatedNodes := g.Perft(depth)
@@ -102,6 +135,75 @@ func TestMoves(t *testing.T) {
 	}
 }
 
+func TestCastlingRights(t *testing.T) {
+	cases := []struct {
+		moves  []string
+		rights string
+	}{
+		{[]string{"h1h2"}, "Qkq"},
+		{[]string{"a1a2"}, "Kkq"},
+		{[]string{"e1e2"}, "kq"},
+		{[]string{"h1h8"}, "Qq"},
+		{[]string{"a1a8"}, "Kk"},
+		{[]string{"h1g1", "h8g8", "g1h1", "g8h8"}, "Qq"},
+		{[]string{"e1g1"}, "kq"},
+		{[]string{"e1c1", "e8g8"}, "-"},
+	}
+	for _, c := range cases {
+		g, err := game.FromFEN("r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1")
+		if err != nil {
+			t.Fatalf("Failed to create game: %v\n", err)
+		}
+		start := g.ToFEN()
+		for _, mv := range c.moves {
+			if err := g.MakeString(mv); err != nil {
+				t.Fatalf("Failed to make %v: %v\n", mv, err)
+			}
+		}
+		if rights := strings.Fields(g.ToFEN())[2]; rights != c.rights {
+			t.Errorf("After %v expected castling rights %v, got %v\n", c.moves, c.rights, rights)
+		}
+		if g.Hash != game.Hash(g) {
+			t.Errorf("Hash does not match after %v\n", c.moves)
+		}
+		for range c.moves {
+			g.Unmake()
+		}
+		if g.ToFEN() != start {
+			t.Errorf("Unmaking %v gave %v\n", c.moves, g.ToFEN())
+		}
+		if g.Hash != game.Hash(g) {
+			t.Errorf("Hash does not match after unmaking %v\n", c.moves)
+		}
+	}
+}
+
+func TestCastlingAfterRookMoves(t *testing.T) {
+	g, err := game.FromFEN("r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1")
+	if err != nil {
+		t.Fatalf("Failed to create game: %v\n", err)
+	}
+	for _, mv := range []string{"h1h2", "a8b8", "h2h1", "b8a8"} {
+		if err := g.MakeString(mv); err != nil {
+			t.Fatalf("Failed to make %v: %v\n", mv, err)
+		}
+	}
+	if g.IsMoveLegal(mustParse(t, "e1g1")) {
+		t.Errorf("White should not be able to castle kingside after the rook moved\n")
+	}
+	if !g.IsMoveLegal(mustParse(t, "e1c1")) {
+		t.Errorf("White should still be able to castle queenside\n")
+	}
+}
+
+func mustParse(t *testing.T, mv string) move.Move {
+	m, err := move.Parse(mv)
+	if err != nil {
+		t.Fatalf("Failed to parse %v: %v\n", mv, err)
+	}
+	return m
+}
+
 func TestIncrementalHash(t *testing.T) {
 	positions := TestingPositions()
 
@@ -120,15 +222,95 @@ func TestIncrementalHash(t *testing.T) {
 			if g.Hash != game.Hash(g) {
 				t.Errorf("Hashes do not match after making move\n")
 			}
+			if g.PawnHash != game.PawnHash(g) {
+				t.Errorf("Pawn hashes do not match after making %v\n", m)
+			}
 			g.Unmake()
 			if g.Hash != game.Hash(g) {
 				t.Errorf("Hashes do not match after Unmaking move\n")
 			}
+			if g.PawnHash != game.PawnHash(g) {
+				t.Errorf("Pawn hashes do not match after unmaking %v\n", m)
+			}
 		}
 
 	}
 }
 
+func TestClone(t *testing.T) {
+	g, err := game.FromFEN("r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1")
+	if err != nil {
+		t.Fatalf("Failed to create game: %v\n", err)
+	}
+	g.MakeString("e1g1")
+	fen := g.ToFEN()
+
+	c := g.Clone()
+	if c.Hash != g.Hash || c.ToFEN() != fen {
+		t.Fatalf("Expected the clone to match the original\n")
+	}
+	for _, m := range []string{"e7d8", "a1b1"} {
+		if err := c.MakeString(m); err != nil {
+			t.Fatalf("Failed to make %v: %v\n", m, err)
+		}
+	}
+	if g.ToFEN() != fen || len(g.Moves) != 1 {
+		t.Errorf("Playing on the clone changed the original\n")
+	}
+	c.Unmake()
+	c.Unmake()
+	c.Unmake()
+	g.Unmake()
+	if c.Hash != g.Hash || c.ToFEN() != g.ToFEN() {
+		t.Errorf("Expected the clone to unmake back to the original\n")
+	}
+}
+
+func TestMoveStrings(t *testing.T) {
+	g, err := game.FromFEN("r3k2r/1P6/8/3pP3/8/8/8/R3K2R w KQkq d6 0 1")
+	if err != nil {
+		t.Fatalf("Failed to create game: %v\n", err)
+	}
+	start := g.ToFEN()
+	cases := []struct {
+		mv    string
+		flags []move.Flag
+	}{
+		{"e5d6", []move.Flag{move.Capture, move.EnPassant}},
+		{"e1g1", []move.Flag{move.Castle}},
+		{"e1c1", []move.Flag{move.Castle}},
+		{"b7a8q", []move.Flag{move.Capture}},
+		{"b7b8N", nil},
+	}
+	for _, c := range cases {
+		m, err := g.ParseMove(c.mv)
+		if err != nil {
+			t.Errorf("Failed to parse %v: %v\n", c.mv, err)
+			continue
+		}
+		for _, f := range c.flags {
+			if !m.Is(f) {
+				t.Errorf("Expected %v to have flag %b\n", c.mv, f)
+			}
+		}
+		if err := g.Make(m); err != nil {
+			t.Errorf("Failed to make %v: %v\n", c.mv, err)
+			continue
+		}
+		g.Unmake()
+		if g.ToFEN() != start {
+			t.Errorf("Unmaking %v gave %v\n", c.mv, g.ToFEN())
+		}
+	}
+
+	for _, mv := range []string{"e5e6e", "b7b8", "e1e3", "a1a9"} {
+		if err := g.MakeString(mv); err == nil {
+			t.Errorf("Expected %v to be rejected\n", mv)
+			g.Unmake()
+		}
+	}
+}
+
 func BenchmarkMoveGeneration(b *testing.B) {
 	b.StopTimer()
 	positions := TestingPositions()
@@ -182,8 +364,9 @@ func BenchmarkPseudolegalMoves(b *testing.B) {
 			b.Errorf("Failed to build game from Fen %v\n", p.Fen)
 			continue
 		}
+		var list move.List
 		b.StartTimer()
-		b.Run(p.Name, func(b *testing.B) { g.PseudoLegalMoves("") })
+		b.Run(p.Name, func(b *testing.B) { g.PseudoLegalMoves(&list) })
 		b.StopTimer()
 	}
 }
@@ -16,75 +16,84 @@ const (
 	EPTargetHashIndexStart = 773
 )
 
-func (g *Game) InitializeHash() {
-	var seed int64 = rand.Int63()
-	source := rand.NewSource(seed)
-	r := rand.New(source)
-	// fmt.Printf("Hashing using seed %v\n", seed)
-	for i := 0; i < 781; i++ {
-		g.hashKeys[i] = r.Uint64()
+// Seed of the default hash keys
+const DefaultHashSeed = 0x5eed
+
+// Zobrist keys shared by every game, so equal positions always hash equal,
+// across games and between runs
+var hashKeys [781]uint64
+
+func init() {
+	SetHashSeed(DefaultHashSeed)
+}
+
+// SetHashSeed replaces the hash keys with ones generated from seed. Hashes
+// of games that already exist are no longer valid, so this should only be
+// called before creating any, for example in tests.
+func SetHashSeed(seed int64) {
+	r := rand.New(rand.NewSource(seed))
+	for i := range hashKeys {
+		hashKeys[i] = r.Uint64()
 	}
 }
 
 // Must be done after making/before unmaking to work properly
-func (g *Game) incrementHash(m *move.Move, p piece.Piece) {
-	g.Hash ^= g.hashKeys[hashIndex(p, m.OriginIndex())]
-	if m.Promotion == piece.Empty {
-		g.Hash ^= g.hashKeys[hashIndex(p, m.DestIndex())]
+func (g *Game) incrementHash(m move.Move, p piece.Piece, state *boardState) {
+	origin, dest := m.Origin(), m.Dest()
+	g.togglePiece(p, origin)
+	if m.Promotion() == piece.Empty {
+		g.togglePiece(p, dest)
 	} else {
-		g.Hash ^= g.hashKeys[hashIndex(m.Promotion, m.DestIndex())]
+		g.togglePiece(m.Promotion(), dest)
 	}
 
-	if m.Capture != piece.Empty && !m.EnPassant {
-		g.Hash ^= g.hashKeys[hashIndex(m.Capture, m.DestIndex())]
+	if state.Capture != piece.Empty && !m.IsEnPassant() {
+		g.togglePiece(state.Capture, dest)
 	}
-	if m.EnPassant {
-		file := m.Dest[0]
-		rank := m.Origin[1]
-		index := indexFromPosition(string(file) + string(rank))
-		g.Hash ^= g.hashKeys[hashIndex(m.Capture, index)]
+	if m.IsEnPassant() {
+		g.togglePiece(state.Capture, epCaptureIndex(origin, dest))
 	}
 
-	if m.Castle {
-		rank := m.Origin[1]
-		file := byte(int(m.Origin[0]) + (int(m.Dest[0])-int(m.Origin[0]))/2)
-		rePos := string(file) + string(rank)
-		rsPos := "a" + string(rank)
-		if file > m.Origin[0] {
-			rsPos = "h" + string(rank)
-		}
-		reIndex := indexFromPosition(rePos)
-		rsIndex := indexFromPosition(rsPos)
-
-		g.Hash ^= g.hashKeys[hashIndex(piece.Rook|p.Color(), reIndex)]
-		g.Hash ^= g.hashKeys[hashIndex(piece.Rook|p.Color(), rsIndex)]
+	if m.IsCastle() {
+		rookStart, rookEnd := castleRookIndices(origin, dest)
+		g.togglePiece(piece.Rook|p.Color(), rookEnd)
+		g.togglePiece(piece.Rook|p.Color(), rookStart)
 	}
 
-	g.Hash ^= g.hashKeys[BTMHashIndex]
-	if g.WKCastle != m.BoardState.WKCastle {
-		g.Hash ^= g.hashKeys[WKCastleHashIndex]
+	g.Hash ^= hashKeys[BTMHashIndex]
+	if g.WKCastle != state.WKCastle {
+		g.Hash ^= hashKeys[WKCastleHashIndex]
 	}
-	if g.WQCastle != m.BoardState.WQCastle {
-		g.Hash ^= g.hashKeys[WQCastleHashIndex]
+	if g.WQCastle != state.WQCastle {
+		g.Hash ^= hashKeys[WQCastleHashIndex]
 	}
-	if g.BKCastle != m.BoardState.BKCastle {
-		g.Hash ^= g.hashKeys[BKCastleHashIndex]
+	if g.BKCastle != state.BKCastle {
+		g.Hash ^= hashKeys[BKCastleHashIndex]
 	}
-	if g.BQCastle != m.BoardState.BQCastle {
-		g.Hash ^= g.hashKeys[BQCastleHashIndex]
+	if g.BQCastle != state.BQCastle {
+		g.Hash ^= hashKeys[BQCastleHashIndex]
 	}
-	if g.EPTarget != m.BoardState.EPTarget {
+	if g.EPTarget != state.EPTarget {
 		if g.EPTarget != -1 {
 			_, col := coordinates(g.EPTarget)
-			g.Hash ^= g.hashKeys[BQCastleHashIndex+col]
+			g.Hash ^= hashKeys[EPTargetHashIndexStart+col]
 		}
-		if m.BoardState.EPTarget != -1 {
-			_, col := coordinates(m.BoardState.EPTarget)
-			g.Hash ^= g.hashKeys[BQCastleHashIndex+col]
+		if state.EPTarget != -1 {
+			_, col := coordinates(state.EPTarget)
+			g.Hash ^= hashKeys[EPTargetHashIndexStart+col]
 		}
 	}
 }
 
+// togglePiece adds or removes p on index from the hashes
+func (g *Game) togglePiece(p piece.Piece, index int) {
+	key := hashKeys[hashIndex(p, index)]
+	g.Hash ^= key
+	if p.Type() == piece.Pawn {
+		g.PawnHash ^= key
+	}
+}
+
 func hashIndex(p piece.Piece, index int) int {
 	return (int(p.Type()-1)<<1+int(p)>>4)<<6 + index
 }
@@ -96,29 +105,41 @@ func Hash(g *Game) uint64 {
 	for i, p := range g.Board {
 		if p != piece.Empty {
 			hashKeyIndex := hashIndex(p, i)
-			hash ^= g.hashKeys[hashKeyIndex]
+			hash ^= hashKeys[hashKeyIndex]
 		}
 	}
 	// q on square 63 would be index 767
 	if !g.WhiteToMove {
-		hash ^= g.hashKeys[BTMHashIndex]
+		hash ^= hashKeys[BTMHashIndex]
 	}
 	if g.WKCastle {
-		hash ^= g.hashKeys[WKCastleHashIndex]
+		hash ^= hashKeys[WKCastleHashIndex]
 	}
 	if g.WQCastle {
-		hash ^= g.hashKeys[WQCastleHashIndex]
+		hash ^= hashKeys[WQCastleHashIndex]
 	}
 	if g.BKCastle {
-		hash ^= g.hashKeys[BKCastleHashIndex]
+		hash ^= hashKeys[BKCastleHashIndex]
 	}
 	if g.BQCastle {
-		hash ^= g.hashKeys[BQCastleHashIndex]
+		hash ^= hashKeys[BQCastleHashIndex]
 	}
 	if g.EPTarget != -1 {
 		_, col := coordinates(g.EPTarget)
-		hash ^= g.hashKeys[BQCastleHashIndex+col]
+		hash ^= hashKeys[EPTargetHashIndexStart+col]
 	}
 
 	return hash
 }
+
+// PawnHash hashes only the pawns of g, so positions with the same pawn
+// structure share a key
+func PawnHash(g *Game) uint64 {
+	var hash uint64
+	pawns := g.Pieces[piece.Pawn]
+	for pawns != 0 {
+		i := pawns.PopLSB()
+		hash ^= hashKeys[hashIndex(g.Board[i], i)]
+	}
+	return hash
+}
@@ -0,0 +1,101 @@
+package game_test
+
+import (
+	"math/rand"
+	"testing"
+
+	"bareman.net/chess-engine/game"
+)
+
+func TestHashEqualAcrossGames(t *testing.T) {
+	for _, position := range TestingPositions() {
+		a, err := game.FromFEN(position.Fen)
+		if err != nil {
+			t.Fatalf("Failed to create game with fen '%v'\n", position.Fen)
+		}
+		b, _ := game.FromFEN(position.Fen)
+		if a.Hash != b.Hash || a.PawnHash != b.PawnHash {
+			t.Errorf("%v: games from the same FEN hash differently\n", position.Fen)
+		}
+		if c := a.Clone(); c.Hash != a.Hash {
+			t.Errorf("%v: clone hashes differently\n", position.Fen)
+		}
+	}
+}
+
+func TestHashTranspositions(t *testing.T) {
+	orders := [][]string{
+		{"g1f3", "g8f6", "b1c3", "b8c6"},
+		{"b1c3", "b8c6", "g1f3", "g8f6"},
+		{"g1f3", "b8c6", "b1c3", "g8f6"},
+	}
+	var want uint64
+	for i, moves := range orders {
+		g := game.Default()
+		for _, m := range moves {
+			if err := g.MakeString(m); err != nil {
+				t.Fatalf("Failed to make %v: %v\n", m, err)
+			}
+		}
+		fromFEN, _ := game.FromFEN(g.ToFEN())
+		if g.Hash != fromFEN.Hash || g.PawnHash != fromFEN.PawnHash {
+			t.Errorf("%v: hash after making moves differs from the hash of its FEN\n", moves)
+		}
+		if i == 0 {
+			want = g.Hash
+		} else if g.Hash != want {
+			t.Errorf("%v: expected the transposition to hash as %x, got %x\n", moves, want, g.Hash)
+		}
+	}
+}
+
+func TestHashRandomGames(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for _, position := range TestingPositions() {
+		g, err := game.FromFEN(position.Fen)
+		if err != nil {
+			t.Fatalf("Failed to create game with fen '%v'\n", position.Fen)
+		}
+		var hashes []uint64
+		for i := 0; i < 60; i++ {
+			moves := g.AllLegalMoves()
+			if len(moves) == 0 {
+				break
+			}
+			hashes = append(hashes, g.Hash)
+			g.MakeUnchecked(moves[r.Intn(len(moves))])
+			fromFEN, err := game.FromFEN(g.ToFEN())
+			if err != nil {
+				t.Fatalf("Failed to create game with fen '%v'\n", g.ToFEN())
+			}
+			if g.Hash != fromFEN.Hash {
+				t.Fatalf("%v: hash after %v differs from the hash of its FEN\n", g.ToFEN(), g.Moves)
+			}
+		}
+		for i := len(hashes) - 1; i >= 0; i-- {
+			g.Unmake()
+			if g.Hash != hashes[i] {
+				t.Fatalf("%v: unmaking did not restore the hash\n", position.Fen)
+			}
+		}
+	}
+}
+
+func TestSetHashSeed(t *testing.T) {
+	defer game.SetHashSeed(game.DefaultHashSeed)
+	start := game.Default().Hash
+
+	game.SetHashSeed(42)
+	seeded := game.Default().Hash
+	if seeded == start {
+		t.Errorf("Expected a different seed to give different hashes\n")
+	}
+	game.SetHashSeed(42)
+	if h := game.Default().Hash; h != seeded {
+		t.Errorf("Expected the same seed to give the same hashes, got %x and %x\n", seeded, h)
+	}
+	game.SetHashSeed(game.DefaultHashSeed)
+	if h := game.Default().Hash; h != start {
+		t.Errorf("Expected the default seed to restore the default hashes\n")
+	}
+}
@@ -7,79 +7,93 @@ import (
 	"bareman.net/chess-engine/game/piece"
 )
 
-func (g *Game) Make(mv string) error {
-	move, err := move.EmptyMove(mv)
-	if err != nil {
-		return err
-	}
+// boardState holds what make can't recover from the move itself, so that
+// Unmake can restore the position
+type boardState struct {
+	Capture  piece.Piece
+	WQCastle bool
+	WKCastle bool
+	BQCastle bool
+	BKCastle bool
+	EPTarget int
+	HalfMove int
+	// Hash of the position before the move, for repetition detection
+	Hash uint64
+}
 
-	isValid := g.IsMoveLegal(mv)
-	if !isValid {
-		return fmt.Errorf("Invalid move given. Received %v\n", mv)
+// Make plays m if it is legal. Only the origin, destination and promotion
+// type of m are considered, so moves from move.Parse are accepted.
+func (g *Game) Make(m move.Move) error {
+	legal := g.findMove(m)
+	if legal == move.Null {
+		return fmt.Errorf("Invalid move given. Received %v\n", m)
 	}
-	g.make(move)
+	g.make(legal)
+
+	return nil
+}
+
+// MakeUnchecked plays m without checking that it is legal. m must come from
+// the move generator for the current position.
+func (g *Game) MakeUnchecked(m move.Move) {
+	g.make(m)
+}
 
+// MakeString parses a move in coordinate notation and plays it
+func (g *Game) MakeString(mv string) error {
+	m, err := g.ParseMove(mv)
+	if err != nil {
+		return err
+	}
+	g.make(m)
 	return nil
 }
 
-func (g *Game) make(mv *move.Move) {
-	oRow, oCol := coordinates(mv.OriginIndex())
-	dRow, dCol := coordinates(mv.DestIndex())
-	p := g.Piece(mv.Origin)
-	capture := g.Piece(mv.Dest)
-	castle := p.Type() == piece.King && oRow == dRow && mdistance(mv.OriginIndex(), mv.DestIndex()) > 1              // piece is king, moving 2 or 3 spaces on one rank
-	ep := p.Type() == piece.Pawn && g.EPTarget == mv.DestIndex() && mdistance(mv.OriginIndex(), mv.DestIndex()) == 2 //piece is pawn, moving to target square diagonally
-
-	mv.Capture, mv.Castle, mv.EnPassant = capture, castle, ep
-	mv.BoardState = struct {
-		WQCastle bool
-		WKCastle bool
-		BQCastle bool
-		BKCastle bool
-		EPTarget int
-	}{
+func (g *Game) make(m move.Move) {
+	origin, dest := m.Origin(), m.Dest()
+	p := g.Board[origin]
+
+	state := boardState{
+		Capture:  g.Board[dest],
 		WQCastle: g.WQCastle,
 		WKCastle: g.WKCastle,
-		BQCastle: g.BKCastle,
+		BQCastle: g.BQCastle,
 		BKCastle: g.BKCastle,
 		EPTarget: g.EPTarget,
+		HalfMove: g.HalfMove,
+		Hash:     g.Hash,
+	}
+
+	// Pawn moves and captures can't be undone, so they reset the clock
+	if p.Type() == piece.Pawn || state.Capture != piece.Empty {
+		g.HalfMove = 0
+	} else {
+		g.HalfMove++
 	}
 
-	if p.Type() == piece.Pawn && oCol == dCol && mdistance(mv.OriginIndex(), mv.DestIndex()) == 2 {
-		g.EPTarget = mv.DestIndex()/2 + mv.OriginIndex()/2 + mv.DestIndex()%2
+	if p.Type() == piece.Pawn && (dest-origin == 16 || origin-dest == 16) {
+		g.EPTarget = (origin + dest) / 2
 	} else {
 		g.EPTarget = -1
 	}
 
-	g.Board[mv.DestIndex()] = g.Board[mv.OriginIndex()]
-	g.Board[mv.OriginIndex()] = piece.Empty
-	g.WhiteToMove = !g.WhiteToMove
-	if mv.Promotion != piece.Empty {
-		g.Board[mv.DestIndex()] = mv.Promotion
+	g.remove(dest)
+	g.remove(origin)
+	if m.Promotion() != piece.Empty {
+		g.put(m.Promotion(), dest)
+	} else {
+		g.put(p, dest)
 	}
+	g.WhiteToMove = !g.WhiteToMove
 
-	if ep {
-		file := mv.Dest[0]
-		rank := mv.Origin[1]
-		capIndex := indexFromPosition(string(file) + string(rank))
-		mv.Capture = g.Board[capIndex]
-		g.Board[capIndex] = piece.Empty
+	if m.IsEnPassant() {
+		state.Capture = g.remove(epCaptureIndex(origin, dest))
 	}
-	if castle {
-		rank := mv.Origin[1]
-		file := byte(int(mv.Origin[0]) + (int(mv.Dest[0])-int(mv.Origin[0]))/2)
-		rePos := string(file) + string(rank)
-		rsPos := "a" + string(rank)
-		if file > mv.Origin[0] {
-			rsPos = "h" + string(rank)
-		}
-		reIndex := indexFromPosition(rePos)
-		rsIndex := indexFromPosition(rsPos)
-		g.Board[reIndex] = g.Board[rsIndex]
-		g.Board[rsIndex] = piece.Empty
+	if m.IsCastle() {
+		rookStart, rookEnd := castleRookIndices(origin, dest)
+		g.put(g.remove(rookStart), rookEnd)
 	}
 	if p.Type() == piece.King {
-		// Doesn't handle rooks moving
 		if p.IsWhite() {
 			g.WKCastle = false
 			g.WQCastle = false
@@ -88,52 +102,79 @@ func (g *Game) make(mv *move.Move) {
 			g.BQCastle = false
 		}
 	}
-	g.Moves = append(g.Moves, mv)
+	// A rook moving away or being captured loses its side's right
+	g.clearCastlingRights(origin)
+	g.clearCastlingRights(dest)
+	g.Moves = append(g.Moves, m)
+	g.history = append(g.history, state)
 	g.MoveCount += 1
-	g.incrementHash(mv, p)
+	g.incrementHash(m, p, &state)
 }
 
 func (g *Game) Unmake() {
 
-	move := g.Moves[len(g.Moves)-1]
-	if move.Promotion == piece.Empty {
-		g.incrementHash(move, g.Board[move.DestIndex()])
+	m := g.Moves[len(g.Moves)-1]
+	state := g.history[len(g.history)-1]
+	origin, dest := m.Origin(), m.Dest()
+	if m.Promotion() == piece.Empty {
+		g.incrementHash(m, g.Board[dest], &state)
 	} else {
-		g.incrementHash(move, piece.Pawn|move.Promotion.Color())
+		g.incrementHash(m, piece.Pawn|m.Promotion().Color(), &state)
 	}
 	g.Moves = g.Moves[:len(g.Moves)-1]
+	g.history = g.history[:len(g.history)-1]
 	g.MoveCount -= 1
 
-	g.Board[move.OriginIndex()] = g.Board[move.DestIndex()]
-	g.Board[move.DestIndex()] = move.Capture
-	g.WhiteToMove = !g.WhiteToMove
-	g.EPTarget = move.BoardState.EPTarget
-	g.WQCastle = move.BoardState.WQCastle
-	g.WKCastle = move.BoardState.WKCastle
-	g.BKCastle = move.BoardState.BKCastle
-	g.BQCastle = move.BoardState.BQCastle
-	if move.Promotion != piece.Empty {
-		g.Board[move.OriginIndex()] = piece.Pawn | move.Promotion.Color()
+	p := g.remove(dest)
+	if m.Promotion() != piece.Empty {
+		p = piece.Pawn | m.Promotion().Color()
 	}
-	if move.EnPassant {
-		g.Board[move.DestIndex()] = piece.Empty
-		file := move.Dest[0]
-		rank := move.Origin[1]
-		index := indexFromPosition(string(file) + string(rank))
-		g.Board[index] = move.Capture
+	g.put(p, origin)
+	if m.IsEnPassant() {
+		g.put(state.Capture, epCaptureIndex(origin, dest))
+	} else if state.Capture != piece.Empty {
+		g.put(state.Capture, dest)
 	}
-	if move.Castle {
-		rank := move.Origin[1]
-		file := byte(int(move.Origin[0]) + (int(move.Dest[0])-int(move.Origin[0]))/2)
-		rePos := string(file) + string(rank)
-		rsPos := "a" + string(rank)
-		if file > move.Origin[0] {
-			rsPos = "h" + string(rank)
-		}
-		reIndex := indexFromPosition(rePos)
-		rsIndex := indexFromPosition(rsPos)
-		g.Board[rsIndex] = g.Board[reIndex]
-		g.Board[reIndex] = piece.Empty
+	g.WhiteToMove = !g.WhiteToMove
+	g.EPTarget = state.EPTarget
+	g.HalfMove = state.HalfMove
+	g.WQCastle = state.WQCastle
+	g.WKCastle = state.WKCastle
+	g.BKCastle = state.BKCastle
+	g.BQCastle = state.BQCastle
+	if m.IsCastle() {
+		rookStart, rookEnd := castleRookIndices(origin, dest)
+		g.put(g.remove(rookEnd), rookStart)
 	}
 
 }
+
+// clearCastlingRights removes the castling right that depends on a rook
+// standing on index
+func (g *Game) clearCastlingRights(index int) {
+	switch index {
+	case 0:
+		g.WQCastle = false
+	case 7:
+		g.WKCastle = false
+	case 56:
+		g.BQCastle = false
+	case 63:
+		g.BKCastle = false
+	}
+}
+
+// epCaptureIndex is the square of the pawn captured en passant: the file of
+// the destination on the rank of the origin
+func epCaptureIndex(origin, dest int) int {
+	return origin&^colMask | dest&colMask
+}
+
+// castleRookIndices returns where the rook starts and ends when the king
+// castles from origin to dest
+func castleRookIndices(origin, dest int) (int, int) {
+	if dest > origin {
+		return origin + 3, origin + 1
+	}
+	return origin - 4, origin - 1
+}
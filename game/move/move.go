@@ -3,64 +3,101 @@ package move
 import (
 	"fmt"
 	"regexp"
-	"strconv"
 
 	"bareman.net/chess-engine/game/piece"
 )
 
 const (
-	PositionRegex = `^[a-hA-H][0-8]$`
-	MoveRegex     = `^([a-hA-H][0-8]){2}[qrbnQRBN]?$`
+	PositionRegex = `^[a-hA-H][1-8]$`
+	MoveRegex     = `^([a-hA-H][1-8]){2}[qrbnQRBN]?$`
 )
 
-type Move struct {
-	Origin     string
-	Dest       string
-	Capture    piece.Piece
-	Promotion  piece.Piece
-	EnPassant  bool
-	Castle     bool
-	BoardState struct {
-		WQCastle bool
-		WKCastle bool
-		BQCastle bool
-		BKCastle bool
-		EPTarget int
-	}
+// Move packs a move into 32 bits:
+//
+//	bits 0-5   origin square
+//	bits 6-11  destination square
+//	bits 12-16 promotion piece, including its color
+//	bits 17-19 flags
+type Move uint32
+
+type Flag uint32
+
+const (
+	Capture Flag = 1 << (17 + iota)
+	EnPassant
+	Castle
+)
+
+const (
+	Null Move = 0
+	// No legal position has more moves than this
+	MaxMoves = 256
+
+	originMask = 0x3F
+	destShift  = 6
+	promoShift = 12
+	promoMask  = 0x1F
+
+	files = "abcdefgh"
+	ranks = "12345678"
+)
+
+func New(origin, dest int, promotion piece.Piece, flags Flag) Move {
+	return Move(origin) | Move(dest)<<destShift | Move(promotion)<<promoShift | Move(flags)
 }
 
-func (m *Move) String() string {
-	return m.Origin + m.Dest
+func (m Move) Origin() int {
+	return int(m & originMask)
 }
 
-func (m *Move) OriginIndex() int {
-	row, _ := strconv.Atoi(string(m.Origin[1]))
-	col := int(m.Origin[0] - 'a')
-	return (row-1)<<3 + col
+func (m Move) Dest() int {
+	return int(m>>destShift) & originMask
 }
 
-func (m *Move) DestIndex() int {
-	row, _ := strconv.Atoi(string(m.Dest[1]))
-	col := int(m.Dest[0] - 'a')
-	return (row-1)<<3 + col
+func (m Move) Promotion() piece.Piece {
+	return piece.Piece(m>>promoShift) & promoMask
 }
 
-func FullMove(mv string, Capture piece.Piece, EnPassant, Castle bool) (*Move, error) {
-	m, err := EmptyMove(mv)
-	if err != nil {
-		return nil, err
-	}
+func (m Move) Is(f Flag) bool {
+	return Flag(m)&f != 0
+}
 
-	m.Capture, m.EnPassant, m.Castle = Capture, EnPassant, Castle
+func (m Move) IsCapture() bool {
+	return m.Is(Capture)
+}
 
-	return m, nil
+func (m Move) IsEnPassant() bool {
+	return m.Is(EnPassant)
+}
 
+func (m Move) IsCastle() bool {
+	return m.Is(Castle)
 }
 
-func EmptyMove(mv string) (*Move, error) {
-	reg := regexp.MustCompile(MoveRegex)
-	if !reg.MatchString(mv) {
-		return nil, fmt.Errorf("Invalid Move given. Received %v\n", mv)
+// String formats the move in the coordinate notation used by UCI, with a
+// lowercase promotion piece
+func (m Move) String() string {
+	if m == Null {
+		return "0000"
+	}
+	b := []byte{
+		files[m.Origin()&7], ranks[m.Origin()>>3],
+		files[m.Dest()&7], ranks[m.Dest()>>3],
+	}
+	if m.Promotion() != piece.Empty {
+		b = append(b, (piece.Black | m.Promotion().Type()).String()[0])
+	}
+	return string(b)
+}
+
+var moveReg = regexp.MustCompile(MoveRegex)
+
+// Parse reads a move in coordinate notation. The result has no flags set
+// and the color of a promotion piece comes from its case, so it needs to be
+// matched against a generated move before it can be played.
+func Parse(mv string) (Move, error) {
+	if !moveReg.MatchString(mv) {
+		return Null, fmt.Errorf("Invalid Move given. Received %v\n", mv)
 	}
 
 	var promote piece.Piece = piece.Empty
@@ -68,9 +105,40 @@ func EmptyMove(mv string) (*Move, error) {
 		promote = piece.FromRune(rune(mv[4]))
 	}
 
-	return &Move{
-		Origin:    mv[:2],
-		Dest:      mv[2:4],
-		Promotion: promote,
-	}, nil
+	return New(index(mv[0:2]), index(mv[2:4]), promote, 0), nil
+}
+
+func index(position string) int {
+	row := int(position[1] - '1')
+	col := int(position[0]|0x20) - 'a' // lowercase the file
+	return row<<3 + col
+}
+
+// List is a fixed size list of moves that can be reused without allocating
+type List struct {
+	moves [MaxMoves]Move
+	count int
+}
+
+func (l *List) Add(m Move) {
+	l.moves[l.count] = m
+	l.count++
+}
+
+func (l *List) Len() int {
+	return l.count
+}
+
+func (l *List) Clear() {
+	l.count = 0
+}
+
+// Slice returns the moves in the list. It shares storage with the list.
+func (l *List) Slice() []Move {
+	return l.moves[:l.count]
+}
+
+// Truncate keeps only the first n moves
+func (l *List) Truncate(n int) {
+	l.count = n
 }
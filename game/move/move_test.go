@@ -1,12 +1,57 @@
 package move
 
-import "testing"
+import (
+	"testing"
+
+	"bareman.net/chess-engine/game/piece"
+)
 
 func TestMove(t *testing.T) {
-	move, err := EmptyMove("f4e3")
+	move, err := Parse("f4e3")
 	if err != nil {
-		t.Logf("Failed to create move: %v", err)
+		t.Fatalf("Failed to create move: %v", err)
+	}
+	if move.Origin() != 29 || move.Dest() != 20 {
+		t.Errorf("Expected move from 29 to 20, got %v to %v\n", move.Origin(), move.Dest())
+	}
+	if move.String() != "f4e3" {
+		t.Errorf("Expected f4e3, got %v\n", move)
+	}
+}
+
+func TestPacking(t *testing.T) {
+	m := New(52, 60, piece.Queen|piece.White, Capture|EnPassant)
+	if m.Origin() != 52 || m.Dest() != 60 {
+		t.Errorf("Expected move from 52 to 60, got %v to %v\n", m.Origin(), m.Dest())
+	}
+	if m.Promotion() != piece.Queen|piece.White {
+		t.Errorf("Expected white queen promotion, got %v\n", m.Promotion())
+	}
+	if !m.IsCapture() || !m.IsEnPassant() || m.IsCastle() {
+		t.Errorf("Flags were not packed correctly\n")
+	}
+	if m.String() != "e7e8q" {
+		t.Errorf("Expected e7e8q, got %v\n", m)
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, mv := range []string{"", "e2", "e2e9", "i2i4", "e7e8k"} {
+		if _, err := Parse(mv); err == nil {
+			t.Errorf("Expected an error parsing %q\n", mv)
+		}
+	}
+}
+
+func TestList(t *testing.T) {
+	var l List
+	l.Add(New(12, 28, piece.Empty, 0))
+	l.Add(New(6, 21, piece.Empty, 0))
+	if l.Len() != 2 || l.Slice()[1].String() != "g1f3" {
+		t.Errorf("Unexpected list contents %v\n", l.Slice())
+	}
+	l.Clear()
+	if l.Len() != 0 {
+		t.Errorf("Expected empty list after Clear\n")
 	}
-	t.Log(move)
-	t.Logf("Moving from index %v to %v\n", move.OriginIndex(), move.DestIndex())
 }
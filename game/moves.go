@@ -1,6 +1,9 @@
 package game
 
 import (
+	"fmt"
+
+	"bareman.net/chess-engine/game/bitboard"
 	"bareman.net/chess-engine/game/move"
 	"bareman.net/chess-engine/game/piece"
 )
@@ -16,287 +19,298 @@ const (
 	BackLeft   = -9
 )
 
-func (g *Game) IsMoveLegal(mv string) bool {
-	m, err := move.EmptyMove(mv)
-	if err != nil {
-		return false
+func (g *Game) IsMoveLegal(m move.Move) bool {
+	return g.findMove(m) != move.Null
+}
+
+// findMove returns the legal move with the same origin, destination and
+// promotion type as m, or move.Null if there isn't one. Flags on m and the
+// color of its promotion piece are ignored, so moves built by move.Parse can
+// be matched.
+func (g *Game) findMove(m move.Move) move.Move {
+	var list move.List
+	g.legalMoves(&list, bitboard.FromSquare(m.Origin()))
+	for _, legal := range list.Slice() {
+		if legal.Dest() == m.Dest() && legal.Promotion().Type() == m.Promotion().Type() {
+			return legal
+		}
 	}
-	p := g.Piece(m.Origin)
-	if p.IsWhite() != g.WhiteToMove {
-		return false
+	return move.Null
+}
+
+// ParseMove reads a move in coordinate notation and returns the matching
+// legal move
+func (g *Game) ParseMove(mv string) (move.Move, error) {
+	m, err := move.Parse(mv)
+	if err != nil {
+		return move.Null, err
 	}
-	color := piece.White
-	if !g.WhiteToMove {
-		color = piece.Black
+	legal := g.findMove(m)
+	if legal == move.Null {
+		return move.Null, fmt.Errorf("Invalid move given. Received %v\n", mv)
 	}
+	return legal, nil
+}
 
-	var king string
-	for i, p := range g.Board {
-		if p == piece.Piece(color|piece.King) {
-			king = positionFromIndex(i)
+// isLegal checks that the pseudo-legal move m doesn't leave the king in
+// check, and that castling doesn't start in or pass through check. The move
+// is played out on the occupancy bitboard only, so the board isn't touched.
+func (g *Game) isLegal(m move.Move) bool {
+	them := opponent(g.sideToMove())
+	from, to := m.Origin(), m.Dest()
+	occupied := g.Occupied()
+
+	if g.Board[from].Type() == piece.King {
+		if m.IsCastle() {
+			if g.isAttacked(from, them) || g.isAttacked((from+to)/2, them) {
+				return false
+			}
 		}
+		occupied &^= bitboard.FromSquare(from)
+		return g.attackers(to, them, occupied)&^bitboard.FromSquare(to) == 0
 	}
 
-	g.make(m)
-	inCheck := false
-	if p == piece.Piece(color|piece.King) {
-		inCheck = g.IsAttacked(m.Dest)
-
-		oRow, _ := coordinates(m.OriginIndex())
-		dRow, _ := coordinates(m.DestIndex())
-		// Checks if castling out of/over check
-		if !inCheck && mdistance(m.OriginIndex(), m.DestIndex()) == 2 && oRow == dRow {
-			position := positionFromIndex(m.OriginIndex() + (m.DestIndex()-m.OriginIndex())/2)
-			inCheck = g.IsAttacked(position) || g.IsAttacked(m.Origin)
-		}
-	} else {
-		inCheck = g.IsAttacked(king)
+	king := g.Bitboard(piece.King | g.sideToMove()).LSB()
+	captured := bitboard.FromSquare(to)
+	occupied = occupied&^bitboard.FromSquare(from) | captured
+	if m.IsEnPassant() {
+		captured = bitboard.FromSquare(epCaptureIndex(from, to))
+		occupied &^= captured
 	}
-	g.Unmake()
-	return !inCheck
+	return g.attackers(king, them, occupied)&^captured == 0
+}
+
+// AllLegalMoves returns a new slice with every legal move. Use LegalMoves
+// with a reused list to avoid allocating.
+func (g *Game) AllLegalMoves() []move.Move {
+	var list move.List
+	g.LegalMoves(&list)
+	return append([]move.Move(nil), list.Slice()...)
+}
+
+// LegalMoves replaces the contents of list with every legal move
+func (g *Game) LegalMoves(list *move.List) {
+	list.Clear()
+	g.legalMoves(list, bitboard.Full)
 }
 
-func (g *Game) AllLegalMoves() []string {
-	return g.LegalMoves("")
+// PseudoLegalMoves replaces the contents of list with every move that
+// follows the piece movement rules, including those that leave the king in
+// check
+func (g *Game) PseudoLegalMoves(list *move.List) {
+	list.Clear()
+	g.pseudoLegalMoves(list, bitboard.Full)
 }
 
-func (g *Game) LegalMoves(pos string) []string {
-	var moves, search []string
-	if pos != "" {
-		search = []string{pos}
-	} else {
-		search = make([]string, 64)
-		for i := 0; i < 64; i++ {
-			search[i] = positionFromIndex(i)
+// legalMoves adds the legal moves for pieces of the side to move on the from
+// squares. Checkers and pinned pieces are found up front, so only moves that
+// resolve any check and keep pinned pieces on their pin line are generated.
+func (g *Game) legalMoves(list *move.List, from bitboard.Bitboard) {
+	us := g.sideToMove()
+	them := opponent(us)
+	own := g.Colors[colorIndex(us)]
+	enemy := g.Colors[colorIndex(them)]
+	occupied := own | enemy
+	from &= own
+
+	king := g.Bitboard(piece.King | us).LSB()
+	checkers := g.attackers(king, them, occupied)
+
+	if from.Has(king) {
+		// The king can't hide from a slider by stepping along its ray
+		withoutKing := occupied &^ bitboard.FromSquare(king)
+		for targets := bitboard.KingAttacks(king) &^ own; targets != 0; {
+			dest := targets.PopLSB()
+			if g.attackers(dest, them, withoutKing) == 0 {
+				list.Add(move.New(king, dest, piece.Empty, captureFlag(enemy, dest)))
+			}
+		}
+		if checkers == 0 {
+			g.castlingMoves(list, us, occupied, true)
 		}
 	}
+	// Only the king can escape a double check
+	if checkers.Count() > 1 {
+		return
+	}
 
-	for i, ps := range search {
-		if g.Board[i] == piece.Empty || g.Board[i].IsWhite() != g.WhiteToMove {
-			continue
-		}
-		mvs := g.moves(ps)
-		for _, mv := range mvs {
-			if g.IsMoveLegal(mv) {
-				moves = append(moves, mv)
+	// Squares that block or capture the checking piece
+	evasions := bitboard.Full
+	if checkers != 0 {
+		evasions = checkers | bitboard.Between(king, checkers.LSB())
+	}
+	pinned := g.pinned(king, us)
+
+	for _, t := range [...]piece.Piece{piece.Knight, piece.Bishop, piece.Rook, piece.Queen} {
+		for bb := from & g.Pieces[t]; bb != 0; {
+			start := bb.PopLSB()
+			targets := bitboard.Attacks(t, start, occupied) &^ own & evasions
+			if pinned.Has(start) {
+				targets &= bitboard.Line(king, start)
+			}
+			for captures := targets & enemy; captures != 0; {
+				list.Add(move.New(start, captures.PopLSB(), piece.Empty, move.Capture))
+			}
+			for quiets := targets &^ enemy; quiets != 0; {
+				list.Add(move.New(start, quiets.PopLSB(), piece.Empty, 0))
 			}
 		}
 	}
-	return moves
-}
 
-func (g *Game) PseudoLegalMoves(pos string) []string {
-	var moves []string
-	search := make(map[int]string, 64)
-	if pos != "" {
-		search[indexFromPosition(pos)] = pos
-	} else {
-		for i := 0; i < 64; i++ {
-			if g.Board[i] != piece.Empty && g.Board[i].IsWhite() == g.WhiteToMove {
-				search[i] = positionFromIndex(i)
+	dir, startRank := Forward, bitboard.Rank2
+	if us == piece.Black {
+		dir, startRank = Backward, bitboard.Rank7
+	}
+	for pawns := from & g.Pieces[piece.Pawn]; pawns != 0; {
+		start := pawns.PopLSB()
+		allowed := evasions
+		if pinned.Has(start) {
+			allowed &= bitboard.Line(king, start)
+		}
+		if !occupied.Has(start + dir) {
+			if allowed.Has(start + dir) {
+				addPawnMoves(list, start, start+dir, us, 0)
+			}
+			if startRank.Has(start) && !occupied.Has(start+2*dir) && allowed.Has(start+2*dir) {
+				list.Add(move.New(start, start+2*dir, piece.Empty, 0))
+			}
+		}
+		attacks := bitboard.PawnAttacks(start, us)
+		for captures := attacks & enemy & allowed; captures != 0; {
+			addPawnMoves(list, start, captures.PopLSB(), us, move.Capture)
+		}
+		// En passant removes two pieces from a rank, which the masks don't
+		// cover, so it gets checked on the occupancy directly
+		if g.EPTarget != -1 && attacks.Has(g.EPTarget) {
+			m := move.New(start, g.EPTarget, piece.Empty, move.Capture|move.EnPassant)
+			if g.isLegal(m) {
+				list.Add(m)
 			}
 		}
 	}
+}
+
+// pinned returns the pieces of color us that can't leave the line between
+// their king and an enemy slider
+func (g *Game) pinned(king int, us piece.Piece) bitboard.Bitboard {
+	occupied := g.Occupied()
+	diagonal := g.Pieces[piece.Bishop] | g.Pieces[piece.Queen]
+	orthogonal := g.Pieces[piece.Rook] | g.Pieces[piece.Queen]
+	snipers := g.Colors[colorIndex(opponent(us))] &
+		(bitboard.BishopAttacks(king, bitboard.Empty)&diagonal |
+			bitboard.RookAttacks(king, bitboard.Empty)&orthogonal)
 
-	for i, ps := range search {
-		if g.Board[i] == piece.Empty || g.Board[i].IsWhite() != g.WhiteToMove {
-			continue
+	var pinned bitboard.Bitboard
+	for snipers != 0 {
+		blockers := bitboard.Between(king, snipers.PopLSB()) & occupied
+		if blockers.Count() == 1 {
+			pinned |= blockers
 		}
-		moves = append(moves, g.moves(ps)...)
 	}
-	return moves
+	return pinned & g.Colors[colorIndex(us)]
 }
 
-func (g *Game) moves(pos string) []string {
-	p := g.Piece(pos)
-	start := indexFromPosition(pos)
-
-	switch p.Type() {
-	case piece.Pawn:
-		return g.pawnMoves(start, p.Color())
-	case piece.Queen:
-		return g.queenMoves(start, p.Color())
-	case piece.Bishop:
-		return g.bishopMoves(start, p.Color())
-	case piece.Rook:
-		return g.rookMoves(start, p.Color())
-	case piece.King:
-		return g.kingMoves(start, p.Color())
-	case piece.Knight:
-		return g.knightMoves(start, p.Color())
-	default:
-		return []string{}
+func captureFlag(enemy bitboard.Bitboard, dest int) move.Flag {
+	if enemy.Has(dest) {
+		return move.Capture
 	}
+	return 0
 }
 
-func (g *Game) pawnMoves(start int, color piece.Piece) []string {
-	dir := -1 * (int(color/piece.White)*2 - 3)
-	index := start + Forward*dir
-	moves := []string{}
+// pseudoLegalMoves adds the moves for pieces of the side to move on the from
+// squares, without checking if they leave the king in check.
+func (g *Game) pseudoLegalMoves(list *move.List, from bitboard.Bitboard) {
+	us := g.sideToMove()
+	own := g.Colors[colorIndex(us)]
+	enemy := g.Colors[colorIndex(opponent(us))]
+	occupied := own | enemy
+	from &= own
 
-	appendMoves := func(dest int) {
-		mv := positionFromIndex(start) + positionFromIndex(dest)
-		row, _ := coordinates(dest)
-		//Handles promotions
-		if row == 7 || row == 0 {
-			promos := []string{"Q", "R", "B", "N"}
-			if color != piece.White {
-				promos = []string{"q", "r", "b", "n"}
+	for _, t := range [...]piece.Piece{piece.Knight, piece.Bishop, piece.Rook, piece.Queen, piece.King} {
+		for bb := from & g.Pieces[t]; bb != 0; {
+			start := bb.PopLSB()
+			targets := bitboard.Attacks(t, start, occupied) &^ own
+			for captures := targets & enemy; captures != 0; {
+				list.Add(move.New(start, captures.PopLSB(), piece.Empty, move.Capture))
 			}
-			for _, p := range promos {
-				moves = append(moves, mv+p)
+			for quiets := targets &^ enemy; quiets != 0; {
+				list.Add(move.New(start, quiets.PopLSB(), piece.Empty, 0))
 			}
-		} else {
-			moves = append(moves, mv)
-		}
-	}
-
-	if index < 64 && index >= 0 && g.Board[index] == piece.Empty {
-		appendMoves(index)
-
-		row, _ := coordinates(start)
-
-		// in starting row and the two spots in front are open
-		if (row-dir == 7 || row-dir == 0) && g.Board[index+Forward*dir] == piece.Empty {
-			appendMoves(index + Forward*dir)
 		}
 	}
-	// En Passant
-	if g.EPTarget != -1 && index+Left == g.EPTarget && mdistance(index, index+Left) == 1 {
-		appendMoves(index + Left)
+	g.pawnMoves(list, from&g.Pieces[piece.Pawn], us, enemy, occupied)
+	if from&g.Pieces[piece.King] != 0 {
+		g.castlingMoves(list, us, occupied, false)
 	}
-	if g.EPTarget != -1 && index+Right == g.EPTarget && mdistance(index, index+Right) == 1 {
-		appendMoves(index + Right)
-	}
-	//Attacking squares
-	leftAttack := start + Forward*dir + Left
-	if leftAttack < 64 && leftAttack >= 0 &&
-		mdistance(start, leftAttack) == 2 &&
-		g.Board[leftAttack] != piece.Empty &&
-		g.Board[leftAttack].Color() != color {
-		appendMoves(leftAttack)
-	}
-	rightAttack := start + Forward*dir + Right
-	if rightAttack < 64 && rightAttack >= 0 &&
-		mdistance(start, rightAttack) == 2 &&
-		g.Board[rightAttack] != piece.Empty &&
-		g.Board[rightAttack].Color() != color {
-		appendMoves(rightAttack)
-	}
-	return moves
 }
 
-func (g *Game) kingMoves(start int, color piece.Piece) []string {
-	allDirections := []int{
-		FrontLeft, Forward, FrontRight,
-		Left, Right,
-		BackLeft, Backward, BackRight,
+func (g *Game) pawnMoves(list *move.List, pawns bitboard.Bitboard, color piece.Piece, enemy, occupied bitboard.Bitboard) {
+	dir, startRank := Forward, bitboard.Rank2
+	if color == piece.Black {
+		dir, startRank = Backward, bitboard.Rank7
 	}
 
-	moves := []string{}
-
-	for _, dir := range allDirections {
-		if start+dir >= 0 && start+dir < 64 && mdistance(start, start+dir) <= 2 && g.Board[start+dir].Color() != color {
-			targetPosition := positionFromIndex(start + dir)
-			moves = append(moves, positionFromIndex(start)+targetPosition)
-		}
-	}
-	row, col := coordinates(start)
-	// Castling
-	if col == 4 && (color.IsWhite() && g.WKCastle && row == 0 || !color.IsWhite() && g.BKCastle && row == 7) {
-		kingSideClear := true
-		for i := 1; i <= 2; i++ {
-			if g.Board[start+i*Right] != piece.Empty {
-				kingSideClear = false
-				break
+	for pawns != 0 {
+		start := pawns.PopLSB()
+		if !occupied.Has(start + dir) {
+			addPawnMoves(list, start, start+dir, color, 0)
+			// in starting row and the two spots in front are open
+			if startRank.Has(start) && !occupied.Has(start+2*dir) {
+				list.Add(move.New(start, start+2*dir, piece.Empty, 0))
 			}
 		}
-		if kingSideClear && g.Board[start+3*Right] == piece.Piece(color|piece.Rook) {
-			moves = append(moves, positionFromIndex(start)+positionFromIndex(start+Right*2))
+		attacks := bitboard.PawnAttacks(start, color)
+		for captures := attacks & enemy; captures != 0; {
+			addPawnMoves(list, start, captures.PopLSB(), color, move.Capture)
 		}
-	}
-	if col == 4 && (color.IsWhite() && g.WQCastle && row == 0 || !color.IsWhite() && g.BQCastle && row == 7) {
-		queenSideClear := true
-		for i := 1; i <= 3; i++ {
-			if g.Board[start+i*Left] != piece.Empty {
-				queenSideClear = false
-				break
-			}
-		}
-		if queenSideClear && g.Board[start+4*Left] == piece.Piece(color|piece.Rook) {
-			moves = append(moves, positionFromIndex(start)+positionFromIndex(start+Left*2))
+		if g.EPTarget != -1 && attacks.Has(g.EPTarget) {
+			list.Add(move.New(start, g.EPTarget, piece.Empty, move.Capture|move.EnPassant))
 		}
 	}
-
-	return moves
 }
 
-func (g *Game) bishopMoves(start int, color piece.Piece) []string {
-	diagonals := []int{
-		FrontLeft, FrontRight,
-		BackLeft, BackRight,
+// addPawnMoves adds a pawn move, expanding it into each promotion when it
+// reaches the last rank
+func addPawnMoves(list *move.List, start, dest int, color piece.Piece, flags move.Flag) {
+	if dest >= 8 && dest < 56 {
+		list.Add(move.New(start, dest, piece.Empty, flags))
+		return
 	}
-
-	moves := []string{}
-	for _, dir := range diagonals {
-		moves = append(moves, g.slidingMoves(start, dir, color)...)
+	for _, t := range [...]piece.Piece{piece.Queen, piece.Rook, piece.Bishop, piece.Knight} {
+		list.Add(move.New(start, dest, t|color, flags))
 	}
-	return moves
 }
 
-func (g *Game) rookMoves(start int, color piece.Piece) []string {
-	orthogonals := []int{
-		Forward, Backward,
-		Right, Left,
-	}
-
-	moves := []string{}
-	for _, dir := range orthogonals {
-		moves = append(moves, g.slidingMoves(start, dir, color)...)
+// castlingMoves adds castling moves whose path is clear. If legal is set,
+// castling through or into an attacked square is left out as well; the king
+// must not already be in check.
+func (g *Game) castlingMoves(list *move.List, color piece.Piece, occupied bitboard.Bitboard, legal bool) {
+	start, kingSide, queenSide := 4, g.WKCastle, g.WQCastle
+	if color == piece.Black {
+		start, kingSide, queenSide = 60, g.BKCastle, g.BQCastle
 	}
-	return moves
-}
-
-func (g *Game) queenMoves(start int, color piece.Piece) []string {
-	return append(g.rookMoves(start, color), g.bishopMoves(start, color)...)
-}
-
-func (g *Game) knightMoves(start int, color piece.Piece) []string {
-	preMoves := []int{
-		Forward + Forward + Right,
-		Forward + Forward + Left,
-		Forward + Left + Left,
-		Backward + Left + Left,
-		Forward + Right + Right,
-		Backward + Right + Right,
-		Backward + Backward + Left,
-		Backward + Backward + Right,
+	if g.Board[start] != piece.King|color {
+		return
 	}
-
-	moves := []string{}
-	for _, mv := range preMoves {
-		distance := mdistance(start, start+mv)
-		if start+mv >= 0 && start+mv < 64 && distance == 3 && g.Board[start+mv].Color() != color {
-			moves = append(moves, positionFromIndex(start)+positionFromIndex(start+mv))
+	rook := piece.Rook | color
+	safe := func(squares ...int) bool {
+		if !legal {
+			return true
 		}
-	}
-	return moves
-}
-
-func (g *Game) slidingMoves(start, dir int, color piece.Piece) []string {
-	var moves []string
-	curr := start
-	inBoard := curr+dir >= 0 && curr+dir < 64
-	crossesBoundary := mdistance(curr, curr+dir) > 2
-	for inBoard && !crossesBoundary && (g.Board[curr+dir] == piece.Empty || g.Board[curr+dir].IsWhite() != color.IsWhite()) {
-		moves = append(moves, positionFromIndex(start)+positionFromIndex(curr+dir))
-		if g.Board[curr+dir] != piece.Empty {
-			break
+		for _, sq := range squares {
+			if g.isAttacked(sq, opponent(color)) {
+				return false
+			}
 		}
+		return true
+	}
 
-		curr = curr + dir
-		crossesBoundary = mdistance(curr, curr+dir) > 2
-		inBoard = curr+dir >= 0 && curr+dir < 64
+	kingSideClear := bitboard.FromSquare(start+Right) | bitboard.FromSquare(start+2*Right)
+	if kingSide && occupied&kingSideClear == 0 && g.Board[start+3*Right] == rook && safe(start+Right, start+2*Right) {
+		list.Add(move.New(start, start+2*Right, piece.Empty, move.Castle))
+	}
+	queenSideClear := bitboard.FromSquare(start+Left) | bitboard.FromSquare(start+2*Left) | bitboard.FromSquare(start+3*Left)
+	if queenSide && occupied&queenSideClear == 0 && g.Board[start+4*Left] == rook && safe(start+Left, start+2*Left) {
+		list.Add(move.New(start, start+2*Left, piece.Empty, move.Castle))
 	}
-	return moves
 }
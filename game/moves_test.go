@@ -0,0 +1,61 @@
+package game
+
+import (
+	"testing"
+
+	"bareman.net/chess-engine/game/move"
+)
+
+// The legal generator should match filtering pseudo-legal moves by playing
+// them out
+func TestLegalMatchesPseudoLegal(t *testing.T) {
+	fens := []string{
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1",
+		"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1",
+		"8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 1",
+		"r3k2r/Pppp1ppp/1b3nbN/nP6/BBP1P3/q4N2/Pp1P2PP/R2Q1RK1 w kq - 0 1",
+		"rnbq1k1r/pp1Pbppp/2p5/8/2B5/8/PPP1NnPP/RNBQK2R w KQ - 1 8",
+		"r4rk1/1pp1qppp/p1np1n2/2b1p1B1/2B1P1b1/P1NP1N2/1PP1QPPP/R4RK1 w - - 0 10",
+		// En passant would expose the king along the rank
+		"8/8/8/K2pP2q/8/8/8/7k w - d6 0 1",
+		// Double check
+		"4k3/8/8/8/8/5n2/8/r3K3 w - - 0 1",
+	}
+	for _, fen := range fens {
+		g, err := FromFEN(fen)
+		if err != nil {
+			t.Fatalf("Failed to create game with fen '%v'\n", fen)
+		}
+		compareGenerators(t, g, 3)
+	}
+}
+
+func compareGenerators(t *testing.T, g *Game, depth int) {
+	var legal, pseudo move.List
+	g.LegalMoves(&legal)
+	g.PseudoLegalMoves(&pseudo)
+
+	expected := make(map[move.Move]bool)
+	for _, m := range pseudo.Slice() {
+		if g.isLegal(m) {
+			expected[m] = true
+		}
+	}
+	if len(expected) != legal.Len() {
+		t.Fatalf("%v: expected %v legal moves, got %v\n", g.ToFEN(), len(expected), legal.Len())
+	}
+	for _, m := range legal.Slice() {
+		if !expected[m] {
+			t.Fatalf("%v: %v should not be legal\n", g.ToFEN(), m)
+		}
+	}
+
+	if depth == 1 {
+		return
+	}
+	for _, m := range legal.Slice() {
+		g.make(m)
+		compareGenerators(t, g, depth-1)
+		g.Unmake()
+	}
+}
@@ -0,0 +1,114 @@
+package game
+
+import (
+	"bareman.net/chess-engine/game/move"
+	"bareman.net/chess-engine/game/piece"
+)
+
+type Result int
+
+const (
+	Ongoing Result = iota
+	WhiteWins
+	BlackWins
+	Draw
+)
+
+// String formats the result the way it's written at the end of a PGN game
+func (r Result) String() string {
+	switch r {
+	case WhiteWins:
+		return "1-0"
+	case BlackWins:
+		return "0-1"
+	case Draw:
+		return "1/2-1/2"
+	default:
+		return "*"
+	}
+}
+
+type Reason int
+
+const (
+	NoReason Reason = iota
+	Checkmate
+	Stalemate
+	ThreefoldRepetition
+	FiftyMoveRule
+	InsufficientMaterial
+)
+
+func (r Reason) String() string {
+	switch r {
+	case Checkmate:
+		return "checkmate"
+	case Stalemate:
+		return "stalemate"
+	case ThreefoldRepetition:
+		return "threefold repetition"
+	case FiftyMoveRule:
+		return "fifty move rule"
+	case InsufficientMaterial:
+		return "insufficient material"
+	default:
+		return "none"
+	}
+}
+
+type Outcome struct {
+	Result Result
+	Reason Reason
+}
+
+// Outcome returns how the game has ended, or an Outcome with the Ongoing
+// result if it hasn't. Checkmate takes precedence over the draw rules.
+func (g *Game) Outcome() Outcome {
+	if !g.hasLegalMoves() {
+		if !g.InCheck() {
+			return Outcome{Draw, Stalemate}
+		}
+		if g.WhiteToMove {
+			return Outcome{BlackWins, Checkmate}
+		}
+		return Outcome{WhiteWins, Checkmate}
+	}
+	switch {
+	case g.IsFiftyMoveDraw():
+		return Outcome{Draw, FiftyMoveRule}
+	case g.IsThreefoldRepetition():
+		return Outcome{Draw, ThreefoldRepetition}
+	case g.IsInsufficientMaterial():
+		return Outcome{Draw, InsufficientMaterial}
+	}
+	return Outcome{Ongoing, NoReason}
+}
+
+// InCheck reports whether the king of the side to move is attacked
+func (g *Game) InCheck() bool {
+	us := g.sideToMove()
+	king := g.Bitboard(piece.King | us)
+	if king == 0 {
+		return false
+	}
+	return g.isAttacked(king.LSB(), opponent(us))
+}
+
+func (g *Game) IsCheckmate() bool {
+	return g.InCheck() && !g.hasLegalMoves()
+}
+
+func (g *Game) IsStalemate() bool {
+	return !g.InCheck() && !g.hasLegalMoves()
+}
+
+// AttackedBy reports whether any piece of color attacks index
+func (g *Game) AttackedBy(index int, color piece.Piece) bool {
+	return g.isAttacked(index, color)
+}
+
+func (g *Game) hasLegalMoves() bool {
+	var list move.List
+	g.LegalMoves(&list)
+	return list.Len() > 0
+}
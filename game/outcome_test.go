@@ -0,0 +1,65 @@
+package game_test
+
+import (
+	"testing"
+
+	"bareman.net/chess-engine/game"
+	"bareman.net/chess-engine/game/piece"
+)
+
+func TestOutcome(t *testing.T) {
+	cases := []struct {
+		fen     string
+		outcome game.Outcome
+	}{
+		{"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", game.Outcome{Result: game.Ongoing, Reason: game.NoReason}},
+		// Fool's mate
+		{"rnb1kbnr/pppp1ppp/8/4p3/6Pq/5P2/PPPPP2P/RNBQKBNR w KQkq - 1 3", game.Outcome{Result: game.BlackWins, Reason: game.Checkmate}},
+		{"6k1/5ppp/8/8/8/8/8/R5K1 b - - 0 1", game.Outcome{Result: game.Ongoing, Reason: game.NoReason}},
+		{"R5k1/5ppp/8/8/8/8/8/6K1 b - - 0 1", game.Outcome{Result: game.WhiteWins, Reason: game.Checkmate}},
+		{"7k/5Q2/6K1/8/8/8/8/8 b - - 0 1", game.Outcome{Result: game.Draw, Reason: game.Stalemate}},
+		{"8/8/4k3/8/8/3K1R2/8/8 w - - 100 80", game.Outcome{Result: game.Draw, Reason: game.FiftyMoveRule}},
+		{"8/8/4k3/8/8/3KN3/8/8 w - - 0 1", game.Outcome{Result: game.Draw, Reason: game.InsufficientMaterial}},
+		// Mate on the hundredth half move still counts
+		{"R5k1/5ppp/8/8/8/8/8/6K1 b - - 100 80", game.Outcome{Result: game.WhiteWins, Reason: game.Checkmate}},
+	}
+	for _, c := range cases {
+		g, err := game.FromFEN(c.fen)
+		if err != nil {
+			t.Fatalf("Failed to create game with fen '%v'\n", c.fen)
+		}
+		if o := g.Outcome(); o != c.outcome {
+			t.Errorf("%v: expected %v by %v, got %v by %v\n", c.fen, c.outcome.Result, c.outcome.Reason, o.Result, o.Reason)
+		}
+		mate := c.outcome.Reason == game.Checkmate
+		if g.IsCheckmate() != mate || (mate && !g.InCheck()) {
+			t.Errorf("%v: expected checkmate to be %v\n", c.fen, mate)
+		}
+		if g.IsStalemate() != (c.outcome.Reason == game.Stalemate) {
+			t.Errorf("%v: expected stalemate to be %v\n", c.fen, !g.IsStalemate())
+		}
+	}
+}
+
+func TestThreefoldOutcome(t *testing.T) {
+	g := game.Default()
+	for i := 0; i < 2; i++ {
+		for _, mv := range []string{"b1c3", "b8c6", "c3b1", "c6b8"} {
+			g.MakeString(mv)
+		}
+	}
+	if o := g.Outcome(); o.Result != game.Draw || o.Reason != game.ThreefoldRepetition {
+		t.Errorf("Expected a draw by repetition, got %v by %v\n", o.Result, o.Reason)
+	}
+}
+
+func TestAttackedBy(t *testing.T) {
+	g := game.Default()
+	// f3 is covered by the e2 and g2 pawns and the g1 knight
+	if !g.AttackedBy(21, piece.White) || g.AttackedBy(21, piece.Black) {
+		t.Errorf("Expected f3 to be attacked by white only\n")
+	}
+	if g.InCheck() {
+		t.Errorf("Expected no check in the starting position\n")
+	}
+}
@@ -0,0 +1,169 @@
+package game
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"bareman.net/chess-engine/game/move"
+	"bareman.net/chess-engine/game/piece"
+)
+
+// Piece letter, origin file and rank for disambiguation, destination and
+// promotion. Separators and the promotion's '=' or brackets are optional.
+var sanReg = regexp.MustCompile(`^([NBRQK])?([a-h])?([1-8])?[x:-]?([a-h][1-8])(?:[=/]?\(?([NBRQnbrq])\)?)?$`)
+
+// SAN formats the legal move m in Standard Algebraic Notation, including the
+// check or mate suffix
+func (g *Game) SAN(m move.Move) string {
+	var sb strings.Builder
+	p := g.Board[m.Origin()]
+	switch {
+	case m.IsCastle() && m.Dest() > m.Origin():
+		sb.WriteString("O-O")
+	case m.IsCastle():
+		sb.WriteString("O-O-O")
+	case p.Type() == piece.Pawn:
+		if m.IsCapture() {
+			sb.WriteByte(squareNames[m.Origin()][0])
+			sb.WriteByte('x')
+		}
+		sb.WriteString(squareNames[m.Dest()])
+		if m.Promotion() != piece.Empty {
+			sb.WriteByte('=')
+			sb.WriteString(pieceLetter(m.Promotion()))
+		}
+	default:
+		sb.WriteString(pieceLetter(p))
+		sb.WriteString(g.disambiguation(m))
+		if m.IsCapture() {
+			sb.WriteByte('x')
+		}
+		sb.WriteString(squareNames[m.Dest()])
+	}
+
+	g.make(m)
+	if g.InCheck() {
+		if g.hasLegalMoves() {
+			sb.WriteByte('+')
+		} else {
+			sb.WriteByte('#')
+		}
+	}
+	g.Unmake()
+	return sb.String()
+}
+
+// disambiguation returns the origin file, rank or square needed to tell m
+// apart from other moves of the same piece type to the same square
+func (g *Game) disambiguation(m move.Move) string {
+	p := g.Board[m.Origin()]
+	var list move.List
+	g.legalMoves(&list, g.Bitboard(p))
+
+	var sameFile, sameRank, ambiguous bool
+	for _, other := range list.Slice() {
+		if other.Dest() != m.Dest() || other.Origin() == m.Origin() {
+			continue
+		}
+		ambiguous = true
+		sameFile = sameFile || other.Origin()&colMask == m.Origin()&colMask
+		sameRank = sameRank || other.Origin()>>3 == m.Origin()>>3
+	}
+	origin := squareNames[m.Origin()]
+	switch {
+	case !ambiguous:
+		return ""
+	case !sameFile:
+		return origin[:1]
+	case !sameRank:
+		return origin[1:]
+	default:
+		return origin
+	}
+}
+
+// ParseSAN reads a move in Standard Algebraic Notation and returns the
+// matching legal move. It accepts common variations: check, mate and
+// annotation suffixes are optional and ignored, castling can be written with
+// zeros, promotions can leave out the '=', captures can leave out the 'x',
+// an "e.p." suffix is allowed, and coordinate notation like "e2e4" works too.
+func (g *Game) ParseSAN(san string) (move.Move, error) {
+	s := strings.TrimSpace(san)
+	s = strings.TrimRight(s, "+#!?")
+	s = strings.TrimSpace(strings.TrimSuffix(s, "e.p."))
+	s = strings.TrimSuffix(s, "ep")
+	if s == "" {
+		return move.Null, fmt.Errorf("Invalid SAN move given. Received %q\n", san)
+	}
+
+	switch strings.ToUpper(strings.ReplaceAll(s, "0", "O")) {
+	case "O-O", "OO":
+		return g.parseCastle(san, true)
+	case "O-O-O", "OOO":
+		return g.parseCastle(san, false)
+	}
+
+	if m, err := g.ParseMove(s); err == nil {
+		return m, nil
+	}
+
+	parts := sanReg.FindStringSubmatch(s)
+	if parts == nil {
+		return move.Null, fmt.Errorf("Invalid SAN move given. Received %q\n", san)
+	}
+	pieceType := piece.Piece(piece.Pawn)
+	if parts[1] != "" {
+		pieceType = piece.FromRune(rune(parts[1][0])).Type()
+	}
+	dest := indexFromPosition(parts[4])
+	var promotion piece.Piece
+	if parts[5] != "" {
+		promotion = piece.FromRune(rune(parts[5][0])).Type()
+	}
+
+	var list move.List
+	g.legalMoves(&list, g.Bitboard(pieceType|g.sideToMove()))
+	found := move.Null
+	for _, m := range list.Slice() {
+		origin := squareNames[m.Origin()]
+		if m.Dest() != dest || m.Promotion().Type() != promotion ||
+			parts[2] != "" && origin[0] != parts[2][0] ||
+			parts[3] != "" && origin[1] != parts[3][0] {
+			continue
+		}
+		if found != move.Null {
+			return move.Null, fmt.Errorf("Ambiguous SAN move given. Received %q\n", san)
+		}
+		found = m
+	}
+	if found == move.Null {
+		return move.Null, fmt.Errorf("Illegal SAN move given. Received %q\n", san)
+	}
+	return found, nil
+}
+
+func (g *Game) parseCastle(san string, kingSide bool) (move.Move, error) {
+	var list move.List
+	g.legalMoves(&list, g.Bitboard(piece.King|g.sideToMove()))
+	for _, m := range list.Slice() {
+		if m.IsCastle() && (m.Dest() > m.Origin()) == kingSide {
+			return m, nil
+		}
+	}
+	return move.Null, fmt.Errorf("Illegal SAN move given. Received %q\n", san)
+}
+
+// MakeSAN parses a move in Standard Algebraic Notation and plays it
+func (g *Game) MakeSAN(san string) error {
+	m, err := g.ParseSAN(san)
+	if err != nil {
+		return err
+	}
+	g.make(m)
+	return nil
+}
+
+func pieceLetter(p piece.Piece) string {
+	return (piece.White | p.Type()).String()
+}
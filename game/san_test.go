@@ -0,0 +1,120 @@
+package game_test
+
+import (
+	"testing"
+
+	"bareman.net/chess-engine/game"
+)
+
+func TestSAN(t *testing.T) {
+	cases := []struct {
+		fen string
+		mv  string
+		san string
+	}{
+		{"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", "g1f3", "Nf3"},
+		{"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", "e2e4", "e4"},
+		// Knights on b8 and f6 can both reach d7
+		{"rn1qkb1r/pp2pppp/2p2n2/3p4/3P4/2N2N2/PPP1PPPP/R1BQKB1R b KQkq - 0 1", "b8d7", "Nbd7"},
+		// Rooks on a1 and a5 share a file
+		{"4k3/8/8/R7/8/8/8/R3K3 w - - 0 1", "a1a3", "R1a3"},
+		// Queens on a1, a3 and c1 all reach b2
+		{"4k3/8/8/8/8/Q7/8/Q1Q1K3 w - - 0 1", "a1b2", "Qa1b2"},
+		{"4k3/8/8/3pP3/8/8/8/4K3 w - d6 0 1", "e5d6", "exd6"},
+		{"r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1", "e1g1", "O-O"},
+		{"r3k2r/8/8/8/8/8/8/R3K2R b KQkq - 0 1", "e8c8", "O-O-O"},
+		{"3k4/4P3/8/8/8/8/8/4K3 w - - 0 1", "e7e8q", "e8=Q+"},
+		{"3k4/4P3/8/8/8/8/8/4K3 w - - 0 1", "e7e8n", "e8=N"},
+		{"r1bqkbnr/pppp1ppp/2n5/4p2Q/2B1P3/8/PPPP1PPP/RNB1K1NR w KQkq - 2 4", "h5f7", "Qxf7#"},
+	}
+	for _, c := range cases {
+		g, err := game.FromFEN(c.fen)
+		if err != nil {
+			t.Fatalf("Failed to create game with fen '%v'\n", c.fen)
+		}
+		m, err := g.ParseMove(c.mv)
+		if err != nil {
+			t.Fatalf("%v: failed to parse %v: %v\n", c.fen, c.mv, err)
+		}
+		if san := g.SAN(m); san != c.san {
+			t.Errorf("%v: expected %v for %v, got %v\n", c.fen, c.san, c.mv, san)
+		}
+		parsed, err := g.ParseSAN(c.san)
+		if err != nil {
+			t.Errorf("%v: failed to parse %v: %v\n", c.fen, c.san, err)
+		} else if parsed != m {
+			t.Errorf("%v: parsing %v gave %v, expected %v\n", c.fen, c.san, parsed, m)
+		}
+	}
+}
+
+func TestLenientSAN(t *testing.T) {
+	cases := []struct {
+		fen  string
+		sans []string
+		mv   string
+	}{
+		{"4k3/8/8/3pP3/8/8/8/4K3 w - d6 0 1", []string{"exd6 e.p.", "exd6ep", "ed6", "e5xd6", "e5d6"}, "e5d6"},
+		{"r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1", []string{"0-0", "O-O+", "o-o"}, "e1g1"},
+		{"r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1", []string{"0-0-0", "O-O-O!?"}, "e1c1"},
+		{"3k4/4P3/8/8/8/8/8/4K3 w - - 0 1", []string{"e8Q", "e8=q", "e8(Q)", "e8/Q", "e8=Q+!"}, "e7e8q"},
+		{"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", []string{"Ng1f3", "Ng1-f3", "Nf3!!"}, "g1f3"},
+	}
+	for _, c := range cases {
+		g, err := game.FromFEN(c.fen)
+		if err != nil {
+			t.Fatalf("Failed to create game with fen '%v'\n", c.fen)
+		}
+		for _, san := range c.sans {
+			m, err := g.ParseSAN(san)
+			if err != nil {
+				t.Errorf("%v: failed to parse %v: %v\n", c.fen, san, err)
+			} else if m.String() != c.mv {
+				t.Errorf("%v: parsing %v gave %v, expected %v\n", c.fen, san, m, c.mv)
+			}
+		}
+	}
+}
+
+func TestInvalidSAN(t *testing.T) {
+	cases := []struct {
+		fen string
+		san string
+	}{
+		{"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", "e5"},
+		{"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", "O-O"},
+		{"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", "Zf3"},
+		{"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", ""},
+		// Both knights can reach d7
+		{"rn1qkb1r/pp2pppp/2p2n2/3p4/3P4/2N2N2/PPP1PPPP/R1BQKB1R b KQkq - 0 1", "Nd7"},
+		// Promotion piece is required
+		{"3k4/4P3/8/8/8/8/8/4K3 w - - 0 1", "e8"},
+	}
+	for _, c := range cases {
+		g, err := game.FromFEN(c.fen)
+		if err != nil {
+			t.Fatalf("Failed to create game with fen '%v'\n", c.fen)
+		}
+		if m, err := g.ParseSAN(c.san); err == nil {
+			t.Errorf("%v: expected %q to be rejected, got %v\n", c.fen, c.san, m)
+		}
+	}
+}
+
+// Every legal move in the perft positions should survive a round trip
+// through SAN
+func TestSANRoundTrip(t *testing.T) {
+	for _, position := range TestingPositions() {
+		g, err := game.FromFEN(position.Fen)
+		if err != nil {
+			t.Fatalf("Failed to create game with fen '%v'\n", position.Fen)
+		}
+		for _, m := range g.AllLegalMoves() {
+			san := g.SAN(m)
+			parsed, err := g.ParseSAN(san)
+			if err != nil || parsed != m {
+				t.Errorf("%v: %v formatted as %v parsed back as %v (%v)\n", position.Fen, m, san, parsed, err)
+			}
+		}
+	}
+}
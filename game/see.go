@@ -0,0 +1,89 @@
+package game
+
+import (
+	"bareman.net/chess-engine/game/bitboard"
+	"bareman.net/chess-engine/game/move"
+	"bareman.net/chess-engine/game/piece"
+)
+
+// Piece values used by SEE, in centipawns. The king can't be captured, so it
+// is worth more than anything it could win.
+var seeValues = [7]int{
+	piece.Pawn:   100,
+	piece.Knight: 300,
+	piece.Bishop: 300,
+	piece.Rook:   500,
+	piece.Queen:  900,
+	piece.King:   20_000,
+}
+
+// Least valuable first, the order attackers recapture in
+var seeOrder = [6]piece.Piece{piece.Pawn, piece.Knight, piece.Bishop, piece.Rook, piece.Queen, piece.King}
+
+// SEE estimates the material won by m in centipawns, assuming both sides
+// keep recapturing on the destination with their least valuable attacker
+// for as long as it pays. Pieces behind the capturers are discovered as the
+// exchange goes on, but pins are ignored. m must be a legal move.
+func (g *Game) SEE(m move.Move) int {
+	origin, dest := m.Origin(), m.Dest()
+	occupied := g.Occupied() &^ bitboard.FromSquare(origin)
+
+	var gain [32]int
+	attacker := g.Board[origin]
+	color := attacker.Color()
+	if m.IsEnPassant() {
+		gain[0] = seeValues[piece.Pawn]
+		occupied &^= bitboard.FromSquare(epCaptureIndex(origin, dest))
+	} else {
+		gain[0] = seeValues[g.Board[dest].Type()]
+	}
+	if promo := m.Promotion(); promo != piece.Empty {
+		gain[0] += seeValues[promo.Type()] - seeValues[piece.Pawn]
+		attacker = promo
+	}
+
+	depth := 0
+	for depth < len(gain)-1 {
+		color = opponent(color)
+		attackers := g.attackers(dest, color, occupied) & occupied
+		if attackers == 0 {
+			break
+		}
+		// Capturing the piece that just moved
+		depth++
+		gain[depth] = seeValues[attacker.Type()] - gain[depth-1]
+		// Nothing follows capturing a king, the previous capture was illegal
+		if attacker.Type() == piece.King {
+			break
+		}
+		var from int
+		from, attacker = g.leastValuable(attackers)
+		occupied &^= bitboard.FromSquare(from)
+	}
+
+	// Each side may stop capturing when that is better for it
+	for ; depth > 0; depth-- {
+		gain[depth-1] = -max(-gain[depth-1], gain[depth])
+	}
+	return gain[0]
+}
+
+// leastValuable returns the square and piece of the least valuable piece in
+// attackers, which must not be empty
+func (g *Game) leastValuable(attackers bitboard.Bitboard) (int, piece.Piece) {
+	for _, t := range seeOrder {
+		if b := attackers & g.Pieces[t]; b != 0 {
+			sq := b.LSB()
+			return sq, g.Board[sq]
+		}
+	}
+	sq := attackers.LSB()
+	return sq, g.Board[sq]
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
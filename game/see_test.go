@@ -0,0 +1,51 @@
+package game_test
+
+import (
+	"testing"
+
+	"bareman.net/chess-engine/game"
+)
+
+func TestSEE(t *testing.T) {
+	cases := []struct {
+		fen string
+		mv  string
+		see int
+	}{
+		// Undefended pawn
+		{"1k1r4/1pp4p/p7/4p3/8/P5P1/1PP4P/2K1R3 w - - 0 1", "e1e5", 100},
+		// Pawn defended by a knight, with a rook behind the first knight
+		{"1k1r3q/1ppn3p/p4b2/4p3/8/P2N2P1/1PP1R1BP/2K1Q3 w - - 0 1", "d3e5", -200},
+		// Rooks stacked on the file recapture through each other
+		{"3r2k1/3r4/8/3p4/8/8/3R4/3R2K1 w - - 0 1", "d2d5", -400},
+		{"3r2k1/8/8/3p4/8/8/3R4/3R2K1 w - - 0 1", "d2d5", 100},
+		// Queen takes a defended pawn
+		{"4k3/8/4p3/3p4/8/8/8/3QK3 w - - 0 1", "d1d5", -800},
+		// Quiet moves to safe squares gain nothing
+		{"4k3/8/8/8/8/8/8/R3K3 w - - 0 1", "a1a5", 0},
+		// Moving a rook to an attacked square loses it
+		{"4k3/8/8/1p6/8/8/8/R3K3 w - - 0 1", "a1a4", -500},
+		// En passant
+		{"4k3/8/8/3pP3/8/8/8/4K3 w - d6 0 1", "e5d6", 100},
+		// Promotion with capture, recaptured by the king
+		{"2r5/1P1k4/8/8/8/8/8/4K3 w - - 0 1", "b7c8q", 500 + 800 - 900},
+		// Knight takes a pawn defended by a pawn
+		{"4k3/8/4p3/3p4/8/2N5/8/4K3 w - - 0 1", "c3d5", -200},
+		// The king may only recapture when nothing else defends
+		{"4k3/3p4/8/8/8/8/8/3RK3 w - - 0 1", "d1d7", -400},
+		{"4k3/3p4/8/8/8/8/3R4/3RK3 w - - 0 1", "d2d7", 100},
+	}
+	for _, c := range cases {
+		g, err := game.FromFEN(c.fen)
+		if err != nil {
+			t.Fatalf("Failed to create game with fen '%v'\n", c.fen)
+		}
+		m, err := g.ParseMove(c.mv)
+		if err != nil {
+			t.Fatalf("%v: %v is not legal\n", c.fen, c.mv)
+		}
+		if see := g.SEE(m); see != c.see {
+			t.Errorf("%v %v: expected %v, got %v\n", c.fen, c.mv, c.see, see)
+		}
+	}
+}
@@ -19,7 +19,7 @@ func FromFEN(fen string) (*Game, error) {
 		return nil, fmt.Errorf("Invalid FEN string. Received %v", fen)
 	}
 	sections := strings.Split(fen, " ")
-	var board [64]piece.Piece
+	game := &Game{}
 	for y, row := range strings.Split(sections[0], "/") {
 		var offset int
 		for x, symbol := range row {
@@ -29,29 +29,41 @@ func FromFEN(fen string) (*Game, error) {
 				continue
 			}
 
-			board[8*(7-y)+x+offset] = piece.FromRune(symbol)
+			game.put(piece.FromRune(symbol), 8*(7-y)+x+offset)
 		}
 	}
 
 	move, _ := strconv.Atoi(sections[5])
 	halfMove, _ := strconv.Atoi(sections[4])
 
-	game := &Game{
-		Board:       board,
-		MoveCount:   move,
-		HalfMove:    halfMove,
-		WhiteToMove: sections[1] == "w",
-		WKCastle:    strings.Contains(sections[2], "K"),
-		WQCastle:    strings.Contains(sections[2], "Q"),
-		BKCastle:    strings.Contains(sections[2], "k"),
-		BQCastle:    strings.Contains(sections[2], "q"),
-		EPTarget:    indexFromPosition(sections[3]),
-	}
-	game.InitializeHash()
+	game.MoveCount = move
+	game.HalfMove = halfMove
+	game.WhiteToMove = sections[1] == "w"
+	game.WKCastle = strings.Contains(sections[2], "K")
+	game.WQCastle = strings.Contains(sections[2], "Q")
+	game.BKCastle = strings.Contains(sections[2], "k")
+	game.BQCastle = strings.Contains(sections[2], "q")
+	game.EPTarget = indexFromPosition(sections[3])
 	game.Hash = Hash(game)
+	game.PawnHash = PawnHash(game)
 	return game, nil
 }
 
+// FromBoard sets up the position on board with no castling rights or en
+// passant target, for walking through placements of a few pieces without
+// going through FEN
+func FromBoard(board [64]piece.Piece, whiteToMove bool) *Game {
+	game := &Game{MoveCount: 1, WhiteToMove: whiteToMove, EPTarget: -1}
+	for i, p := range board {
+		if p != piece.Empty {
+			game.put(p, i)
+		}
+	}
+	game.Hash = Hash(game)
+	game.PawnHash = PawnHash(game)
+	return game
+}
+
 func isValidFEN(fen string) bool {
 	sections := strings.Split(fen, " ")
 	if len(sections) != 6 {
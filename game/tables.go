@@ -0,0 +1,57 @@
+package game
+
+import "bareman.net/chess-engine/game/piece"
+
+// PieceSquareTables give each piece type a value on each square for the
+// midgame and the endgame, from white's point of view, along with how much
+// each piece type counts towards the midgame phase. Values include the
+// material worth of the piece.
+type PieceSquareTables struct {
+	Midgame [7][64]int
+	Endgame [7][64]int
+	Phase   [7]int
+}
+
+// SetPieceSquareTables makes g sum t into Midgame, Endgame and Phase, and
+// recomputes the sums from the board. Tables are shared rather than copied,
+// also by Clone, so must not change while a game uses them. A game without
+// tables has sums of 0.
+func (g *Game) SetPieceSquareTables(t *PieceSquareTables) {
+	g.tables = t
+	g.refreshTables()
+}
+
+// PieceSquareTables returns the tables g sums, or nil if it has none
+func (g *Game) PieceSquareTables() *PieceSquareTables {
+	return g.tables
+}
+
+// updateTables adds (sign 1) or subtracts (sign -1) the table entries for p
+// on index. Black pieces use the square mirrored vertically and count
+// against white.
+func (g *Game) updateTables(p piece.Piece, index int, sign int) {
+	tables := g.tables
+	if tables == nil {
+		return
+	}
+	t := p.Type()
+	if !p.IsWhite() {
+		index ^= 56
+		g.Midgame -= sign * tables.Midgame[t][index]
+		g.Endgame -= sign * tables.Endgame[t][index]
+	} else {
+		g.Midgame += sign * tables.Midgame[t][index]
+		g.Endgame += sign * tables.Endgame[t][index]
+	}
+	g.Phase += sign * tables.Phase[t]
+}
+
+// refreshTables recomputes the piece-square sums from the board
+func (g *Game) refreshTables() {
+	g.Midgame, g.Endgame, g.Phase = 0, 0, 0
+	for i, p := range g.Board {
+		if p != piece.Empty {
+			g.updateTables(p, i, 1)
+		}
+	}
+}
@@ -1,18 +1,21 @@
 package game
 
 import (
-	"fmt"
-	"math"
-	"regexp"
-	"strconv"
-
-	"bareman.net/chess-engine/game/move"
+	"bareman.net/chess-engine/game/piece"
 )
 
 const (
 	colMask = 0b00000111
 )
 
+var squareNames = func() [64]string {
+	var names [64]string
+	for i := range names {
+		names[i] = string([]byte{'a' + byte(i&colMask), '1' + byte(i>>3)})
+	}
+	return names
+}()
+
 func coordinates(index int) (int, int) {
 	col := index & colMask
 	row := index >> 3
@@ -20,27 +23,28 @@ func coordinates(index int) (int, int) {
 }
 
 func indexFromPosition(pos string) int {
-	reg := regexp.MustCompile(move.PositionRegex)
-	if !reg.MatchString(pos) {
+	if len(pos) != 2 {
 		return -1
 	}
-	row, _ := strconv.Atoi(string(pos[1])) // Guaranteed by regex
-	col := int(pos[0] - 'a')
-	return (row-1)<<3 + col
+	file, rank := pos[0]|0x20, pos[1] // lowercase the file
+	if file < 'a' || file > 'h' || rank < '1' || rank > '8' {
+		return -1
+	}
+	return int(rank-'1')<<3 + int(file-'a')
 }
 
 func positionFromIndex(index int) string {
 	if index >= 64 || index < 0 {
 		return "-"
 	}
-	row, col := coordinates(index)
-	return fmt.Sprintf("%v%v", string('a'+rune(col)), row+1)
+	return squareNames[index]
+}
+
+// colorIndex maps piece.White to 0 and piece.Black to 1
+func colorIndex(color piece.Piece) int {
+	return int(color >> 4)
 }
 
-func mdistance(start, finish int) int {
-	sRow, sCol := coordinates(start)
-	fRow, fCol := coordinates(finish)
-	y := math.Abs(float64(sCol - fCol))
-	x := math.Abs(float64(sRow - fRow))
-	return int(x + y)
+func opponent(color piece.Piece) piece.Piece {
+	return color ^ piece.ColorMask
 }
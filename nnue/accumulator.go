@@ -0,0 +1,154 @@
+package nnue
+
+import (
+	"bareman.net/chess-engine/game"
+	"bareman.net/chess-engine/game/piece"
+)
+
+// Accumulator holds the hidden layer of a network for both perspectives of a
+// position. Attached to a game.Game, it is updated as pieces are added and
+// removed. Additions and removals are exact inverses, so unmaking a move
+// restores the previous values.
+type Accumulator struct {
+	net *Network
+	// Hidden layer values by perspective: 0 for white, 1 for black
+	values [2][]int16
+	kings  [2]int
+	// Set when a king has moved, since every feature of its perspective
+	// changes. The perspective is rebuilt from the board when next needed.
+	stale [2]bool
+}
+
+// NewAccumulator computes the hidden layer for the position in g from
+// scratch. Attach it with g.SetAccumulator to keep it up to date.
+func NewAccumulator(net *Network, g *game.Game) *Accumulator {
+	a := &Accumulator{net: net}
+	for persp := range a.values {
+		a.values[persp] = make([]int16, net.HiddenSize)
+	}
+	a.refresh(&g.Board, 0)
+	a.refresh(&g.Board, 1)
+	return a
+}
+
+func (a *Accumulator) Add(p piece.Piece, index int) {
+	a.update(p, index, 1)
+}
+
+func (a *Accumulator) Remove(p piece.Piece, index int) {
+	a.update(p, index, -1)
+}
+
+func (a *Accumulator) update(p piece.Piece, index int, sign int16) {
+	if p.Type() == piece.King {
+		persp := perspective(p.Color())
+		a.kings[persp] = index
+		a.stale[persp] = true
+		return
+	}
+	size := a.net.HiddenSize
+	for persp := range a.values {
+		if a.stale[persp] {
+			continue
+		}
+		f := feature(persp, a.kings[persp], p, index)
+		weights := a.net.FeatureWeights[f*size : (f+1)*size]
+		values := a.values[persp]
+		if sign > 0 {
+			for i, w := range weights {
+				values[i] += w
+			}
+		} else {
+			for i, w := range weights {
+				values[i] -= w
+			}
+		}
+	}
+}
+
+// refresh rebuilds one perspective from the board
+func (a *Accumulator) refresh(board *[64]piece.Piece, persp int) {
+	values := a.values[persp]
+	copy(values, a.net.FeatureBiases)
+	for sq, p := range board {
+		if p.Type() == piece.King && perspective(p.Color()) == persp {
+			a.kings[persp] = sq
+		}
+	}
+	size := a.net.HiddenSize
+	for sq, p := range board {
+		if p == piece.Empty || p.Type() == piece.King {
+			continue
+		}
+		f := feature(persp, a.kings[persp], p, sq)
+		for i, w := range a.net.FeatureWeights[f*size : (f+1)*size] {
+			values[i] += w
+		}
+	}
+	a.stale[persp] = false
+}
+
+// Evaluate scores g in centipawns from the point of view of the side to
+// move. a must be attached to g.
+func (a *Accumulator) Evaluate(g *game.Game) int {
+	for persp := range a.values {
+		if a.stale[persp] {
+			a.refresh(&g.Board, persp)
+		}
+	}
+	us, them := a.values[0], a.values[1]
+	if !g.WhiteToMove {
+		us, them = them, us
+	}
+
+	size := a.net.HiddenSize
+	out := int64(a.net.OutputBias)
+	for i, w := range a.net.OutputWeights[:size] {
+		out += int64(clippedReLU(us[i])) * int64(w)
+	}
+	for i, w := range a.net.OutputWeights[size:] {
+		out += int64(clippedReLU(them[i])) * int64(w)
+	}
+	return int(out * Scale / (QA * QB))
+}
+
+// Values returns the hidden layer for the perspective of color, rebuilding it
+// from the board of g if needed
+func (a *Accumulator) Values(g *game.Game, color piece.Piece) []int16 {
+	persp := perspective(color)
+	if a.stale[persp] {
+		a.refresh(&g.Board, persp)
+	}
+	return a.values[persp]
+}
+
+func clippedReLU(v int16) int16 {
+	if v < 0 {
+		return 0
+	}
+	if v > QA {
+		return QA
+	}
+	return v
+}
+
+func perspective(color piece.Piece) int {
+	if color == piece.White {
+		return 0
+	}
+	return 1
+}
+
+// feature is the HalfKP index of p on index as seen from persp with its king
+// on king. Black sees the board flipped, so both perspectives share weights.
+func feature(persp, king int, p piece.Piece, index int) int {
+	kind := 2 * int(p.Type()-piece.Pawn)
+	if perspective(p.Color()) != persp {
+		kind++
+	}
+	if persp == 1 {
+		king ^= 56
+		index ^= 56
+	}
+	return (king*10+kind)*64 + index
+}
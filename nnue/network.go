@@ -0,0 +1,130 @@
+// Package nnue evaluates positions with an efficiently updatable neural
+// network.
+//
+// The network has a single hidden layer fed by HalfKP features: every
+// non-king piece on its square, relative to the position of one of the kings.
+// The hidden layer is computed once for each king's perspective and kept up
+// to date by an Accumulator as pieces move, so only the small output layer is
+// evaluated at every node.
+//
+// Network files are little-endian and laid out as:
+//
+//	magic         "GNUE"
+//	version       uint32, currently 1
+//	feature set   uint32, 1 for HalfKP
+//	hidden size   uint32, N
+//	feature weights [Features][N]int16
+//	feature biases  [N]int16
+//	output weights  [2N]int16, side to move first
+//	output bias     int32
+package nnue
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+const (
+	magic   = "GNUE"
+	version = 1
+
+	// Feature set identifiers
+	HalfKP = 1
+
+	// Number of HalfKP features for one perspective: 64 king squares by 10
+	// non-king pieces by 64 squares
+	Features = 64 * 10 * 64
+
+	// The hidden layer is clipped to [0, QA] before the output layer, whose
+	// weights are scaled by QB. The output is multiplied by Scale to give
+	// centipawns.
+	QA    = 255
+	QB    = 64
+	Scale = 400
+
+	// Largest hidden layer accepted, to bound memory when loading
+	MaxHiddenSize = 2048
+)
+
+type Network struct {
+	HiddenSize int
+	// Weights of feature f start at f*HiddenSize
+	FeatureWeights []int16
+	FeatureBiases  []int16
+	OutputWeights  []int16
+	OutputBias     int32
+}
+
+// NewNetwork creates a network with all weights zero
+func NewNetwork(hiddenSize int) *Network {
+	return &Network{
+		HiddenSize:     hiddenSize,
+		FeatureWeights: make([]int16, Features*hiddenSize),
+		FeatureBiases:  make([]int16, hiddenSize),
+		OutputWeights:  make([]int16, 2*hiddenSize),
+	}
+}
+
+// LoadFile reads a network from the file at path
+func LoadFile(path string) (*Network, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Load(f)
+}
+
+// Load reads a network in the format described in the package documentation
+func Load(r io.Reader) (*Network, error) {
+	br := bufio.NewReader(r)
+	var header struct {
+		Magic      [4]byte
+		Version    uint32
+		FeatureSet uint32
+		HiddenSize uint32
+	}
+	if err := binary.Read(br, binary.LittleEndian, &header); err != nil {
+		return nil, fmt.Errorf("nnue: reading header: %w", err)
+	}
+	switch {
+	case string(header.Magic[:]) != magic:
+		return nil, errors.New("nnue: not a network file")
+	case header.Version != version:
+		return nil, fmt.Errorf("nnue: unsupported version %v", header.Version)
+	case header.FeatureSet != HalfKP:
+		return nil, fmt.Errorf("nnue: unsupported feature set %v", header.FeatureSet)
+	case header.HiddenSize == 0 || header.HiddenSize > MaxHiddenSize:
+		return nil, fmt.Errorf("nnue: invalid hidden layer size %v", header.HiddenSize)
+	}
+
+	n := NewNetwork(int(header.HiddenSize))
+	for _, data := range []interface{}{n.FeatureWeights, n.FeatureBiases, n.OutputWeights, &n.OutputBias} {
+		if err := binary.Read(br, binary.LittleEndian, data); err != nil {
+			return nil, fmt.Errorf("nnue: reading weights: %w", err)
+		}
+	}
+	if _, err := br.ReadByte(); err != io.EOF {
+		return nil, errors.New("nnue: unexpected data after the network")
+	}
+	return n, nil
+}
+
+// Write stores the network in the format Load reads
+func (n *Network) Write(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString(magic)
+	for _, data := range []interface{}{
+		uint32(version), uint32(HalfKP), uint32(n.HiddenSize),
+		n.FeatureWeights, n.FeatureBiases, n.OutputWeights, n.OutputBias,
+	} {
+		if err := binary.Write(bw, binary.LittleEndian, data); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
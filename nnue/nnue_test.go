@@ -0,0 +1,136 @@
+package nnue_test
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+
+	"bareman.net/chess-engine/game"
+	"bareman.net/chess-engine/game/piece"
+	"bareman.net/chess-engine/nnue"
+	"bareman.net/chess-engine/search"
+)
+
+const hiddenSize = 32
+
+func randomNetwork(seed int64) *nnue.Network {
+	r := rand.New(rand.NewSource(seed))
+	n := nnue.NewNetwork(hiddenSize)
+	for i := range n.FeatureWeights {
+		n.FeatureWeights[i] = int16(r.Intn(65) - 32)
+	}
+	for i := range n.FeatureBiases {
+		n.FeatureBiases[i] = int16(r.Intn(129))
+	}
+	for i := range n.OutputWeights {
+		n.OutputWeights[i] = int16(r.Intn(129) - 64)
+	}
+	n.OutputBias = int32(r.Intn(1000))
+	return n
+}
+
+func equal(a, b []int16) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return len(a) == len(b)
+}
+
+func TestIncrementalAccumulator(t *testing.T) {
+	net := randomNetwork(1)
+	r := rand.New(rand.NewSource(2))
+	fens := []string{
+		"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1",
+		"8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 1",
+		"n1n5/PPPk4/8/8/8/8/4Kppp/5N1N b - - 0 1",
+	}
+	for _, fen := range fens {
+		g, err := game.FromFEN(fen)
+		if err != nil {
+			t.Fatalf("Failed to create game with fen '%v'\n", fen)
+		}
+		acc := nnue.NewAccumulator(net, g)
+		g.SetAccumulator(acc)
+		start := [2][]int16{
+			append([]int16{}, acc.Values(g, piece.White)...),
+			append([]int16{}, acc.Values(g, piece.Black)...),
+		}
+
+		for i := 0; i < 100; i++ {
+			moves := g.AllLegalMoves()
+			if len(moves) == 0 {
+				break
+			}
+			g.MakeUnchecked(moves[r.Intn(len(moves))])
+			fresh := nnue.NewAccumulator(net, g)
+			for _, color := range []piece.Piece{piece.White, piece.Black} {
+				if !equal(acc.Values(g, color), fresh.Values(g, color)) {
+					t.Fatalf("%v: incremental accumulator differs from scratch after %v\n", g.ToFEN(), g.Moves)
+				}
+			}
+			if acc.Evaluate(g) != fresh.Evaluate(g) {
+				t.Fatalf("%v: evaluations differ\n", g.ToFEN())
+			}
+		}
+
+		for len(g.Moves) > 0 {
+			g.Unmake()
+		}
+		if !equal(acc.Values(g, piece.White), start[0]) || !equal(acc.Values(g, piece.Black), start[1]) {
+			t.Errorf("%v: unmaking did not restore the accumulator\n", fen)
+		}
+	}
+}
+
+func TestSymmetry(t *testing.T) {
+	net := randomNetwork(3)
+	a, _ := game.FromFEN("r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1")
+	b, _ := game.FromFEN("r3k2r/pppbbppp/2n2q1P/1P2p3/3pn3/BN2PNP1/P1PPQPB1/R3K2R b KQkq - 0 1")
+	if x, y := nnue.NewAccumulator(net, a).Evaluate(a), nnue.NewAccumulator(net, b).Evaluate(b); x != y {
+		t.Errorf("Expected mirrored positions to evaluate the same, got %v and %v\n", x, y)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	net := randomNetwork(4)
+	var buf bytes.Buffer
+	if err := net.Write(&buf); err != nil {
+		t.Fatalf("Failed to write network: %v\n", err)
+	}
+	data := buf.Bytes()
+
+	loaded, err := nnue.Load(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Failed to load network: %v\n", err)
+	}
+	if loaded.HiddenSize != net.HiddenSize || loaded.OutputBias != net.OutputBias ||
+		!equal(loaded.FeatureWeights, net.FeatureWeights) || !equal(loaded.OutputWeights, net.OutputWeights) {
+		t.Errorf("Loaded network differs from the one written\n")
+	}
+
+	invalid := map[string][]byte{
+		"empty":     nil,
+		"magic":     append([]byte("XNUE"), data[4:]...),
+		"truncated": data[:len(data)-3],
+		"trailing":  append(append([]byte{}, data...), 0),
+	}
+	for name, bad := range invalid {
+		if _, err := nnue.Load(bytes.NewReader(bad)); err == nil {
+			t.Errorf("Expected an error loading a %v file\n", name)
+		}
+	}
+}
+
+func TestSearchWithNetwork(t *testing.T) {
+	g := game.Default()
+	s := search.New(g, search.Limits{Depth: 3})
+	s.Network = randomNetwork(5)
+	if pv := s.Run(); len(pv) == 0 {
+		t.Errorf("Expected a move from a search using the network\n")
+	}
+	if fen := g.ToFEN(); fen != game.Default().ToFEN() {
+		t.Errorf("Search did not restore the position. Got %v\n", fen)
+	}
+}
@@ -0,0 +1,151 @@
+// Package pgn reads and writes games in Portable Game Notation.
+//
+// A Reader parses one game at a time from a stream, so files of any size can
+// be processed in bounded memory. Games that fail to parse are reported with
+// the line and column of the problem, and reading continues with the next
+// game.
+package pgn
+
+import (
+	"fmt"
+
+	"bareman.net/chess-engine/game"
+	"bareman.net/chess-engine/game/move"
+)
+
+const startFEN = "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1"
+
+// The Seven Tag Roster, written first and in this order
+var rosterTags = []string{"Event", "Site", "Date", "Round", "White", "Black", "Result"}
+
+type Tag struct {
+	Name  string
+	Value string
+}
+
+// Node is a move in the game tree along with its annotations and any
+// alternatives to it
+type Node struct {
+	Move move.Move
+	// Comment written before the move, only kept for the first move of a line
+	PreComment string
+	// Comment written after the move
+	Comment string
+	// Numeric Annotation Glyphs, with suffixes like "!?" converted
+	NAGs []int
+	// Each variation replaces this move with a line of its own
+	Variations [][]*Node
+}
+
+type Game struct {
+	Tags []Tag
+	// Mainline moves
+	Moves []*Node
+	// Comment after the last move
+	FinalComment string
+	Result       game.Result
+}
+
+// ParseError describes a game that couldn't be read
+type ParseError struct {
+	Line   int
+	Column int
+	Msg    string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("pgn: line %v, column %v: %v", e.Line, e.Column, e.Msg)
+}
+
+// NewGame builds a game from a starting FEN and mainline moves. An empty fen
+// means the standard starting position.
+func NewGame(fen string, moves []move.Move, result game.Result) (*Game, error) {
+	g := &Game{Result: result}
+	for _, name := range rosterTags {
+		g.Tags = append(g.Tags, Tag{Name: name, Value: "?"})
+	}
+	g.SetTag("Result", result.String())
+	if fen != "" && fen != startFEN {
+		g.SetTag("SetUp", "1")
+		g.SetTag("FEN", fen)
+	}
+
+	pos, err := g.Start()
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range moves {
+		if err := pos.Make(m); err != nil {
+			return nil, err
+		}
+		g.Moves = append(g.Moves, &Node{Move: pos.Moves[len(pos.Moves)-1]})
+	}
+	return g, nil
+}
+
+// Tag returns the value of the named tag, or "" if it isn't set
+func (g *Game) Tag(name string) string {
+	for _, t := range g.Tags {
+		if t.Name == name {
+			return t.Value
+		}
+	}
+	return ""
+}
+
+// SetTag replaces the value of the named tag, adding it if needed
+func (g *Game) SetTag(name, value string) {
+	for i, t := range g.Tags {
+		if t.Name == name {
+			g.Tags[i].Value = value
+			return
+		}
+	}
+	g.Tags = append(g.Tags, Tag{Name: name, Value: value})
+}
+
+// Start returns the position the game starts from, using the FEN tag if
+// there is one
+func (g *Game) Start() (*game.Game, error) {
+	if fen := g.Tag("FEN"); fen != "" {
+		return game.FromFEN(fen)
+	}
+	return game.Default(), nil
+}
+
+// Final returns the position after the last mainline move
+func (g *Game) Final() (*game.Game, error) {
+	pos, err := g.Start()
+	if err != nil {
+		return nil, err
+	}
+	for _, n := range g.Moves {
+		if err := pos.Make(n.Move); err != nil {
+			return nil, err
+		}
+	}
+	return pos, nil
+}
+
+// Mainline returns the moves of the main line
+func (g *Game) Mainline() []move.Move {
+	moves := make([]move.Move, len(g.Moves))
+	for i, n := range g.Moves {
+		moves[i] = n.Move
+	}
+	return moves
+}
+
+func parseResult(s string) (game.Result, bool) {
+	switch s {
+	case "1-0":
+		return game.WhiteWins, true
+	case "0-1":
+		return game.BlackWins, true
+	case "1/2-1/2":
+		return game.Draw, true
+	case "*":
+		return game.Ongoing, true
+	}
+	return game.Ongoing, false
+}
@@ -0,0 +1,228 @@
+package pgn_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"bareman.net/chess-engine/game"
+	"bareman.net/chess-engine/game/move"
+	"bareman.net/chess-engine/pgn"
+)
+
+const games = `[Event "Casual Game"]
+[Site "Berlin GER"]
+[Date "1852.??.??"]
+[Round "?"]
+[White "Adolf Anderssen"]
+[Black "Jean Dufresne"]
+[Result "1-0"]
+
+{The Evergreen Game} 1.e4 e5 2.Nf3 Nc6 3.Bc4 Bc5 4.b4 Bxb4 5.c3 Ba5 6.d4 exd4
+7.O-O d3 8.Qb3 Qf6 9.e5 Qg6 10.Re1 Nge7 11.Ba3 b5 12.Qxb5 Rb8 13.Qa4 Bb6
+14.Nbd2 Bb7 15.Ne4 Qf5 16.Bxd3 Qh5 17.Nf6+ gxf6 18.exf6 Rg8 19.Rad1! Qxf3
+20.Rxe7+ Nxe7 21.Qxd7+! Kxd7 22.Bf5+ Ke8 23.Bd7+ Kf8 24.Bxe7# 1-0
+
+% An escaped line, ignored
+[Event "Annotated"]
+[Result "*"]
+
+1. d4 $1 d5 (1... Nf6 2. c4 (2. Nf3 g6) 2... e6 ; a line comment
+) 2. c4 {Queen's Gambit} dxc4?! *
+
+[Event "From a position"]
+[SetUp "1"]
+[FEN "4k3/8/8/8/8/8/4P3/4K3 w - - 0 40"]
+[Result "1/2-1/2"]
+
+40. e4 Kd7 41. e5 Ke6 1/2-1/2
+`
+
+func readAll(t *testing.T, input string) []*pgn.Game {
+	r := pgn.NewReader(strings.NewReader(input))
+	var result []*pgn.Game
+	for {
+		g, err := r.Next()
+		if err == io.EOF {
+			return result
+		}
+		if err != nil {
+			t.Fatalf("Failed to read game %v: %v\n", len(result)+1, err)
+		}
+		result = append(result, g)
+	}
+}
+
+func TestRead(t *testing.T) {
+	read := readAll(t, games)
+	if len(read) != 3 {
+		t.Fatalf("Expected 3 games, got %v\n", len(read))
+	}
+
+	evergreen := read[0]
+	if evergreen.Tag("White") != "Adolf Anderssen" || evergreen.Result != game.WhiteWins {
+		t.Errorf("Wrong tags or result: %v %v\n", evergreen.Tags, evergreen.Result)
+	}
+	if len(evergreen.Moves) != 47 {
+		t.Errorf("Expected 47 moves, got %v\n", len(evergreen.Moves))
+	}
+	if c := evergreen.Moves[0].PreComment; c != "The Evergreen Game" {
+		t.Errorf("Expected comment before the first move, got %q\n", c)
+	}
+	if nags := evergreen.Moves[36].NAGs; len(nags) != 1 || nags[0] != 1 {
+		t.Errorf("Expected ! on Rad1, got %v\n", nags)
+	}
+	final, err := evergreen.Final()
+	if err != nil {
+		t.Fatalf("Failed to replay game: %v\n", err)
+	}
+	if !final.IsCheckmate() {
+		t.Errorf("Expected the game to end in checkmate\n")
+	}
+
+	annotated := read[1]
+	if annotated.Result != game.Ongoing || len(annotated.Moves) != 4 {
+		t.Fatalf("Expected 4 moves and no result, got %v and %v\n", len(annotated.Moves), annotated.Result)
+	}
+	if nags := annotated.Moves[0].NAGs; len(nags) != 1 || nags[0] != 1 {
+		t.Errorf("Expected $1 on d4, got %v\n", nags)
+	}
+	if nags := annotated.Moves[3].NAGs; len(nags) != 1 || nags[0] != 6 {
+		t.Errorf("Expected ?! on dxc4, got %v\n", nags)
+	}
+	if c := annotated.Moves[2].Comment; c != "Queen's Gambit" {
+		t.Errorf("Expected comment after c4, got %q\n", c)
+	}
+	variations := annotated.Moves[1].Variations
+	if len(variations) != 1 || len(variations[0]) != 3 {
+		t.Fatalf("Expected one variation of 3 moves, got %v\n", variations)
+	}
+	if mv := variations[0][0].Move.String(); mv != "g8f6" {
+		t.Errorf("Expected variation to start with g8f6, got %v\n", mv)
+	}
+	if c := variations[0][2].Comment; c != "a line comment" {
+		t.Errorf("Expected line comment after e6, got %q\n", c)
+	}
+	nested := variations[0][1].Variations
+	if len(nested) != 1 || len(nested[0]) != 2 || nested[0][1].Move.String() != "g7g6" {
+		t.Errorf("Expected nested variation 2. Nf3 g6, got %v\n", nested)
+	}
+
+	position := read[2]
+	final, err = position.Final()
+	if err != nil {
+		t.Fatalf("Failed to replay game: %v\n", err)
+	}
+	if fen := final.ToFEN(); !strings.HasPrefix(fen, "8/8/4k3/4P3/8/8/8/4K3 w") {
+		t.Errorf("Expected game to start from the FEN tag, got %v\n", fen)
+	}
+	if position.Result != game.Draw {
+		t.Errorf("Expected a draw, got %v\n", position.Result)
+	}
+}
+
+func TestReadErrors(t *testing.T) {
+	input := `[Event "First"]
+
+1. e4 e5 2. Nf3 *
+
+[Event "Illegal"]
+
+1. e4 e5
+2. Ke3 Nc6 *
+
+[Event "Unterminated
+[Event "Third"]
+
+1. d4 {unfinished`
+
+	r := pgn.NewReader(strings.NewReader(input))
+	expected := []struct {
+		event        string
+		line, column int
+	}{
+		{"First", 0, 0},
+		{"", 8, 4},
+		{"", 10, 21},
+		{"", 13, 7},
+	}
+	for i, e := range expected {
+		g, err := r.Next()
+		if e.line == 0 {
+			if err != nil || g.Tag("Event") != e.event {
+				t.Errorf("Game %v: expected event %v, got %v\n", i+1, e.event, err)
+			}
+			continue
+		}
+		var parseErr *pgn.ParseError
+		if !errors.As(err, &parseErr) {
+			t.Errorf("Game %v: expected a parse error, got %v\n", i+1, err)
+			continue
+		}
+		if parseErr.Line != e.line || parseErr.Column != e.column {
+			t.Errorf("Game %v: expected error at %v:%v, got %v\n", i+1, e.line, e.column, parseErr)
+		}
+	}
+	if _, err := r.Next(); err != io.EOF {
+		t.Errorf("Expected io.EOF after the last game, got %v\n", err)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	for _, g := range readAll(t, games) {
+		if err := pgn.Write(&buf, g); err != nil {
+			t.Fatalf("Failed to write game: %v\n", err)
+		}
+	}
+	for i, line := range strings.Split(buf.String(), "\n") {
+		if len(line) >= 80 {
+			t.Errorf("Line %v is %v characters long\n", i+1, len(line))
+		}
+	}
+
+	written := buf.String()
+	buf.Reset()
+	for _, g := range readAll(t, written) {
+		if err := pgn.Write(&buf, g); err != nil {
+			t.Fatalf("Failed to write game: %v\n", err)
+		}
+	}
+	if buf.String() != written {
+		t.Errorf("Expected writing to be stable. First:\n%v\nSecond:\n%v\n", written, buf.String())
+	}
+	if !strings.Contains(written, "1. d4 $1 d5 (1... Nf6 2. c4 (2. Nf3 g6) 2... e6 {a line comment})") {
+		t.Errorf("Unexpected variation formatting:\n%v\n", written)
+	}
+	if !strings.Contains(written, "[FEN \"4k3/8/8/8/8/8/4P3/4K3 w - - 0 40\"]\n\n40. e4 Kd7") {
+		t.Errorf("Unexpected move numbers:\n%v\n", written)
+	}
+}
+
+func TestNewGame(t *testing.T) {
+	var moves []move.Move
+	for _, mv := range []string{"f2f3", "e7e5", "g2g4", "d8h4"} {
+		m, _ := move.Parse(mv)
+		moves = append(moves, m)
+	}
+	g, err := pgn.NewGame("", moves, game.BlackWins)
+	if err != nil {
+		t.Fatalf("Failed to create game: %v\n", err)
+	}
+	var buf bytes.Buffer
+	if err := pgn.Write(&buf, g); err != nil {
+		t.Fatalf("Failed to write game: %v\n", err)
+	}
+	if !strings.HasSuffix(buf.String(), "\n\n1. f3 e5 2. g4 Qh4# 0-1\n\n") {
+		t.Errorf("Unexpected movetext:\n%v\n", buf.String())
+	}
+	if !strings.HasPrefix(buf.String(), "[Event \"?\"]\n") || !strings.Contains(buf.String(), "[Result \"0-1\"]\n") {
+		t.Errorf("Expected the Seven Tag Roster:\n%v\n", buf.String())
+	}
+
+	if _, err := pgn.NewGame("", moves[1:], game.Ongoing); err == nil {
+		t.Errorf("Expected an error for an illegal move\n")
+	}
+}
@@ -0,0 +1,509 @@
+package pgn
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"bareman.net/chess-engine/game"
+)
+
+const (
+	// Longest token, comment or tag value accepted, so a corrupt file can't
+	// make the reader buffer without limit
+	maxTokenLength = 1 << 16
+	// Deepest nesting of variations accepted
+	maxVariationDepth = 64
+)
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenSymbol
+	tokenString
+	tokenComment
+	tokenNAG
+	tokenDot
+	tokenOpenTag
+	tokenCloseTag
+	tokenOpenVariation
+	tokenCloseVariation
+)
+
+type token struct {
+	kind   tokenKind
+	text   string
+	line   int
+	column int
+}
+
+// Suffix annotations and the glyphs they stand for
+var suffixNAGs = map[string]int{"!": 1, "?": 2, "!!": 3, "??": 4, "!?": 5, "?!": 6}
+
+type Reader struct {
+	r      *bufio.Reader
+	line   int
+	column int
+	// Position before the last rune read, to allow unreading it
+	prevLine   int
+	prevColumn int
+	peeked     *token
+}
+
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: bufio.NewReader(r), line: 1, column: 1}
+}
+
+// Next reads the next game. It returns io.EOF once there are no more games.
+// If a game can't be parsed, the error is a *ParseError and the rest of that
+// game is skipped, so Next can be called again to continue with the
+// following game.
+func (r *Reader) Next() (*Game, error) {
+	tok, err := r.peek()
+	if err != nil {
+		return nil, err
+	}
+	if tok.kind == tokenEOF {
+		return nil, io.EOF
+	}
+
+	g, err := r.parseGame()
+	var parseErr *ParseError
+	if errors.As(err, &parseErr) {
+		if skipErr := r.skipGame(); skipErr != nil {
+			return nil, skipErr
+		}
+	}
+	return g, err
+}
+
+func (r *Reader) parseGame() (*Game, error) {
+	g := &Game{}
+	for {
+		tok, err := r.peek()
+		if err != nil {
+			return nil, err
+		}
+		if tok.kind != tokenOpenTag {
+			break
+		}
+		if err := r.parseTag(g); err != nil {
+			return nil, err
+		}
+	}
+
+	pos, err := g.Start()
+	if err != nil {
+		tok, _ := r.peek()
+		return nil, r.errorAt(tok, "invalid FEN tag: "+err.Error())
+	}
+	moves, comment, result, err := r.parseLine(pos, 0)
+	if err != nil {
+		return nil, err
+	}
+	g.Moves = moves
+	g.FinalComment = comment
+	g.Result = result
+	return g, nil
+}
+
+func (r *Reader) parseTag(g *Game) error {
+	r.next()
+	name, err := r.expect(tokenSymbol, "tag name")
+	if err != nil {
+		return err
+	}
+	value, err := r.expect(tokenString, "tag value")
+	if err != nil {
+		return err
+	}
+	if _, err := r.expect(tokenCloseTag, "]"); err != nil {
+		return err
+	}
+	g.Tags = append(g.Tags, Tag{Name: name.text, Value: value.text})
+	return nil
+}
+
+// parseLine reads moves until the end of the game or, for a variation, the
+// closing bracket. Moves are played on pos while parsing, and unmade again
+// before returning. Returns the moves, any comment not attached to a move,
+// and the game result.
+func (r *Reader) parseLine(pos *game.Game, depth int) ([]*Node, string, game.Result, error) {
+	var nodes []*Node
+	var pending string
+	made := 0
+	defer func() {
+		for ; made > 0; made-- {
+			pos.Unmake()
+		}
+	}()
+
+	for {
+		tok, err := r.next()
+		if err != nil {
+			return nil, "", game.Ongoing, err
+		}
+		var last *Node
+		if len(nodes) > 0 {
+			last = nodes[len(nodes)-1]
+		}
+
+		switch tok.kind {
+		case tokenEOF:
+			if depth > 0 {
+				return nil, "", game.Ongoing, r.errorAt(tok, "unterminated variation")
+			}
+			return nodes, pending, game.Ongoing, nil
+
+		case tokenOpenTag:
+			// The next game started without a result
+			r.peeked = &tok
+			if depth > 0 {
+				return nil, "", game.Ongoing, r.errorAt(tok, "unterminated variation")
+			}
+			return nodes, pending, game.Ongoing, nil
+
+		case tokenDot:
+
+		case tokenComment:
+			if last != nil && pending == "" {
+				last.Comment = joinComment(last.Comment, tok.text)
+			} else {
+				pending = joinComment(pending, tok.text)
+			}
+
+		case tokenNAG:
+			if last == nil {
+				return nil, "", game.Ongoing, r.errorAt(tok, "annotation before any move")
+			}
+			nag, err := strconv.Atoi(tok.text)
+			if err != nil {
+				return nil, "", game.Ongoing, r.errorAt(tok, "invalid annotation $"+tok.text)
+			}
+			last.NAGs = append(last.NAGs, nag)
+
+		case tokenOpenVariation:
+			if last == nil {
+				return nil, "", game.Ongoing, r.errorAt(tok, "variation before any move")
+			}
+			if depth >= maxVariationDepth {
+				return nil, "", game.Ongoing, r.errorAt(tok, "variations nested too deeply")
+			}
+			// The variation replaces the last move
+			pos.Unmake()
+			variation, comment, _, err := r.parseLine(pos, depth+1)
+			pos.MakeUnchecked(last.Move)
+			if err != nil {
+				return nil, "", game.Ongoing, err
+			}
+			if len(variation) > 0 {
+				last.Variations = append(last.Variations, variation)
+				if comment != "" {
+					tail := variation[len(variation)-1]
+					tail.Comment = joinComment(tail.Comment, comment)
+				}
+			}
+
+		case tokenCloseVariation:
+			if depth == 0 {
+				return nil, "", game.Ongoing, r.errorAt(tok, "unexpected )")
+			}
+			return nodes, pending, game.Ongoing, nil
+
+		case tokenSymbol:
+			if result, ok := parseResult(tok.text); ok {
+				if depth > 0 {
+					return nil, "", game.Ongoing, r.errorAt(tok, "result inside a variation")
+				}
+				return nodes, pending, result, nil
+			}
+			if isMoveNumber(tok.text) {
+				continue
+			}
+			san, suffix := splitSuffix(tok.text)
+			if nag, ok := suffixNAGs[suffix]; suffix != "" && !ok {
+				return nil, "", game.Ongoing, r.errorAt(tok, "invalid annotation "+suffix)
+			} else if san == "" {
+				if last == nil {
+					return nil, "", game.Ongoing, r.errorAt(tok, "annotation before any move")
+				}
+				last.NAGs = append(last.NAGs, nag)
+				continue
+			}
+			m, err := pos.ParseSAN(san)
+			if err != nil {
+				return nil, "", game.Ongoing, r.errorAt(tok, "illegal move "+tok.text)
+			}
+			node := &Node{Move: m, PreComment: pending}
+			if suffix != "" {
+				node.NAGs = append(node.NAGs, suffixNAGs[suffix])
+			}
+			pending = ""
+			pos.MakeUnchecked(m)
+			made++
+			nodes = append(nodes, node)
+
+		default:
+			return nil, "", game.Ongoing, r.errorAt(tok, "unexpected "+tok.text)
+		}
+	}
+}
+
+// skipGame discards tokens up to the end of the current game: its result or
+// the tags of the next game. A tag directly following another belongs to the
+// game being skipped.
+func (r *Reader) skipGame() error {
+	prev := tokenEOF
+	for {
+		tok, err := r.next()
+		if err != nil {
+			if errors.Is(err, io.ErrUnexpectedEOF) {
+				return nil
+			}
+			var parseErr *ParseError
+			if errors.As(err, &parseErr) {
+				continue
+			}
+			return err
+		}
+		switch tok.kind {
+		case tokenEOF:
+			return nil
+		case tokenOpenTag:
+			if prev != tokenCloseTag {
+				r.peeked = &tok
+				return nil
+			}
+		case tokenSymbol:
+			if _, ok := parseResult(tok.text); ok {
+				return nil
+			}
+		}
+		prev = tok.kind
+	}
+}
+
+func (r *Reader) expect(kind tokenKind, name string) (token, error) {
+	tok, err := r.next()
+	if err != nil {
+		return tok, err
+	}
+	if tok.kind != kind {
+		return tok, r.errorAt(tok, "expected "+name)
+	}
+	return tok, nil
+}
+
+func (r *Reader) errorAt(tok token, msg string) error {
+	return &ParseError{Line: tok.line, Column: tok.column, Msg: msg}
+}
+
+func (r *Reader) peek() (token, error) {
+	if r.peeked == nil {
+		tok, err := r.lex()
+		if err != nil {
+			return tok, err
+		}
+		r.peeked = &tok
+	}
+	return *r.peeked, nil
+}
+
+func (r *Reader) next() (token, error) {
+	if r.peeked != nil {
+		tok := *r.peeked
+		r.peeked = nil
+		return tok, nil
+	}
+	return r.lex()
+}
+
+// lex reads the next token from the stream
+func (r *Reader) lex() (token, error) {
+	for {
+		c, err := r.read()
+		if err == io.EOF {
+			return token{kind: tokenEOF, line: r.line, column: r.column}, nil
+		}
+		if err != nil {
+			return token{}, err
+		}
+		if unicode.IsSpace(c) {
+			continue
+		}
+		tok := token{line: r.prevLine, column: r.prevColumn, text: string(c)}
+
+		switch {
+		case c == '%' && tok.column == 1:
+			// Escaped line
+			if _, err := r.readUntil('\n', false); err != nil {
+				return tok, err
+			}
+			continue
+		case c == '[':
+			tok.kind = tokenOpenTag
+		case c == ']':
+			tok.kind = tokenCloseTag
+		case c == '(':
+			tok.kind = tokenOpenVariation
+		case c == ')':
+			tok.kind = tokenCloseVariation
+		case c == '.':
+			tok.kind = tokenDot
+		case c == '{':
+			tok.kind = tokenComment
+			tok.text, err = r.readUntil('}', true)
+			tok.text = strings.Join(strings.Fields(tok.text), " ")
+		case c == ';':
+			tok.kind = tokenComment
+			tok.text, err = r.readUntil('\n', false)
+			tok.text = strings.TrimSpace(tok.text)
+		case c == '"':
+			tok.kind = tokenString
+			tok.text, err = r.readString()
+		case c == '$':
+			tok.kind = tokenNAG
+			tok.text, err = r.readWhile(unicode.IsDigit)
+		case c == '*' || isSymbolStart(c):
+			tok.kind = tokenSymbol
+			var rest string
+			rest, err = r.readWhile(isSymbolRune)
+			tok.text += rest
+		default:
+			return tok, r.errorAt(tok, "unexpected character "+strconv.QuoteRune(c))
+		}
+		if err == io.EOF {
+			return tok, r.errorAt(tok, "unexpected end of file")
+		}
+		return tok, err
+	}
+}
+
+func (r *Reader) read() (rune, error) {
+	c, _, err := r.r.ReadRune()
+	if err != nil {
+		return c, err
+	}
+	r.prevLine, r.prevColumn = r.line, r.column
+	if c == '\n' {
+		r.line++
+		r.column = 1
+	} else {
+		r.column++
+	}
+	return c, nil
+}
+
+func (r *Reader) unread() {
+	r.r.UnreadRune()
+	r.line, r.column = r.prevLine, r.prevColumn
+}
+
+// readUntil reads up to the delimiter, which is consumed but not returned.
+// Reaching the end of the file is only an error if the delimiter is required.
+func (r *Reader) readUntil(delim rune, required bool) (string, error) {
+	var sb strings.Builder
+	for {
+		c, err := r.read()
+		if err == io.EOF && !required {
+			return sb.String(), nil
+		}
+		if err != nil {
+			return sb.String(), err
+		}
+		if c == delim {
+			return sb.String(), nil
+		}
+		if sb.Len() >= maxTokenLength {
+			return sb.String(), &ParseError{Line: r.prevLine, Column: r.prevColumn, Msg: "token too long"}
+		}
+		sb.WriteRune(c)
+	}
+}
+
+// readWhile reads runes for as long as they match
+func (r *Reader) readWhile(match func(rune) bool) (string, error) {
+	var sb strings.Builder
+	for {
+		c, err := r.read()
+		if err == io.EOF {
+			return sb.String(), nil
+		}
+		if err != nil {
+			return sb.String(), err
+		}
+		if !match(c) {
+			r.unread()
+			return sb.String(), nil
+		}
+		if sb.Len() >= maxTokenLength {
+			return sb.String(), &ParseError{Line: r.prevLine, Column: r.prevColumn, Msg: "token too long"}
+		}
+		sb.WriteRune(c)
+	}
+}
+
+// readString reads a quoted string, handling backslash escapes
+func (r *Reader) readString() (string, error) {
+	var sb strings.Builder
+	for {
+		c, err := r.read()
+		if err != nil {
+			return sb.String(), err
+		}
+		switch c {
+		case '"':
+			return sb.String(), nil
+		case '\n':
+			return sb.String(), &ParseError{Line: r.prevLine, Column: r.prevColumn, Msg: "unterminated string"}
+		case '\\':
+			if c, err = r.read(); err != nil {
+				return sb.String(), err
+			}
+		}
+		if sb.Len() >= maxTokenLength {
+			return sb.String(), &ParseError{Line: r.prevLine, Column: r.prevColumn, Msg: "token too long"}
+		}
+		sb.WriteRune(c)
+	}
+}
+
+func isSymbolStart(c rune) bool {
+	return c < unicode.MaxASCII && (unicode.IsLetter(c) || unicode.IsDigit(c))
+}
+
+func isSymbolRune(c rune) bool {
+	return isSymbolStart(c) || strings.ContainsRune("_+#=:-/!?", c)
+}
+
+func isMoveNumber(s string) bool {
+	for _, c := range s {
+		if !unicode.IsDigit(c) {
+			return false
+		}
+	}
+	return true
+}
+
+// splitSuffix separates a trailing annotation like "!?" from a move
+func splitSuffix(s string) (string, string) {
+	i := strings.IndexAny(s, "!?")
+	if i == -1 {
+		return s, ""
+	}
+	return s[:i], s[i:]
+}
+
+func joinComment(a, b string) string {
+	if a == "" {
+		return b
+	}
+	if b == "" {
+		return a
+	}
+	return a + " " + b
+}
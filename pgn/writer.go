@@ -0,0 +1,172 @@
+package pgn
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"bareman.net/chess-engine/game"
+)
+
+// Export format keeps lines below 80 characters
+const maxLineLength = 79
+
+// Write writes g in export format, followed by a blank line so games can be
+// written one after another
+func Write(w io.Writer, g *Game) error {
+	bw := bufio.NewWriter(w)
+	for _, tag := range sortedTags(g) {
+		bw.WriteString("[" + tag.Name + " " + quote(tag.Value) + "]\n")
+	}
+	bw.WriteString("\n")
+
+	pos, err := g.Start()
+	if err != nil {
+		return err
+	}
+	mw := &movetextWriter{w: bw}
+	if err := mw.writeLine(pos, g.Moves, fullMoveNumber(g.Tag("FEN"))); err != nil {
+		return err
+	}
+	if g.FinalComment != "" {
+		mw.write("{" + escapeComment(g.FinalComment) + "}")
+	}
+	mw.write(g.Result.String())
+	bw.WriteString("\n\n")
+	return bw.Flush()
+}
+
+// sortedTags returns the Seven Tag Roster followed by all other tags in the
+// order they were given. Missing roster tags are filled in with "?".
+func sortedTags(g *Game) []Tag {
+	tags := make([]Tag, 0, len(g.Tags)+len(rosterTags))
+	for _, name := range rosterTags {
+		value := g.Tag(name)
+		switch {
+		case name == "Result":
+			value = g.Result.String()
+		case value == "":
+			value = "?"
+		}
+		tags = append(tags, Tag{Name: name, Value: value})
+	}
+	for _, tag := range g.Tags {
+		if !isRosterTag(tag.Name) {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+func isRosterTag(name string) bool {
+	for _, n := range rosterTags {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+type movetextWriter struct {
+	w      *bufio.Writer
+	length int
+	// Set after an opening bracket, so the next token follows it directly
+	attach bool
+}
+
+// write adds a token to the movetext, wrapping the line if it gets too long
+func (mw *movetextWriter) write(s string) {
+	if mw.length > 0 && mw.length+1+len(s) > maxLineLength {
+		mw.w.WriteString("\n")
+		mw.length = 0
+	} else if mw.length > 0 && !mw.attach {
+		mw.w.WriteString(" ")
+		mw.length++
+	}
+	mw.w.WriteString(s)
+	mw.length += len(s)
+	mw.attach = false
+}
+
+// writeLine writes nodes as played from pos, which is restored afterwards.
+// number is the move number of the first move.
+func (mw *movetextWriter) writeLine(pos *game.Game, nodes []*Node, number int) error {
+	made := 0
+	defer func() {
+		for ; made > 0; made-- {
+			pos.Unmake()
+		}
+	}()
+
+	// Black moves need their number after anything interrupting the line
+	needNumber := true
+	for i, n := range nodes {
+		// Look up the legal move, in case n.Move is missing its flags
+		m, err := pos.ParseMove(n.Move.String())
+		if err != nil {
+			return fmt.Errorf("pgn: illegal move %v at ply %v", n.Move, i+1)
+		}
+		if n.PreComment != "" {
+			mw.write("{" + escapeComment(n.PreComment) + "}")
+			needNumber = true
+		}
+		if pos.WhiteToMove {
+			mw.write(strconv.Itoa(number) + ".")
+		} else if needNumber {
+			mw.write(strconv.Itoa(number) + "...")
+		}
+		mw.write(pos.SAN(m))
+		needNumber = false
+		for _, nag := range n.NAGs {
+			mw.write("$" + strconv.Itoa(nag))
+		}
+		if n.Comment != "" {
+			mw.write("{" + escapeComment(n.Comment) + "}")
+			needNumber = true
+		}
+		// Variations replace this move, so are written from the position
+		// before it is made
+		for _, variation := range n.Variations {
+			mw.write("(")
+			mw.attach = true
+			if err := mw.writeLine(pos, variation, number); err != nil {
+				return err
+			}
+			mw.attach = true
+			mw.write(")")
+			needNumber = true
+		}
+
+		if !pos.WhiteToMove {
+			number++
+		}
+		pos.MakeUnchecked(m)
+		made++
+	}
+	return nil
+}
+
+// fullMoveNumber returns the move number a game starts from
+func fullMoveNumber(fen string) int {
+	fields := strings.Fields(fen)
+	if len(fields) < 6 {
+		return 1
+	}
+	number, err := strconv.Atoi(fields[5])
+	if err != nil || number < 1 {
+		return 1
+	}
+	return number
+}
+
+func quote(s string) string {
+	s = strings.ReplaceAll(s, "\\", "\\\\")
+	return `"` + strings.ReplaceAll(s, `"`, `\"`) + `"`
+}
+
+// Comments can't contain their closing brace
+func escapeComment(s string) string {
+	return strings.ReplaceAll(s, "}", ")")
+}
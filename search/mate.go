@@ -0,0 +1,179 @@
+package search
+
+import (
+	"time"
+
+	"bareman.net/chess-engine/game/move"
+	"bareman.net/chess-engine/game/piece"
+)
+
+// Mate proves or disproves a forced mate in at most n moves for the side to
+// move, trying each length up to n in turn. It returns the shortest mating
+// line, in which the defender delays mate as long as possible, or nil if
+// there is no such mate or a limit stopped the search first.
+func (s *Searcher) Mate(n int) []move.Move {
+	s.start = time.Now()
+	s.clock = s.start
+	s.nodes = 0
+	s.time = newTimeManager(s.Limits)
+	s.rootMoves = s.searchMoves()
+	return s.mate(n)
+}
+
+func (s *Searcher) mate(n int) []move.Move {
+	s.excluded = s.excluded[:0]
+	for moves := 1; moves <= n && 2*moves-1 < MaxDepth; moves++ {
+		plies := 2*moves - 1
+		if !s.attack(plies, 0) {
+			if s.isStopped() {
+				return nil
+			}
+			continue
+		}
+		line := s.mateLine(plies)
+		if s.isStopped() {
+			return nil
+		}
+		if s.Report != nil {
+			s.Report(Info{
+				MultiPV: 1,
+				Depth:   plies,
+				Score:   MateScore - plies,
+				Nodes:   s.nodes,
+				Time:    time.Since(s.start),
+				PV:      line,
+			})
+		}
+		return line
+	}
+	return nil
+}
+
+// attack reports whether the side to move can mate within plies plies
+func (s *Searcher) attack(plies, ply int) bool {
+	if s.checkLimits() {
+		return false
+	}
+	s.nodes++
+	list := &s.lists[ply]
+	s.Game.LegalMoves(list)
+	moves := list.Slice()
+	if ply == 0 {
+		moves = s.filterRoot(moves)
+	}
+	// Only a check can mate on the last move
+	for _, mv := range s.mateMoves(moves, ply, plies == 1) {
+		s.Game.MakeUnchecked(mv)
+		mated := s.defend(plies-1, ply+1)
+		s.Game.Unmake()
+		if mated {
+			return true
+		}
+	}
+	return false
+}
+
+// defend reports whether every move of the side to move leads to mate
+// within plies plies
+func (s *Searcher) defend(plies, ply int) bool {
+	if s.checkLimits() {
+		return false
+	}
+	s.nodes++
+	list := &s.lists[ply]
+	s.Game.LegalMoves(list)
+	if list.Len() == 0 {
+		return s.Game.InCheck()
+	}
+	if plies == 0 || s.Game.IsFiftyMoveDraw() {
+		return false
+	}
+	for _, mv := range list.Slice() {
+		s.Game.MakeUnchecked(mv)
+		mated := s.attack(plies-1, ply+1)
+		s.Game.Unmake()
+		if !mated {
+			return false
+		}
+	}
+	return !s.isStopped()
+}
+
+// mateMoves orders the attacker's moves checks first, then captures and
+// promotions. With onlyChecks, other moves are dropped.
+func (s *Searcher) mateMoves(moves []move.Move, ply int, onlyChecks bool) []move.Move {
+	scores := s.scores[ply][:len(moves)]
+	n := 0
+	for _, mv := range moves {
+		s.Game.MakeUnchecked(mv)
+		check := s.Game.InCheck()
+		s.Game.Unmake()
+
+		score := 0
+		if check {
+			score = 2
+		} else if onlyChecks {
+			continue
+		} else if mv.IsCapture() || mv.Promotion() != piece.Empty {
+			score = 1
+		}
+		moves[n], scores[n] = mv, score
+		n++
+	}
+	sortMoves(moves[:n], scores[:n])
+	return moves[:n]
+}
+
+// mateLine plays out a proven mate in plies plies. The attacker takes the
+// first move that mates in time and the defender the reply that delays mate
+// longest.
+func (s *Searcher) mateLine(plies int) []move.Move {
+	var line []move.Move
+	defer func() {
+		for range line {
+			s.Game.Unmake()
+		}
+	}()
+
+	for plies > 0 {
+		attack := move.Null
+		for _, mv := range s.Game.AllLegalMoves() {
+			if len(line) == 0 && !contains(s.rootMoves, mv) {
+				continue
+			}
+			s.Game.MakeUnchecked(mv)
+			mated := s.defend(plies-1, len(line)+1)
+			s.Game.Unmake()
+			if mated {
+				attack = mv
+				break
+			}
+		}
+		if attack == move.Null {
+			// Only when stopped
+			break
+		}
+		line = append(line, attack)
+		s.Game.MakeUnchecked(attack)
+
+		defence, longest := move.Null, 0
+		for _, mv := range s.Game.AllLegalMoves() {
+			s.Game.MakeUnchecked(mv)
+			n := 1
+			for n < plies-2 && !s.attack(n, len(line)+1) {
+				n += 2
+			}
+			s.Game.Unmake()
+			if n > longest {
+				defence, longest = mv, n
+			}
+		}
+		if defence == move.Null {
+			break
+		}
+		line = append(line, defence)
+		s.Game.MakeUnchecked(defence)
+		plies = longest
+	}
+	return append([]move.Move{}, line...)
+}
@@ -0,0 +1,85 @@
+package search
+
+import (
+	"bareman.net/chess-engine/game/move"
+	"bareman.net/chess-engine/game/piece"
+)
+
+// Added to the exchange value of captures that don't lose material, so they
+// are searched before quiet moves
+const goodCapture = 100_000
+
+// orderMoves puts the move from the previous principal variation first, then
+// the best move from the transposition table. Captures which don't lose
+// material come next, best first, then quiet moves and last losing captures.
+func (s *Searcher) orderMoves(moves []move.Move, ply int, ttMove move.Move) {
+	var pvMove move.Move
+	if ply < len(s.prevPV) && s.followingPV(ply) {
+		pvMove = s.prevPV[ply]
+	}
+
+	scores := s.scores[ply][:len(moves)]
+	for i, mv := range moves {
+		switch {
+		case mv == pvMove:
+			scores[i] = Infinity
+		case mv == ttMove:
+			scores[i] = Infinity - 1
+		case mv.IsCapture() || mv.Promotion() != piece.Empty:
+			scores[i] = s.Game.SEE(mv)
+			if scores[i] >= 0 {
+				scores[i] += goodCapture
+			}
+		default:
+			scores[i] = 0
+		}
+	}
+	sortMoves(moves, scores)
+}
+
+// captures filters moves down to those worth searching in quiescence:
+// captures and promotions which don't lose material, best first. When in
+// check every move is kept.
+func (s *Searcher) captures(moves []move.Move, ply int, inCheck bool) []move.Move {
+	scores := s.scores[ply][:len(moves)]
+	n := 0
+	for _, mv := range moves {
+		score := 0
+		if mv.IsCapture() || mv.Promotion() != piece.Empty {
+			score = s.Game.SEE(mv)
+			if score >= 0 {
+				score += goodCapture
+			}
+		}
+		if !inCheck && score < goodCapture {
+			continue
+		}
+		moves[n], scores[n] = mv, score
+		n++
+	}
+	sortMoves(moves[:n], scores[:n])
+	return moves[:n]
+}
+
+// Insertion sort by descending score, the lists are short and mostly need
+// only a few swaps
+func sortMoves(moves []move.Move, scores []int) {
+	for i := 1; i < len(moves); i++ {
+		for j := i; j > 0 && scores[j] > scores[j-1]; j-- {
+			scores[j], scores[j-1] = scores[j-1], scores[j]
+			moves[j], moves[j-1] = moves[j-1], moves[j]
+		}
+	}
+}
+
+// followingPV reports whether the moves played so far match the previous
+// principal variation.
+func (s *Searcher) followingPV(ply int) bool {
+	played := s.Game.Moves[len(s.Game.Moves)-ply:]
+	for i, mv := range played {
+		if mv != s.prevPV[i] {
+			return false
+		}
+	}
+	return true
+}
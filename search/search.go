@@ -0,0 +1,595 @@
+// Package search finds the best move in a position using a negamax
+// alpha-beta search driven by iterative deepening.
+package search
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"bareman.net/chess-engine/eval"
+	"bareman.net/chess-engine/game"
+	"bareman.net/chess-engine/game/move"
+	"bareman.net/chess-engine/nnue"
+)
+
+const (
+	Infinity     = 1_000_000
+	MateScore    = 100_000
+	MaxDepth     = 64
+	DefaultDepth = 4
+
+	// How many nodes are searched between checks of the clock
+	checkInterval = 1024
+)
+
+// Limits bound how long a search may run. A zero value means no limit for
+// that field. If no limit is set and the search isn't infinite, the search
+// stops after DefaultDepth.
+type Limits struct {
+	Depth    int
+	Nodes    int
+	MoveTime time.Duration
+	// Infinite and pondering searches don't return until Stop is called,
+	// or PonderHit ends pondering and the other limits are reached.
+	Infinite bool
+	// Search on the opponent's time. No time limits apply until PonderHit.
+	Ponder bool
+
+	// Clock of the side to move, from which the time for this move is
+	// budgeted. MovesToGo is the number of moves until the next time
+	// control, or 0 if the rest of the game must be played in Time.
+	Time      time.Duration
+	Increment time.Duration
+	MovesToGo int
+	// Kept in reserve from MoveTime and Time for communication delays
+	Overhead time.Duration
+
+	// Look for a mate in at most this many moves before anything else. If
+	// there is none, Message is told so and the search carries on as normal
+	// for the best move, to DefaultDepth when there are no other limits.
+	Mate int
+
+	// Root moves to choose from. All legal moves are searched if empty or
+	// if none of these is legal.
+	SearchMoves []move.Move
+}
+
+// Info describes a completed iteration of the search, or one line of it
+// when searching for several.
+type Info struct {
+	// Rank of the line, starting from 1
+	MultiPV int
+	Depth   int
+	Score   int
+	Nodes   int
+	Time    time.Duration
+	PV      []move.Move
+	// Permille of the transposition table in use
+	Hashfull int
+	// Positions looked up in the tablebase
+	TBHits int
+}
+
+type Searcher struct {
+	Game   *game.Game
+	Limits Limits
+	// Called after each completed iteration, if set
+	Report func(Info)
+	// Called with messages for the user, such as a failed mate search, if
+	// set
+	Message func(string)
+	// Transposition table, which may be shared between searches. Optional.
+	Table *Table
+	// Neural network to evaluate with. The handcrafted evaluation is used
+	// if there is none.
+	Network *nnue.Network
+	// Number of threads to search with. Extra threads search their own
+	// copies of Game and share what they find through Table, so are only
+	// started if there is one.
+	Threads int
+	// Endgame tablebase to probe. Optional.
+	Tablebase Tablebase
+	// Number of best lines to find, each starting with a different root
+	// move. Values below 2 find only the best.
+	MultiPV int
+
+	eval   *eval.Evaluator
+	nnue   *nnue.Accumulator
+	nodes  int
+	tbHits int
+	// nodes, published every checkInterval nodes for other threads to read
+	sharedNodes int64
+	helpers     []*Searcher
+	helperWG    sync.WaitGroup
+	start       time.Time
+	stopped     int32
+	// Set while pondering, until PonderHit
+	ponder int32
+	// The search goroutine's copy of ponder
+	pondering bool
+	// Start of the time budget: the start of the search, or the ponder hit
+	clock time.Time
+	// Wakes a search waiting for Stop or PonderHit
+	signal chan struct{}
+	pv     [MaxDepth + 1][MaxDepth + 1]move.Move
+	pvLen  [MaxDepth + 1]int
+	prevPV []move.Move
+	// Root moves which may be searched, and those already taken by earlier
+	// lines of this iteration
+	rootMoves []move.Move
+	excluded  []move.Move
+	time      timeManager
+	lists     [MaxDepth + 1]move.List
+	scores    [MaxDepth + 1][move.MaxMoves]int
+}
+
+func New(g *game.Game, limits Limits) *Searcher {
+	s := &Searcher{Game: g, Limits: limits, eval: eval.New(), signal: make(chan struct{}, 1)}
+	if limits.Ponder {
+		s.ponder = 1
+	}
+	return s
+}
+
+// Stop asks a running search to return as soon as possible. Safe to call
+// from another goroutine.
+func (s *Searcher) Stop() {
+	atomic.StoreInt32(&s.stopped, 1)
+	s.wake()
+}
+
+// PonderHit switches a pondering search to a normal one, timed from now,
+// without restarting it. Safe to call from another goroutine.
+func (s *Searcher) PonderHit() {
+	atomic.StoreInt32(&s.ponder, 0)
+	s.wake()
+}
+
+func (s *Searcher) wake() {
+	select {
+	case s.signal <- struct{}{}:
+	default:
+	}
+}
+
+// syncPonder notices a ponder hit in the search goroutine
+func (s *Searcher) syncPonder() {
+	if s.pondering && atomic.LoadInt32(&s.ponder) == 0 {
+		s.pondering = false
+		s.clock = time.Now()
+	}
+}
+
+// mustWait is whether a search that has finished early has to wait for Stop
+// or PonderHit before returning
+func (s *Searcher) mustWait() bool {
+	return !s.isStopped() && (s.Limits.Infinite || atomic.LoadInt32(&s.ponder) == 1)
+}
+
+func (s *Searcher) isStopped() bool {
+	return atomic.LoadInt32(&s.stopped) == 1
+}
+
+// Run searches the position until one of the limits is reached and returns
+// the principal variation of the deepest completed iteration. The first
+// move of the result is the best move. Returns nil if there are no legal
+// moves.
+func (s *Searcher) Run() []move.Move {
+	s.start = time.Now()
+	s.clock = s.start
+	s.pondering = atomic.LoadInt32(&s.ponder) == 1
+	s.nodes = 0
+	s.tbHits = 0
+	s.prevPV = nil
+	s.time = newTimeManager(s.Limits)
+	if s.Table != nil {
+		s.Table.NewSearch()
+	}
+	if s.Network != nil {
+		s.nnue = nnue.NewAccumulator(s.Network, s.Game)
+		s.Game.SetAccumulator(s.nnue)
+		defer s.Game.SetAccumulator(nil)
+	}
+
+	s.rootMoves = s.tablebaseRoot(s.searchMoves())
+	if len(s.rootMoves) == 0 {
+		return nil
+	}
+	best := []move.Move{s.rootMoves[0]}
+	if s.Limits.Mate > 0 {
+		if line := s.mate(s.Limits.Mate); line != nil {
+			for s.mustWait() {
+				<-s.signal
+			}
+			return line
+		}
+		if s.Message != nil && !s.isStopped() {
+			s.Message(fmt.Sprintf("no mate in %v", s.Limits.Mate))
+		}
+	}
+	s.startHelpers()
+
+	maxDepth := s.Limits.Depth
+	if maxDepth <= 0 || maxDepth > MaxDepth {
+		maxDepth = MaxDepth
+		if s.Limits.Nodes == 0 && s.Limits.MoveTime == 0 && s.Limits.Time == 0 && !s.Limits.Infinite {
+			maxDepth = DefaultDepth
+		}
+	}
+	lines := s.MultiPV
+	if lines < 1 {
+		lines = 1
+	}
+	if lines > len(s.rootMoves) {
+		lines = len(s.rootMoves)
+	}
+	// Principal variation of each line from the previous iteration
+	prev := make([][]move.Move, lines)
+
+	for depth := 1; depth <= maxDepth; depth++ {
+		// Each line is searched without the first moves of the lines above
+		// it, so finds the next best root move
+		var score int
+		s.excluded = s.excluded[:0]
+		for line := 0; line < lines; line++ {
+			s.prevPV = prev[line]
+			lineScore := s.negamax(depth, 0, -Infinity, Infinity)
+			if s.isStopped() {
+				break
+			}
+			pv := append([]move.Move{}, s.pv[0][:s.pvLen[0]]...)
+			prev[line] = pv
+			s.excluded = append(s.excluded, pv[0])
+			if line == 0 {
+				best, score = pv, lineScore
+			}
+			if s.Report != nil {
+				info := Info{
+					MultiPV: line + 1,
+					Depth:   depth,
+					Score:   lineScore,
+					Nodes:   s.totalNodes(),
+					Time:    time.Since(s.start),
+					PV:      pv,
+					TBHits:  s.tbHits,
+				}
+				if s.Table != nil {
+					info.Hashfull = s.Table.Hashfull()
+				}
+				s.Report(info)
+			}
+		}
+		if s.isStopped() {
+			break
+		}
+		// No point searching deeper once a forced mate has been found
+		if _, ok := MateIn(score); ok && lines == 1 {
+			break
+		}
+		s.syncPonder()
+		if s.time.update(depth, best[0], score, time.Since(s.clock)) && !s.pondering {
+			break
+		}
+	}
+
+	for s.mustWait() {
+		<-s.signal
+	}
+	s.stopHelpers()
+	return s.ponderMove(best)
+}
+
+// searchMoves returns the legal root moves allowed by Limits.SearchMoves
+func (s *Searcher) searchMoves() []move.Move {
+	moves := s.Game.AllLegalMoves()
+	var allowed []move.Move
+	for _, m := range moves {
+		if contains(s.Limits.SearchMoves, m) {
+			allowed = append(allowed, m)
+		}
+	}
+	if len(allowed) == 0 {
+		return moves
+	}
+	return allowed
+}
+
+// filterRoot removes the root moves which mustn't be searched in this line
+func (s *Searcher) filterRoot(moves []move.Move) []move.Move {
+	n := 0
+	for _, m := range moves {
+		if contains(s.rootMoves, m) && !contains(s.excluded, m) {
+			moves[n] = m
+			n++
+		}
+	}
+	return moves[:n]
+}
+
+func contains(moves []move.Move, m move.Move) bool {
+	for _, x := range moves {
+		if x == m {
+			return true
+		}
+	}
+	return false
+}
+
+// startHelpers starts the extra threads of a Lazy SMP search. Each runs its
+// own iterative deepening on a copy of the position. Odd threads start a
+// ply deeper, so the threads spread over different depths and fill the
+// table with results the others can use.
+func (s *Searcher) startHelpers() {
+	s.helpers = s.helpers[:0]
+	if s.Table == nil {
+		return
+	}
+	for id := 1; id < s.Threads; id++ {
+		h := &Searcher{
+			Game:      s.Game.Clone(),
+			Table:     s.Table,
+			Tablebase: s.Tablebase,
+			rootMoves: s.rootMoves,
+			Network:   s.Network,
+			eval:      eval.New(),
+			signal:    make(chan struct{}, 1),
+		}
+		s.helpers = append(s.helpers, h)
+		s.helperWG.Add(1)
+		go func(id int) {
+			defer s.helperWG.Done()
+			h.help(id)
+		}(id)
+	}
+}
+
+func (s *Searcher) stopHelpers() {
+	for _, h := range s.helpers {
+		h.Stop()
+	}
+	s.helperWG.Wait()
+}
+
+func (s *Searcher) help(id int) {
+	s.start = time.Now()
+	if s.Network != nil {
+		s.nnue = nnue.NewAccumulator(s.Network, s.Game)
+		s.Game.SetAccumulator(s.nnue)
+	}
+	for depth := 1 + id%2; depth <= MaxDepth; depth++ {
+		s.negamax(depth, 0, -Infinity, Infinity)
+		if s.isStopped() {
+			return
+		}
+		s.prevPV = append([]move.Move{}, s.pv[0][:s.pvLen[0]]...)
+	}
+}
+
+// totalNodes counts the nodes searched by all threads. Those of helper
+// threads lag by up to checkInterval.
+func (s *Searcher) totalNodes() int {
+	n := s.nodes
+	for _, h := range s.helpers {
+		n += int(atomic.LoadInt64(&h.sharedNodes))
+	}
+	return n
+}
+
+// ponderMove extends a principal variation of one move with the reply from
+// the transposition table, so there is a move to ponder on
+func (s *Searcher) ponderMove(pv []move.Move) []move.Move {
+	if len(pv) != 1 || s.Table == nil {
+		return pv
+	}
+	s.Game.MakeUnchecked(pv[0])
+	defer s.Game.Unmake()
+	e, ok := s.Table.probe(s.Game.Hash, 1)
+	if !ok || e.move == move.Null {
+		return pv
+	}
+	for _, m := range s.Game.AllLegalMoves() {
+		if m == e.move {
+			return append(pv, m)
+		}
+	}
+	return pv
+}
+
+func (s *Searcher) negamax(depth, ply int, alpha, beta int) int {
+	s.pvLen[ply] = 0
+	if s.checkLimits() {
+		return 0
+	}
+	s.nodes++
+
+	// A repetition is scored as a draw as soon as it happens, since either
+	// side could repeat it again
+	if ply > 0 && (s.Game.Repetitions() > 0 || s.Game.IsFiftyMoveDraw() || s.Game.IsInsufficientMaterial()) {
+		return 0
+	}
+	if ply >= MaxDepth {
+		return s.evaluate()
+	}
+	if depth == 0 {
+		return s.quiesce(ply, alpha, beta)
+	}
+
+	// Cutoffs aren't taken at the root, so there is always a principal variation
+	var ttMove move.Move
+	if s.Table != nil {
+		if e, ok := s.Table.probe(s.Game.Hash, ply); ok {
+			ttMove = e.move
+			score := int(e.score)
+			if ply > 0 && int(e.depth) >= depth && (e.bound == BoundExact ||
+				e.bound == BoundLower && score >= beta ||
+				e.bound == BoundUpper && score <= alpha) {
+				return score
+			}
+		}
+	}
+
+	if ply > 0 {
+		if score, ok := s.probeWDL(ply); ok {
+			if s.Table != nil {
+				s.Table.store(s.Game.Hash, depth, BoundExact, score, move.Null, ply)
+			}
+			return score
+		}
+	}
+
+	list := &s.lists[ply]
+	s.Game.LegalMoves(list)
+	moves := list.Slice()
+	if len(moves) == 0 {
+		if s.Game.InCheck() {
+			return -MateScore + ply
+		}
+		return 0
+	}
+
+	// The score of a restricted root isn't the score of the position, so
+	// isn't stored
+	restricted := false
+	if ply == 0 {
+		moves = s.filterRoot(moves)
+		restricted = len(moves) != list.Len()
+	}
+
+	s.orderMoves(moves, ply, ttMove)
+	origAlpha := alpha
+	bestMove := move.Null
+	for _, mv := range moves {
+		s.Game.MakeUnchecked(mv)
+		score := -s.negamax(depth-1, ply+1, -beta, -alpha)
+		s.Game.Unmake()
+
+		if s.isStopped() {
+			return 0
+		}
+		if score > alpha {
+			alpha = score
+			bestMove = mv
+			s.pv[ply][0] = mv
+			copy(s.pv[ply][1:], s.pv[ply+1][:s.pvLen[ply+1]])
+			s.pvLen[ply] = s.pvLen[ply+1] + 1
+		}
+		if alpha >= beta {
+			break
+		}
+	}
+
+	if s.Table != nil && !restricted {
+		bound := BoundExact
+		if alpha >= beta {
+			bound = BoundLower
+		} else if alpha <= origAlpha {
+			bound = BoundUpper
+		}
+		s.Table.store(s.Game.Hash, depth, bound, alpha, bestMove, ply)
+	}
+	return alpha
+}
+
+// Quiesce runs only the quiescence search from the current position. It
+// returns the score for the side to move and the captures leading to the
+// quiet position the score was taken from.
+func (s *Searcher) Quiesce() (int, []move.Move) {
+	s.start = time.Now()
+	s.nodes = 0
+	score := s.quiesce(0, -Infinity, Infinity)
+	return score, append([]move.Move{}, s.pv[0][:s.pvLen[0]]...)
+}
+
+// quiesce searches captures until the position is quiet, so the evaluation
+// isn't taken in the middle of an exchange. The side to move may stand pat
+// instead of capturing, unless it is in check, when all evasions are searched.
+func (s *Searcher) quiesce(ply int, alpha, beta int) int {
+	s.pvLen[ply] = 0
+	if s.checkLimits() {
+		return 0
+	}
+	s.nodes++
+	if ply >= MaxDepth {
+		return s.evaluate()
+	}
+
+	inCheck := s.Game.InCheck()
+	if !inCheck {
+		standPat := s.evaluate()
+		if standPat >= beta {
+			return standPat
+		}
+		if standPat > alpha {
+			alpha = standPat
+		}
+	}
+
+	list := &s.lists[ply]
+	s.Game.LegalMoves(list)
+	if list.Len() == 0 {
+		if inCheck {
+			return -MateScore + ply
+		}
+		return 0
+	}
+	moves := s.captures(list.Slice(), ply, inCheck)
+
+	for _, mv := range moves {
+		s.Game.MakeUnchecked(mv)
+		score := -s.quiesce(ply+1, -beta, -alpha)
+		s.Game.Unmake()
+
+		if s.isStopped() {
+			return 0
+		}
+		if score > alpha {
+			alpha = score
+			s.pv[ply][0] = mv
+			copy(s.pv[ply][1:], s.pv[ply+1][:s.pvLen[ply+1]])
+			s.pvLen[ply] = s.pvLen[ply+1] + 1
+		}
+		if alpha >= beta {
+			break
+		}
+	}
+	return alpha
+}
+
+// checkLimits stops the search if it has run out of nodes or time
+func (s *Searcher) checkLimits() bool {
+	if s.isStopped() {
+		return true
+	}
+	if s.nodes%checkInterval == 0 {
+		atomic.StoreInt64(&s.sharedNodes, int64(s.nodes))
+	}
+	s.syncPonder()
+	if s.Limits.Nodes > 0 && s.nodes >= s.Limits.Nodes {
+		s.Stop()
+	} else if !s.pondering && s.time.hard > 0 && s.nodes%checkInterval == 0 && time.Since(s.clock) >= s.time.hard {
+		s.Stop()
+	}
+	return s.isStopped()
+}
+
+// Scores the position in centipawns from the perspective of the side to move
+func (s *Searcher) evaluate() int {
+	if s.nnue != nil {
+		return s.nnue.Evaluate(s.Game)
+	}
+	return s.eval.Evaluate(s.Game)
+}
+
+// MateIn converts a score into the number of moves until mate. The result is
+// negative when the side to move is being mated.
+func MateIn(score int) (int, bool) {
+	if score > MateScore-MaxDepth {
+		return (MateScore - score + 1) / 2, true
+	}
+	if score < -MateScore+MaxDepth {
+		return -(MateScore + score) / 2, true
+	}
+	return 0, false
+}
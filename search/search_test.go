@@ -0,0 +1,290 @@
+package search_test
+
+import (
+	"testing"
+	"time"
+
+	"bareman.net/chess-engine/game"
+	"bareman.net/chess-engine/game/move"
+	"bareman.net/chess-engine/search"
+)
+
+func TestMateInOne(t *testing.T) {
+	g, err := game.FromFEN("6k1/5ppp/8/8/8/8/8/R5K1 w - - 0 1")
+	if err != nil {
+		t.Fatalf("Failed to create game: %v\n", err)
+	}
+	var last search.Info
+	s := search.New(g, search.Limits{Depth: 3})
+	s.Report = func(info search.Info) { last = info }
+	pv := s.Run()
+	if len(pv) == 0 || pv[0].String() != "a1a8" {
+		t.Errorf("Expected a1a8, got %v\n", pv)
+	}
+	if mate, ok := search.MateIn(last.Score); !ok || mate != 1 {
+		t.Errorf("Expected mate in 1, got score %v\n", last.Score)
+	}
+}
+
+func TestWinsMaterial(t *testing.T) {
+	// The black queen is hanging
+	g, err := game.FromFEN("4k3/8/8/3q4/8/8/3R4/4K3 w - - 0 1")
+	if err != nil {
+		t.Fatalf("Failed to create game: %v\n", err)
+	}
+	pv := search.New(g, search.Limits{Depth: 2}).Run()
+	if len(pv) == 0 || pv[0].String() != "d2d5" {
+		t.Errorf("Expected d2d5, got %v\n", pv)
+	}
+}
+
+func TestLimits(t *testing.T) {
+	g := game.Default()
+	var depth int
+	s := search.New(g, search.Limits{Depth: 2})
+	s.Report = func(info search.Info) { depth = info.Depth }
+	s.Run()
+	if depth != 2 {
+		t.Errorf("Expected search to stop at depth 2, got %v\n", depth)
+	}
+
+	s = search.New(g, search.Limits{Nodes: 500})
+	s.Run()
+	if fen := g.ToFEN(); fen != game.Default().ToFEN() {
+		t.Errorf("Search did not restore the position. Got %v\n", fen)
+	}
+}
+
+func TestNoLegalMoves(t *testing.T) {
+	g, err := game.FromFEN("7k/5Q2/6K1/8/8/8/8/8 b - - 0 1")
+	if err != nil {
+		t.Fatalf("Failed to create game: %v\n", err)
+	}
+	if pv := search.New(g, search.Limits{Depth: 1}).Run(); pv != nil {
+		t.Errorf("Expected no moves in stalemate, got %v\n", pv)
+	}
+}
+
+func TestSeeksRepetitionWhenLosing(t *testing.T) {
+	g, err := game.FromFEN("4k1n1/8/8/8/8/8/8/3QK3 b - - 0 1")
+	if err != nil {
+		t.Fatalf("Failed to create game: %v\n", err)
+	}
+	for _, mv := range []string{"g8f6", "d1d2", "f6g8", "d2d1"} {
+		if err := g.MakeString(mv); err != nil {
+			t.Fatalf("Failed to make %v: %v\n", mv, err)
+		}
+	}
+	var last search.Info
+	s := search.New(g, search.Limits{Depth: 2})
+	s.Report = func(info search.Info) { last = info }
+	pv := s.Run()
+	if len(pv) == 0 || pv[0].String() != "g8f6" || last.Score != 0 {
+		t.Errorf("Expected g8f6 to repeat the position, got %v with score %v\n", pv, last.Score)
+	}
+}
+
+func TestQuiescence(t *testing.T) {
+	// Taking the pawn looks good at depth 1, until the recapture is seen
+	g, err := game.FromFEN("4k3/8/4p3/3p4/8/8/8/3QK3 w - - 0 1")
+	if err != nil {
+		t.Fatalf("Failed to create game: %v\n", err)
+	}
+	var last search.Info
+	s := search.New(g, search.Limits{Depth: 1})
+	s.Report = func(info search.Info) { last = info }
+	pv := s.Run()
+	if len(pv) == 0 || pv[0].String() == "d1d5" {
+		t.Errorf("Expected the queen not to take the defended pawn, got %v\n", pv)
+	}
+	if last.Score <= 0 {
+		t.Errorf("Expected white to stay ahead, got score %v\n", last.Score)
+	}
+}
+
+func TestInfiniteWaitsForStop(t *testing.T) {
+	for _, limits := range []search.Limits{{Infinite: true, Depth: 2}, {Ponder: true, Depth: 2}} {
+		s := search.New(game.Default(), limits)
+		result := make(chan []move.Move)
+		go func() { result <- s.Run() }()
+
+		select {
+		case <-result:
+			t.Fatalf("%+v: search returned before being stopped\n", limits)
+		case <-time.After(100 * time.Millisecond):
+		}
+		if limits.Ponder {
+			s.PonderHit()
+		} else {
+			s.Stop()
+		}
+		select {
+		case pv := <-result:
+			if len(pv) < 2 {
+				t.Errorf("%+v: expected a best move and a move to ponder, got %v\n", limits, pv)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("%+v: search didn't return after being released\n", limits)
+		}
+	}
+}
+
+func TestPonderHitStartsClock(t *testing.T) {
+	s := search.New(game.Default(), search.Limits{Ponder: true, Time: 100 * time.Millisecond})
+	result := make(chan []move.Move)
+	go func() { result <- s.Run() }()
+
+	// Time limits don't apply while pondering
+	select {
+	case <-result:
+		t.Fatalf("Pondering search returned by itself\n")
+	case <-time.After(200 * time.Millisecond):
+	}
+	s.PonderHit()
+	select {
+	case <-result:
+	case <-time.After(time.Second):
+		t.Fatalf("Search didn't stop after the ponder hit used its time\n")
+	}
+}
+
+func TestThreads(t *testing.T) {
+	g, err := game.FromFEN("4k3/8/8/3q4/8/8/3R4/4K3 w - - 0 1")
+	if err != nil {
+		t.Fatalf("Failed to create game: %v\n", err)
+	}
+	fen := g.ToFEN()
+	var info search.Info
+	s := search.New(g, search.Limits{Depth: 5})
+	s.Table = search.NewTable(1)
+	s.Threads = 4
+	s.Report = func(i search.Info) { info = i }
+	pv := s.Run()
+	if len(pv) == 0 || pv[0].String() != "d2d5" {
+		t.Errorf("Expected d2d5, got %v\n", pv)
+	}
+	if g.ToFEN() != fen {
+		t.Errorf("Search did not restore the position. Got %v\n", g.ToFEN())
+	}
+	if info.Nodes == 0 {
+		t.Errorf("Expected nodes to be reported\n")
+	}
+}
+
+func TestMultiPV(t *testing.T) {
+	g, err := game.FromFEN("4k3/8/8/3q4/8/8/3R4/4K3 w - - 0 1")
+	if err != nil {
+		t.Fatalf("Failed to create game: %v\n", err)
+	}
+	var lines []search.Info
+	s := search.New(g, search.Limits{Depth: 3})
+	s.MultiPV = 3
+	s.Report = func(info search.Info) {
+		if info.Depth == 3 {
+			lines = append(lines, info)
+		}
+	}
+	s.Run()
+	if len(lines) != 3 {
+		t.Fatalf("Expected 3 lines at the last depth, got %v\n", len(lines))
+	}
+	seen := map[move.Move]bool{}
+	for i, line := range lines {
+		if line.MultiPV != i+1 {
+			t.Errorf("Expected line %v to be ranked %v, got %v\n", i, i+1, line.MultiPV)
+		}
+		if seen[line.PV[0]] {
+			t.Errorf("Root move %v appears in more than one line\n", line.PV[0])
+		}
+		seen[line.PV[0]] = true
+		if i > 0 && line.Score > lines[i-1].Score {
+			t.Errorf("Line %v scores better than the line above it\n", i+1)
+		}
+	}
+	if lines[0].PV[0].String() != "d2d5" {
+		t.Errorf("Expected d2d5 first, got %v\n", lines[0].PV[0])
+	}
+
+	// searchmoves leaves out the capture
+	kingMove, _ := g.ParseMove("e1f1")
+	rookMove, _ := g.ParseMove("d2d3")
+	report := s.Report
+	s = search.New(g, search.Limits{Depth: 3, SearchMoves: []move.Move{kingMove, rookMove}})
+	s.MultiPV = 5
+	s.Report = report
+	lines = nil
+	s.Run()
+	if len(lines) != 2 {
+		t.Fatalf("Expected a line for each of the 2 search moves, got %v\n", len(lines))
+	}
+	for _, line := range lines {
+		if line.PV[0] != kingMove && line.PV[0] != rookMove {
+			t.Errorf("Expected only search moves at the root, got %v\n", line.PV[0])
+		}
+	}
+}
+
+func TestMate(t *testing.T) {
+	tests := []struct {
+		fen   string
+		n     int
+		moves int
+		first string
+	}{
+		{"6k1/5ppp/8/8/8/8/8/R5K1 w - - 0 1", 3, 1, "a1a8"},
+		{"r2qkb1r/pp2nppp/3p4/2pNN1B1/2BnP3/3P4/PPP2PPP/R2bK2R w KQkq - 1 1", 2, 2, "d5f6"},
+		{"r2qkb1r/pp2nppp/3p4/2pNN1B1/2BnP3/3P4/PPP2PPP/R2bK2R w KQkq - 1 1", 1, 0, ""},
+		{"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", 2, 0, ""},
+	}
+	for _, test := range tests {
+		g, err := game.FromFEN(test.fen)
+		if err != nil {
+			t.Fatalf("Failed to create game with fen '%v'\n", test.fen)
+		}
+		line := search.New(g, search.Limits{}).Mate(test.n)
+		if g.ToFEN() != test.fen {
+			t.Errorf("%v: search did not restore the position\n", test.fen)
+		}
+		if test.moves == 0 {
+			if line != nil {
+				t.Errorf("%v: expected no mate in %v, got %v\n", test.fen, test.n, line)
+			}
+			continue
+		}
+		if len(line) != 2*test.moves-1 || line[0].String() != test.first {
+			t.Errorf("%v: expected mate in %v starting %v, got %v\n", test.fen, test.moves, test.first, line)
+			continue
+		}
+		for _, m := range line {
+			g.MakeUnchecked(m)
+		}
+		if !g.InCheck() || len(g.AllLegalMoves()) != 0 {
+			t.Errorf("%v: line %v doesn't end in mate\n", test.fen, line)
+		}
+	}
+}
+
+func TestGoMate(t *testing.T) {
+	g, _ := game.FromFEN("r2qkb1r/pp2nppp/3p4/2pNN1B1/2BnP3/3P4/PPP2PPP/R2bK2R w KQkq - 1 1")
+	var info search.Info
+	s := search.New(g, search.Limits{Mate: 3})
+	s.Report = func(i search.Info) { info = i }
+	pv := s.Run()
+	if mate, ok := search.MateIn(info.Score); !ok || mate != 2 || len(pv) != 3 {
+		t.Errorf("Expected mate in 2 with its line, got score %v and %v\n", info.Score, pv)
+	}
+}
+
+func TestGoMateNotFound(t *testing.T) {
+	g, _ := game.FromFEN("r2qkb1r/pp2nppp/3p4/2pNN1B1/2BnP3/3P4/PPP2PPP/R2bK2R w KQkq - 1 1")
+	var messages []string
+	s := search.New(g, search.Limits{Mate: 1, Depth: 2})
+	s.Message = func(m string) { messages = append(messages, m) }
+	pv := s.Run()
+	if len(messages) != 1 || messages[0] != "no mate in 1" {
+		t.Errorf("Expected to be told there is no mate in 1, got %q\n", messages)
+	}
+	if len(pv) == 0 {
+		t.Errorf("Expected the best move without a mate\n")
+	}
+}
@@ -0,0 +1,153 @@
+package search
+
+import (
+	"bareman.net/chess-engine/game"
+	"bareman.net/chess-engine/game/move"
+)
+
+// WDL is the result of a position with perfect play, for the side to move
+type WDL int
+
+const (
+	Loss WDL = -2
+	// A loss the fifty-move rule turns into a draw
+	BlessedLoss WDL = -1
+	Draw        WDL = 0
+	// A win the fifty-move rule turns into a draw
+	CursedWin WDL = 1
+	Win       WDL = 2
+)
+
+// Scores of tablebase wins, less the distance from the root. They rank
+// below mates found by the search.
+const TBWinScore = MateScore - 2*MaxDepth
+
+// Centipawns reported for tablebase wins, less the distance from the root,
+// so GUIs show a won ending rather than an absurd evaluation
+const TBWinCentipawns = 20_000
+
+// Centipawns converts a score other than a mate into centipawns to report
+func Centipawns(score int) int {
+	if score > TBWinScore-MaxDepth {
+		return TBWinCentipawns - (TBWinScore - score)
+	}
+	if score < -TBWinScore+MaxDepth {
+		return -TBWinCentipawns + (TBWinScore + score)
+	}
+	return score
+}
+
+// Tablebase gives the results of positions with few pieces
+type Tablebase interface {
+	// Most pieces, kings included, of a position the tablebase covers
+	MaxPieces() int
+	// ProbeWDL returns the result for the side to move assuming the
+	// fifty-move counter is zero. ok is false if the position isn't covered.
+	ProbeWDL(g *game.Game) (wdl WDL, ok bool)
+	// ProbeDTZ returns the number of plies to the next capture or pawn move
+	// on the way to the result: positive when the side to move wins,
+	// negative when it loses and 0 for a draw. Tables storing distance to
+	// mate may return that instead, which is at least as long.
+	ProbeDTZ(g *game.Game) (dtz int, ok bool)
+}
+
+// probeWDL scores the position from the tablebase, if it is covered. Only
+// positions just after a capture or pawn move are probed, since results
+// ignore the fifty-move counter and castling.
+func (s *Searcher) probeWDL(ply int) (int, bool) {
+	g := s.Game
+	if s.Tablebase == nil || g.HalfMove != 0 || g.CanCastle() || g.PieceCount() > s.Tablebase.MaxPieces() {
+		return 0, false
+	}
+	wdl, ok := s.Tablebase.ProbeWDL(g)
+	if !ok {
+		return 0, false
+	}
+	s.tbHits++
+	switch wdl {
+	case Win:
+		return TBWinScore - ply, true
+	case Loss:
+		return -TBWinScore + ply, true
+	}
+	return 0, true
+}
+
+// tablebaseRoot narrows the root moves down to those which keep the best
+// result, when the root is in the tablebase. Winning moves are cut to those
+// reaching the next capture or pawn move soonest, and losing moves to those
+// delaying it longest, so the search can't stray from a won ending by
+// shuffling between moves that all look winning.
+func (s *Searcher) tablebaseRoot(moves []move.Move) []move.Move {
+	g := s.Game
+	if s.Tablebase == nil || g.CanCastle() || g.PieceCount() > s.Tablebase.MaxPieces() {
+		return moves
+	}
+
+	type ranked struct {
+		move move.Move
+		wdl  WDL
+		dtz  int
+	}
+	var results []ranked
+	for _, m := range moves {
+		g.MakeUnchecked(m)
+		var wdl WDL
+		dtz, ok := 0, false
+		if g.HalfMove == 0 {
+			// After a capture or pawn move the count restarts, so the
+			// result is all there is to know
+			wdl, ok = s.Tablebase.ProbeWDL(g)
+		} else {
+			// Otherwise the result depends on the count, so it comes from
+			// the distance
+			dtz, ok = s.Tablebase.ProbeDTZ(g)
+			switch {
+			case dtz > 0:
+				wdl = Win
+			case dtz < 0 || g.InCheck() && len(g.AllLegalMoves()) == 0:
+				// Distances to mate are 0 when mated
+				wdl = Loss
+			}
+		}
+		halfMove := g.HalfMove
+		g.Unmake()
+		if !ok {
+			return moves
+		}
+		r := ranked{move: m, wdl: -wdl}
+		// Plies from the root to the next zeroing move
+		if dtz < 0 {
+			dtz = -dtz
+		}
+		r.dtz = dtz + 1
+		// Wins and losses that take too long are only draws
+		if r.wdl == Win && halfMove+dtz > 100 {
+			r.wdl = CursedWin
+		} else if r.wdl == Loss && halfMove+dtz > 100 {
+			r.wdl = BlessedLoss
+		}
+		results = append(results, r)
+	}
+	s.tbHits += len(results)
+	if len(results) == 0 {
+		// Mated or stalemated: there's nothing to rank
+		return moves
+	}
+
+	best := results[0]
+	for _, r := range results[1:] {
+		if r.wdl > best.wdl ||
+			r.wdl == best.wdl && r.wdl > Draw && r.dtz < best.dtz ||
+			r.wdl == best.wdl && r.wdl < Draw && r.dtz > best.dtz {
+			best = r
+		}
+	}
+	var kept []move.Move
+	for _, r := range results {
+		if r.wdl == best.wdl && (r.wdl == Draw || r.dtz == best.dtz) {
+			kept = append(kept, r.move)
+		}
+	}
+	return kept
+}
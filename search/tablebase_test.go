@@ -0,0 +1,181 @@
+package search
+
+import (
+	"testing"
+
+	"bareman.net/chess-engine/game"
+	"bareman.net/chess-engine/game/piece"
+)
+
+// fakeTablebase scores positions with the functions it is given
+type fakeTablebase struct {
+	wdl func(g *game.Game) WDL
+	dtz func(g *game.Game) int
+}
+
+func (f fakeTablebase) MaxPieces() int { return 3 }
+
+func (f fakeTablebase) ProbeWDL(g *game.Game) (WDL, bool) {
+	return f.wdl(g), true
+}
+
+func (f fakeTablebase) ProbeDTZ(g *game.Game) (int, bool) {
+	return f.dtz(g), true
+}
+
+// The side with the queen wins
+func queenWins(g *game.Game) WDL {
+	queens := g.Bitboard(piece.Queen | piece.White)
+	if !g.WhiteToMove {
+		queens = g.Bitboard(piece.Queen | piece.Black)
+	}
+	if queens != 0 {
+		return Win
+	}
+	if g.Pieces[piece.Queen] != 0 {
+		return Loss
+	}
+	return Draw
+}
+
+func TestProbeInSearch(t *testing.T) {
+	// Taking the rook leaves a won ending
+	g, err := game.FromFEN("4k3/8/8/3r4/8/8/3Q4/4K3 w - - 0 1")
+	if err != nil {
+		t.Fatalf("Failed to create game: %v\n", err)
+	}
+	var info Info
+	s := New(g, Limits{Depth: 3})
+	s.Tablebase = fakeTablebase{wdl: queenWins, dtz: func(*game.Game) int { return 1 }}
+	s.Table = NewTable(1)
+	s.Report = func(i Info) { info = i }
+	pv := s.Run()
+	if len(pv) == 0 || pv[0].String() != "d2d5" {
+		t.Errorf("Expected d2d5, got %v\n", pv)
+	}
+	if info.Score <= TBWinScore-MaxDepth || info.Score >= MateScore-MaxDepth {
+		t.Errorf("Expected a tablebase win score, got %v\n", info.Score)
+	}
+	if cp := Centipawns(info.Score); cp <= TBWinCentipawns-MaxDepth || cp > TBWinCentipawns {
+		t.Errorf("Expected a tablebase win to be reported as about %v centipawns, got %v\n", TBWinCentipawns, cp)
+	}
+	if cp := Centipawns(-info.Score); cp >= -TBWinCentipawns+MaxDepth || cp < -TBWinCentipawns {
+		t.Errorf("Expected a tablebase loss to be reported as about -%v centipawns, got %v\n", TBWinCentipawns, cp)
+	}
+	if cp := Centipawns(150); cp != 150 {
+		t.Errorf("Expected other scores to be kept, got %v\n", cp)
+	}
+	if info.TBHits == 0 {
+		t.Errorf("Expected tablebase hits to be counted\n")
+	}
+}
+
+func TestTablebaseRoot(t *testing.T) {
+	g, err := game.FromFEN("4k3/8/8/8/8/8/3Q4/4K3 w - - 10 40")
+	if err != nil {
+		t.Fatalf("Failed to create game: %v\n", err)
+	}
+	// Queen moves to the a-file are quickest, except a5 which the fake
+	// calls a draw. Queen moves to the h-file take too long for the
+	// fifty-move rule.
+	dtz := func(g *game.Game) int {
+		queen := g.Bitboard(piece.Queen | piece.White)
+		if queen == 0 {
+			return -50
+		}
+		file := queen.LSB() % 8
+		if queen.LSB() == 32 {
+			return 0
+		}
+		if file == 7 {
+			return -95
+		}
+		return -(file + 5)
+	}
+	s := New(g, Limits{})
+	s.Tablebase = fakeTablebase{wdl: queenWins, dtz: dtz}
+	moves := s.tablebaseRoot(g.AllLegalMoves())
+	if len(moves) == 0 {
+		t.Fatalf("Expected moves to be kept\n")
+	}
+	for _, m := range moves {
+		if m.Origin() != 11 || m.Dest()%8 != 0 || m.Dest() == 32 {
+			t.Errorf("Expected only the fastest winning queen moves to the a-file, got %v\n", m)
+		}
+	}
+
+	// With castling rights the tablebase doesn't apply
+	g.WKCastle = true
+	all := g.AllLegalMoves()
+	if n := len(s.tablebaseRoot(all)); n != len(all) {
+		t.Errorf("Expected no filtering with castling rights, kept %v of %v\n", n, len(all))
+	}
+}
+
+func TestTablebaseRootWithoutMoves(t *testing.T) {
+	// Stalemate, in a position the tablebase covers
+	g, err := game.FromFEN("7k/5Q2/6K1/8/8/8/8/8 b - - 0 1")
+	if err != nil {
+		t.Fatalf("Failed to create game: %v\n", err)
+	}
+	s := New(g, Limits{Depth: 2})
+	s.Tablebase = fakeTablebase{wdl: queenWins, dtz: func(*game.Game) int { return 1 }}
+	if moves := s.tablebaseRoot(nil); len(moves) != 0 {
+		t.Errorf("Expected no moves, got %v\n", moves)
+	}
+	if pv := s.Run(); len(pv) != 0 {
+		t.Errorf("Expected no moves from a stalemate, got %v\n", pv)
+	}
+}
+
+func TestProbeOnlyAfterZeroing(t *testing.T) {
+	// Results ignore the fifty-move counter, so they're only asked for
+	// when it is zero, in the search and at the root
+	var probes, counted int
+	wdl := func(g *game.Game) WDL {
+		probes++
+		if g.HalfMove != 0 {
+			counted++
+		}
+		return queenWins(g)
+	}
+	for _, fen := range []string{
+		"4k3/8/8/3r4/8/8/3Q4/4K3 w - - 7 30",
+		"4k3/8/3r4/8/8/8/8/4K3 w - - 7 30",
+		"4k3/8/8/8/8/8/3Q4/4K3 w - - 7 30",
+	} {
+		g, err := game.FromFEN(fen)
+		if err != nil {
+			t.Fatalf("Failed to create game: %v\n", err)
+		}
+		s := New(g, Limits{Depth: 4})
+		s.Tablebase = fakeTablebase{wdl: wdl, dtz: func(*game.Game) int { return 20 }}
+		s.Run()
+	}
+	if probes == 0 {
+		t.Errorf("Expected positions after captures to be probed\n")
+	}
+	if counted != 0 {
+		t.Errorf("Expected results only after zeroing moves, got %v of %v with a count\n", counted, probes)
+	}
+}
+
+func TestTablebaseRootMate(t *testing.T) {
+	g, err := game.FromFEN("7k/8/6K1/8/8/8/8/1Q6 w - - 5 40")
+	if err != nil {
+		t.Fatalf("Failed to create game: %v\n", err)
+	}
+	// As tables of distance to mate do, mated positions get 0
+	dtz := func(g *game.Game) int {
+		if g.InCheck() && len(g.AllLegalMoves()) == 0 {
+			return 0
+		}
+		return -10
+	}
+	s := New(g, Limits{})
+	s.Tablebase = fakeTablebase{wdl: queenWins, dtz: dtz}
+	moves := s.tablebaseRoot(g.AllLegalMoves())
+	if len(moves) != 1 || moves[0].String() != "b1b8" {
+		t.Errorf("Expected only the mate b1b8, got %v\n", moves)
+	}
+}
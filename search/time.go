@@ -0,0 +1,110 @@
+package search
+
+import (
+	"time"
+
+	"bareman.net/chess-engine/game/move"
+)
+
+const (
+	// Moves assumed to be left in the game when the time control doesn't
+	// say
+	defaultMovesToGo = 30
+	// The hard limit is at most this many times the soft limit, and never
+	// more than this fraction of the clock
+	hardFactor        = 4
+	hardClockFraction = 0.75
+	// Least time given to a move, so a search always completes depth 1
+	minMoveTime = time.Millisecond
+)
+
+// Percentage of the soft limit to use, by how many iterations in a row have
+// agreed on the best move
+var stabilityScale = [...]int{125, 100, 85, 70, 60}
+
+// timeManager decides how long a search may run. The hard limit is checked
+// during the search; the soft limit is only checked between iterations,
+// scaled by how settled the search looks.
+type timeManager struct {
+	// Zero when there is no limit
+	soft, hard time.Duration
+
+	best   move.Move
+	stable int
+	score  int
+	// Percentage of the soft limit allowed after a drop in score
+	extension int
+}
+
+func newTimeManager(l Limits) timeManager {
+	var tm timeManager
+	switch {
+	case l.Infinite:
+	case l.MoveTime > 0:
+		// All of a fixed move time is used
+		tm.hard = atLeast(l.MoveTime-l.Overhead, minMoveTime)
+	case l.Time > 0:
+		available := atLeast(l.Time-l.Overhead, minMoveTime)
+		movesToGo := l.MovesToGo
+		if movesToGo <= 0 {
+			movesToGo = defaultMovesToGo
+		}
+		tm.soft = available/time.Duration(movesToGo) + l.Increment*3/4
+		tm.hard = hardFactor * tm.soft
+		if limit := time.Duration(float64(available) * hardClockFraction); tm.hard > limit {
+			tm.hard = limit
+		}
+		if tm.soft > tm.hard {
+			tm.soft = tm.hard
+		}
+		tm.soft, tm.hard = atLeast(tm.soft, minMoveTime), atLeast(tm.hard, minMoveTime)
+	}
+	return tm
+}
+
+// update records a completed iteration. It returns whether the search
+// should stop now that elapsed time has passed.
+func (tm *timeManager) update(depth int, best move.Move, score int, elapsed time.Duration) bool {
+	if depth > 1 {
+		if best == tm.best {
+			tm.stable++
+		} else {
+			tm.stable = 0
+		}
+		// Give the search longer to find a way out when the score falls,
+		// until it recovers
+		switch drop := tm.score - score; {
+		case drop >= 100:
+			tm.extension = 200
+		case drop >= 30:
+			if tm.extension < 150 {
+				tm.extension = 150
+			}
+		case drop <= 0:
+			tm.extension = 100
+		}
+	} else {
+		tm.extension = 100
+	}
+	tm.best, tm.score = best, score
+
+	if tm.soft == 0 {
+		return false
+	}
+	stable := tm.stable
+	if stable >= len(stabilityScale) {
+		stable = len(stabilityScale) - 1
+	}
+	soft := tm.soft * time.Duration(stabilityScale[stable]*tm.extension) / 10_000
+	if soft > tm.hard {
+		soft = tm.hard
+	}
+	return elapsed >= soft
+}
+
+func atLeast(d, min time.Duration) time.Duration {
+	if d < min {
+		return min
+	}
+	return d
+}
@@ -0,0 +1,66 @@
+package search
+
+import (
+	"testing"
+	"time"
+
+	"bareman.net/chess-engine/game"
+	"bareman.net/chess-engine/game/move"
+)
+
+func TestTimeBudget(t *testing.T) {
+	tests := []struct {
+		limits     Limits
+		soft, hard time.Duration
+	}{
+		{Limits{Infinite: true, Time: time.Minute}, 0, 0},
+		{Limits{MoveTime: time.Second, Overhead: 50 * time.Millisecond}, 0, 950 * time.Millisecond},
+		{Limits{Time: 30 * time.Second}, time.Second, 4 * time.Second},
+		{Limits{Time: 30 * time.Second, Increment: 2 * time.Second}, 2500 * time.Millisecond, 10 * time.Second},
+		{Limits{Time: 40 * time.Second, MovesToGo: 10}, 4 * time.Second, 16 * time.Second},
+		// The last move before the time control mustn't use the whole clock
+		{Limits{Time: 4 * time.Second, MovesToGo: 1}, 3 * time.Second, 3 * time.Second},
+		{Limits{Time: 100 * time.Millisecond, Overhead: time.Second}, minMoveTime, minMoveTime},
+	}
+	for _, test := range tests {
+		tm := newTimeManager(test.limits)
+		if tm.soft != test.soft || tm.hard != test.hard {
+			t.Errorf("%+v: expected soft %v and hard %v, got %v and %v\n",
+				test.limits, test.soft, test.hard, tm.soft, tm.hard)
+		}
+	}
+}
+
+func TestTimeStability(t *testing.T) {
+	a, b := move.New(12, 28, 0, 0), move.New(11, 27, 0, 0)
+	tm := newTimeManager(Limits{Time: 30 * time.Second})
+	tm.update(1, a, 20, 0)
+
+	// A best move that keeps changing is given more than the soft limit
+	if tm.update(2, b, 20, 1100*time.Millisecond) {
+		t.Errorf("Expected an unstable search to continue past the soft limit\n")
+	}
+	// One that has settled is given less
+	for depth := 3; depth < 7; depth++ {
+		tm.update(depth, b, 20, 0)
+	}
+	if !tm.update(7, b, 20, 700*time.Millisecond) {
+		t.Errorf("Expected a stable search to stop before the soft limit\n")
+	}
+	// Unless the score has dropped
+	if tm.update(8, b, -100, 700*time.Millisecond) {
+		t.Errorf("Expected a falling score to extend the search\n")
+	}
+}
+
+func TestSearchUsesClock(t *testing.T) {
+	g := game.Default()
+	s := New(g, Limits{Time: 500 * time.Millisecond, Increment: 0})
+	start := time.Now()
+	if pv := s.Run(); len(pv) == 0 {
+		t.Fatalf("Expected a move\n")
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond*3/4+50*time.Millisecond {
+		t.Errorf("Search took %v, longer than the hard limit\n", elapsed)
+	}
+}
@@ -0,0 +1,231 @@
+package search
+
+import (
+	"math/bits"
+	"sync/atomic"
+	"unsafe"
+
+	"bareman.net/chess-engine/game/move"
+)
+
+// Bound describes how a stored score relates to the true score of a position
+type Bound uint8
+
+const (
+	// Unused entries have no bound
+	BoundNone Bound = iota
+	// The score is exact
+	BoundExact
+	// The search failed high, so the true score is at least the stored score
+	BoundLower
+	// The search failed low, so the true score is at most the stored score
+	BoundUpper
+)
+
+const (
+	DefaultHashSize = 1
+	MinHashSize     = 1
+	MaxHashSize     = 128
+
+	bucketSize = 4
+)
+
+type ttEntry struct {
+	move  move.Move
+	score int32
+	depth int8
+	bound Bound
+	age   uint8
+}
+
+// Entries are packed into 64 bits: the move, then an 18 bit score, 7 bit
+// depth, 2 bit bound and 5 bit age
+const (
+	scoreShift = 32
+	depthShift = scoreShift + 18
+	boundShift = depthShift + 7
+	ageShift   = boundShift + 2
+
+	scoreMask = 1<<18 - 1
+	depthMask = 1<<7 - 1
+	boundMask = 1<<2 - 1
+	ageMask   = 1<<5 - 1
+)
+
+func (e ttEntry) pack() uint64 {
+	return uint64(e.move) |
+		uint64(e.score)&scoreMask<<scoreShift |
+		uint64(e.depth)&depthMask<<depthShift |
+		uint64(e.bound)&boundMask<<boundShift |
+		uint64(e.age)&ageMask<<ageShift
+}
+
+func unpack(data uint64) ttEntry {
+	return ttEntry{
+		move: move.Move(data),
+		// Shifted up then down again to extend the sign
+		score: int32(uint32(data>>scoreShift)<<(32-18)) >> (32 - 18),
+		depth: int8(data >> depthShift & depthMask),
+		bound: Bound(data >> boundShift & boundMask),
+		age:   uint8(data >> ageShift & ageMask),
+	}
+}
+
+// slot holds a packed entry in data, and the hash of its position xored with
+// data in check. Searches share the table without locks: a slot torn by two
+// threads writing at once fails the check, so reads as a miss.
+type slot struct {
+	check uint64
+	data  uint64
+}
+
+func (s *slot) load() (hash uint64, e ttEntry) {
+	check, data := atomic.LoadUint64(&s.check), atomic.LoadUint64(&s.data)
+	return check ^ data, unpack(data)
+}
+
+func (s *slot) save(hash uint64, e ttEntry) {
+	data := e.pack()
+	atomic.StoreUint64(&s.check, hash^data)
+	atomic.StoreUint64(&s.data, data)
+}
+
+// Entries are grouped into buckets which fit a cache line
+type bucket [bucketSize]slot
+
+// Table is a transposition table of fixed size, keyed by Game.Hash. A new
+// entry replaces the shallowest or oldest entry in its bucket. Any number of
+// searches may use a table at once.
+type Table struct {
+	buckets []bucket
+	// Incremented for every search, so entries from earlier searches are
+	// replaced first. Only the low bits are stored in entries.
+	age uint8
+}
+
+// NewTable creates a table using about mb megabytes of memory
+func NewTable(mb int) *Table {
+	t := &Table{}
+	t.Resize(mb)
+	return t
+}
+
+// Resize changes the size of the table to about mb megabytes. The contents
+// are lost.
+func (t *Table) Resize(mb int) {
+	if mb < MinHashSize {
+		mb = MinHashSize
+	}
+	n := mb << 20 / int(unsafe.Sizeof(bucket{}))
+	t.buckets = make([]bucket, n)
+	t.age = 0
+}
+
+// Clear empties the table
+func (t *Table) Clear() {
+	for i := range t.buckets {
+		t.buckets[i] = bucket{}
+	}
+	t.age = 0
+}
+
+// NewSearch ages the table, marking current entries as left over from an
+// earlier search
+func (t *Table) NewSearch() {
+	t.age = (t.age + 1) & ageMask
+}
+
+// Hashfull returns how full the table is in permille, counting only entries
+// from the current search
+func (t *Table) Hashfull() int {
+	n := 1000 / bucketSize
+	if n > len(t.buckets) {
+		n = len(t.buckets)
+	}
+	used := 0
+	for i := range t.buckets[:n] {
+		for j := range t.buckets[i] {
+			if _, e := t.buckets[i][j].load(); e.bound != BoundNone && e.age == t.age {
+				used++
+			}
+		}
+	}
+	return used * 1000 / (n * bucketSize)
+}
+
+func (t *Table) bucket(hash uint64) *bucket {
+	i, _ := bits.Mul64(hash, uint64(len(t.buckets)))
+	return &t.buckets[i]
+}
+
+// probe looks up the position with the given hash. Mate scores are stored
+// relative to the position, so are adjusted back to the distance from the
+// root using ply.
+func (t *Table) probe(hash uint64, ply int) (ttEntry, bool) {
+	b := t.bucket(hash)
+	for i := range b {
+		if key, e := b[i].load(); key == hash && e.bound != BoundNone {
+			e.score = int32(scoreFromTable(int(e.score), ply))
+			return e, true
+		}
+	}
+	return ttEntry{}, false
+}
+
+func (t *Table) store(hash uint64, depth int, bound Bound, score int, m move.Move, ply int) {
+	b := t.bucket(hash)
+
+	replace := &b[0]
+	_, old := replace.load()
+	for i := range b {
+		key, e := b[i].load()
+		if key == hash || e.bound == BoundNone {
+			replace, old = &b[i], e
+			break
+		}
+		if replaceValue(e, t.age) < replaceValue(old, t.age) {
+			replace, old = &b[i], e
+		}
+	}
+
+	// Keep the best move of an earlier search of the same position
+	if key, _ := replace.load(); m == move.Null && key == hash {
+		m = old.move
+	}
+	replace.save(hash, ttEntry{
+		move:  m,
+		score: int32(scoreToTable(score, ply)),
+		depth: int8(depth),
+		bound: bound,
+		age:   t.age,
+	})
+}
+
+// Entries with the lowest value are replaced first: shallow searches, and
+// those from earlier searches
+func replaceValue(e ttEntry, age uint8) int {
+	return int(e.depth) - 8*int((age-e.age)&ageMask)
+}
+
+// Mate and tablebase scores count plies from the root, but a position can be
+// reached at different plies, so they are stored as the distance from the
+// position
+func scoreToTable(score, ply int) int {
+	if score > TBWinScore-MaxDepth {
+		return score + ply
+	}
+	if score < -TBWinScore+MaxDepth {
+		return score - ply
+	}
+	return score
+}
+
+func scoreFromTable(score, ply int) int {
+	if score > TBWinScore-MaxDepth {
+		return score - ply
+	}
+	if score < -TBWinScore+MaxDepth {
+		return score + ply
+	}
+	return score
+}
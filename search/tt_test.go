@@ -0,0 +1,110 @@
+package search
+
+import (
+	"testing"
+
+	"bareman.net/chess-engine/game"
+	"bareman.net/chess-engine/game/move"
+)
+
+func TestTableStoreProbe(t *testing.T) {
+	table := NewTable(1)
+	m := move.New(12, 28, 0, 0)
+	table.store(0xdeadbeef, 5, BoundLower, 120, m, 3)
+
+	e, ok := table.probe(0xdeadbeef, 7)
+	if !ok || e.move != m || e.depth != 5 || e.bound != BoundLower || e.score != 120 {
+		t.Errorf("Unexpected entry %+v\n", e)
+	}
+	if _, ok := table.probe(0xfeedbeef, 0); ok {
+		t.Errorf("Expected a miss for a different hash\n")
+	}
+
+	// Mate in 2 plies from the position, found 3 plies from the root
+	table.store(0xdeadbeef, 5, BoundExact, MateScore-5, m, 3)
+	if e, _ := table.probe(0xdeadbeef, 1); e.score != MateScore-3 {
+		t.Errorf("Expected mate score adjusted to %v, got %v\n", MateScore-3, e.score)
+	}
+	table.store(0xdeadbeef, 5, BoundExact, -MateScore+5, move.Null, 3)
+	e, _ = table.probe(0xdeadbeef, 1)
+	if e.score != -MateScore+3 {
+		t.Errorf("Expected mated score adjusted to %v, got %v\n", -MateScore+3, e.score)
+	}
+	if e.move != m {
+		t.Errorf("Expected the best move to be kept, got %v\n", e.move)
+	}
+
+	table.Clear()
+	if _, ok := table.probe(0xdeadbeef, 0); ok {
+		t.Errorf("Expected a miss after clearing\n")
+	}
+}
+
+func TestTableReplacement(t *testing.T) {
+	table := NewTable(1)
+	table.buckets = table.buckets[:1]
+	for i := 0; i < bucketSize; i++ {
+		table.store(uint64(i), 10-i, BoundExact, 0, move.Null, 0)
+	}
+	table.store(100, 1, BoundExact, 0, move.Null, 0)
+	if _, ok := table.probe(bucketSize-1, 0); ok {
+		t.Errorf("Expected the shallowest entry to be replaced\n")
+	}
+
+	// Old entries go before shallow ones from the current search
+	table.NewSearch()
+	table.store(100, 1, BoundExact, 0, move.Null, 0)
+	table.store(200, 1, BoundExact, 0, move.Null, 0)
+	if _, ok := table.probe(2, 0); ok {
+		t.Errorf("Expected an old entry to be replaced\n")
+	}
+	if _, ok := table.probe(100, 0); !ok {
+		t.Errorf("Expected the entry from the current search to be kept\n")
+	}
+}
+
+func TestHashfull(t *testing.T) {
+	table := NewTable(1)
+	if n := table.Hashfull(); n != 0 {
+		t.Errorf("Expected an empty table, got %v\n", n)
+	}
+	s := New(game.Default(), Limits{Depth: 5})
+	s.Table = table
+	s.Run()
+	if n := table.Hashfull(); n == 0 {
+		t.Errorf("Expected entries after searching\n")
+	}
+	table.NewSearch()
+	if n := table.Hashfull(); n != 0 {
+		t.Errorf("Expected entries from an earlier search not to count, got %v\n", n)
+	}
+}
+
+func TestTableSearch(t *testing.T) {
+	// The same results are expected with and without a table
+	fens := []string{
+		"4k3/8/8/3q4/8/8/3R4/4K3 w - - 0 1",
+		"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1",
+		"8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 1",
+	}
+	for _, fen := range fens {
+		g, err := game.FromFEN(fen)
+		if err != nil {
+			t.Fatalf("Failed to create game: %v\n", err)
+		}
+		var plain, cached Info
+		s := New(g, Limits{Depth: 4})
+		s.Report = func(info Info) { plain = info }
+		s.Run()
+		s = New(g, Limits{Depth: 4})
+		s.Table = NewTable(1)
+		s.Report = func(info Info) { cached = info }
+		s.Run()
+		if plain.Score != cached.Score || plain.PV[0] != cached.PV[0] {
+			t.Errorf("%v: expected %v %v, got %v %v\n", fen, plain.PV[0], plain.Score, cached.PV[0], cached.Score)
+		}
+		if cached.Nodes >= plain.Nodes {
+			t.Errorf("%v: expected fewer nodes with a table, got %v and %v\n", fen, cached.Nodes, plain.Nodes)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package syzygy_test
+
+import (
+	"flag"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"bareman.net/chess-engine/game"
+	"bareman.net/chess-engine/game/piece"
+	"bareman.net/chess-engine/search"
+	"bareman.net/chess-engine/syzygy"
+	"bareman.net/chess-engine/tablebase"
+)
+
+var update = flag.Bool("update", false, "rewrite the tables in testdata from distance-to-mate tables")
+
+// Endings of the tables in testdata, and those with DTZ tables too: their
+// distances to mate are the distances to zeroing, as the winning side has
+// nothing to capture and no pawns
+var (
+	testdataWDL = []string{"KQvK", "KRvK", "KBvK", "KNvK", "KPvK", "KBNvK", "KNNvK"}
+	testdataDTZ = []string{"KQvK", "KRvK"}
+)
+
+// generate builds the distance-to-mate tables of materials, and those they
+// need
+func generate(t *testing.T, materials ...string) *tablebase.Tablebase {
+	dtm := tablebase.New()
+	for _, material := range materials {
+		if err := dtm.Generate(material); err != nil {
+			t.Fatalf("Failed to generate %v: %v\n", material, err)
+		}
+	}
+	return dtm
+}
+
+func writeTable(t *testing.T, path string, write func(io.Writer) error) {
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("Failed to create %v: %v\n", path, err)
+	}
+	defer f.Close()
+	if err := write(f); err != nil {
+		t.Fatalf("Failed to write %v: %v\n", path, err)
+	}
+}
+
+func TestUpdateTestdata(t *testing.T) {
+	if !*update {
+		t.Skip("Tables are only rewritten with -update")
+	}
+	dtm := generate(t, testdataWDL...)
+	for _, material := range testdataWDL {
+		writeTable(t, filepath.Join(testdata, material+".rtbw"), func(w io.Writer) error {
+			return syzygy.WriteWDL(w, material, func(g *game.Game) search.WDL {
+				wdl, _ := dtm.ProbeWDL(g)
+				return wdl
+			})
+		})
+	}
+	for _, material := range testdataDTZ {
+		writeTable(t, filepath.Join(testdata, material+".rtbz"), func(w io.Writer) error {
+			return syzygy.WriteDTZ(w, material, func(g *game.Game) int {
+				dtz, _ := dtm.ProbeDTZ(g)
+				return dtz
+			})
+		})
+	}
+}
+
+// checkDTM sets up n random placements of pieces and checks the results
+// in tb against distances to mate. With exact, DTZs must equal them.
+func checkDTM(t *testing.T, tb *syzygy.Tablebase, dtm *tablebase.Tablebase, r *rand.Rand, n int, exact bool, pieces ...piece.Piece) {
+	for checked := 0; checked < n; {
+		g := randomPosition(r, pieces)
+		if g == nil {
+			continue
+		}
+		checked++
+		wdl, plies, _ := dtm.DTM(g)
+		if got, ok := tb.ProbeWDL(g); !ok || got != wdl {
+			t.Errorf("Expected %v for %v, got %v (%v)\n", wdl, g.ToFEN(), got, ok)
+			continue
+		}
+		dtz, ok := tb.ProbeDTZ(g)
+		if !ok {
+			continue
+		}
+		want := plies
+		switch {
+		case wdl == search.Draw:
+			want = 0
+		case plies == 0:
+			// Mated
+			want = -1
+		case wdl == search.Loss:
+			want = -plies
+		}
+		switch {
+		case exact && dtz != want:
+			t.Errorf("Expected a DTZ of %v for %v, got %v\n", want, g.ToFEN(), dtz)
+		// The count is zeroed no later than mate, give or take the ply
+		// lost when tables store whole moves
+		case (dtz > 0) != (want > 0) || (dtz < 0) != (want < 0) || abs(dtz) > abs(want)+1:
+			t.Errorf("Expected a DTZ within %v for %v, got %v\n", want, g.ToFEN(), dtz)
+		}
+	}
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+func TestTestdataMatchesDTM(t *testing.T) {
+	tb := openTestdata(t)
+	r := rand.New(rand.NewSource(1))
+	dtm := generate(t, "KQvK", "KRvK", "KPvK")
+	checkDTM(t, tb, dtm, r, 2000, true, wk, piece.Queen|piece.White, bk)
+	checkDTM(t, tb, dtm, r, 2000, true, wk, piece.Rook|piece.White, bk)
+	// The stronger side in black
+	checkDTM(t, tb, dtm, r, 2000, true, wk, piece.Queen|piece.Black, bk)
+	checkDTM(t, tb, dtm, r, 2000, true, wk, piece.Rook|piece.Black, bk)
+	checkDTM(t, tb, dtm, r, 2000, false, wk, piece.Pawn|piece.White, bk)
+	checkDTM(t, tb, dtm, r, 2000, false, wk, piece.Pawn|piece.Black, bk)
+
+	if testing.Short() {
+		return
+	}
+	dtm = generate(t, "KBNvK", "KNNvK")
+	checkDTM(t, tb, dtm, r, 1000, true, wk, piece.Bishop|piece.White, piece.Knight|piece.White, bk)
+	checkDTM(t, tb, dtm, r, 1000, true, wk, bk, piece.Knight|piece.Black, piece.Knight|piece.Black)
+}
+
+// TestSyzygyPathMatchesDTM checks the tables in $SYZYGY_PATH, as published
+// by the Syzygy generator, against distances to mate
+func TestSyzygyPathMatchesDTM(t *testing.T) {
+	path := os.Getenv("SYZYGY_PATH")
+	if path == "" {
+		t.Skip("SYZYGY_PATH isn't set")
+	}
+	tb, err := syzygy.Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open tables: %v\n", err)
+	}
+	r := rand.New(rand.NewSource(1))
+	dtm := generate(t, "KQvK", "KRvK", "KPvK", "KRvKN", "KRvKP")
+	checkDTM(t, tb, dtm, r, 1000, false, wk, piece.Queen|piece.White, bk)
+	checkDTM(t, tb, dtm, r, 1000, false, wk, piece.Rook|piece.Black, bk)
+	checkDTM(t, tb, dtm, r, 1000, false, wk, piece.Pawn|piece.White, bk)
+	checkDTM(t, tb, dtm, r, 1000, false, wk, piece.Rook|piece.White, bk, piece.Knight|piece.Black)
+	checkDTM(t, tb, dtm, r, 1000, false, wk, piece.Rook|piece.White, bk, piece.Pawn|piece.Black)
+}
@@ -0,0 +1,288 @@
+package syzygy
+
+import (
+	"sort"
+
+	"bareman.net/chess-engine/game"
+	"bareman.net/chess-engine/game/bitboard"
+	"bareman.net/chess-engine/game/piece"
+)
+
+// Most pieces, kings included, of a table
+const maxPieces = 7
+
+// Tables for the index of a position, filled in by init
+var (
+	// Squares below the a1-h8 diagonal numbered 0 to 27
+	mapB1H1H7 [64]int
+	// Squares of the a1-d1-d4 triangle numbered 0 to 9, the diagonal last
+	mapA1D1D4 [64]int
+	// The 462 legal placements of two kings, the first in the a1-d1-d4
+	// triangle, by the first's mapA1D1D4 number and the second's square
+	mapKK [10][64]int
+	// binomial[k][n] ways of choosing k of n things
+	binomial [6][64]uint64
+	// Pawn squares numbered so that the lead pawn, nearest the edge and
+	// then the lowest rank, has the highest number
+	mapPawns [64]int
+	// Index of the lead pawn's square, by the number of lead pawns
+	leadPawnIdx [6][64]uint64
+	// Number of placements of the lead pawns, by their number and the lead
+	// pawn's file
+	leadPawnsSize [6][4]uint64
+)
+
+// offDiagonal is positive above the a1-h8 diagonal and negative below
+func offDiagonal(sq int) int {
+	return sq>>3 - sq&7
+}
+
+func flipDiagonal(sq int) int {
+	return (sq>>3 | sq<<3) & 63
+}
+
+func init() {
+	code := 0
+	for sq := 0; sq < 64; sq++ {
+		if offDiagonal(sq) < 0 {
+			mapB1H1H7[sq] = code
+			code++
+		}
+	}
+
+	code = 0
+	for sq := 0; sq < 28; sq++ {
+		if offDiagonal(sq) < 0 && sq&7 <= 3 {
+			mapA1D1D4[sq] = code
+			code++
+		}
+	}
+	for sq := 0; sq < 28; sq++ {
+		if offDiagonal(sq) == 0 && sq&7 <= 3 {
+			mapA1D1D4[sq] = code
+			code++
+		}
+	}
+
+	// With the first king on the diagonal the second can't be above it.
+	// Placements with both on the diagonal come last.
+	var bothOnDiagonal [][2]int
+	code = 0
+	for idx := 0; idx < 10; idx++ {
+		for first := 0; first < 28; first++ {
+			if mapA1D1D4[first] != idx || idx == 0 && first != 1 {
+				continue
+			}
+			for second := 0; second < 64; second++ {
+				switch {
+				case (bitboard.KingAttacks(first) | bitboard.FromSquare(first)).Has(second):
+				case offDiagonal(first) == 0 && offDiagonal(second) > 0:
+				case offDiagonal(first) == 0 && offDiagonal(second) == 0:
+					bothOnDiagonal = append(bothOnDiagonal, [2]int{idx, second})
+				default:
+					mapKK[idx][second] = code
+					code++
+				}
+			}
+		}
+	}
+	for _, p := range bothOnDiagonal {
+		mapKK[p[0]][p[1]] = code
+		code++
+	}
+
+	binomial[0][0] = 1
+	for n := 1; n < 64; n++ {
+		for k := 0; k < 6 && k <= n; k++ {
+			if k > 0 {
+				binomial[k][n] += binomial[k-1][n-1]
+			}
+			if k < n {
+				binomial[k][n] += binomial[k][n-1]
+			}
+		}
+	}
+
+	// A lead pawn on a2 leaves 47 squares for other pawns, and each rank
+	// further up two less, as they can't be below it on either edge file
+	available := 47
+	for leadPawns := 1; leadPawns <= 5; leadPawns++ {
+		for file := 0; file < 4; file++ {
+			idx := uint64(0)
+			for rank := 1; rank < 7; rank++ {
+				sq := rank<<3 | file
+				if leadPawns == 1 {
+					mapPawns[sq] = available
+					mapPawns[sq^7] = available - 1
+					available -= 2
+				}
+				leadPawnIdx[leadPawns][sq] = idx
+				idx += binomial[leadPawns-1][mapPawns[sq]]
+			}
+			leadPawnsSize[leadPawns][file] = idx
+		}
+	}
+}
+
+// index finds the part of t holding the position in g and its index
+// there. flip is set when black has the side named first. ok is false when
+// t only holds positions with the other side to move, as DTZ tables may.
+func (t *table) index(g *game.Game, flip bool) (d *pairs, idx uint64, ok bool) {
+	// Tables of equal sides only hold positions with white to move
+	if t.symmetric && !g.WhiteToMove {
+		flip = true
+	}
+	var flipColor piece.Piece
+	flipSquares := 0
+	if flip {
+		flipColor, flipSquares = piece.ColorMask, 56
+	}
+	stm := 0
+	if g.WhiteToMove == flip {
+		stm = 1
+	}
+
+	var squares [maxPieces]int
+	var pieces [maxPieces]piece.Piece
+	n, leadPawnsCount, file := 0, 0, 0
+	var leadPawns bitboard.Bitboard
+	if t.pawns {
+		// Lead pawns come first in every part of the table
+		p := t.pairs[0][0].pieces[0] ^ flipColor
+		leadPawns = g.Bitboard(p)
+		for b := leadPawns; b != 0; n++ {
+			squares[n] = b.PopLSB() ^ flipSquares
+		}
+		leadPawnsCount = n
+		for i := 1; i < n; i++ {
+			if mapPawns[squares[i]] > mapPawns[squares[0]] {
+				squares[0], squares[i] = squares[i], squares[0]
+			}
+		}
+		file = squares[0] & 7
+		if file > 3 {
+			file = 7 - file
+		}
+	}
+
+	if t.dtz && int(t.pairs[0][file].flags&flagSTM) != stm && (!t.symmetric || t.pawns) {
+		return nil, 0, false
+	}
+
+	for b := g.Occupied() &^ leadPawns; b != 0; n++ {
+		sq := b.PopLSB()
+		squares[n] = sq ^ flipSquares
+		pieces[n] = g.Board[sq] ^ flipColor
+	}
+
+	d = t.pairs[stm%t.sides()][file]
+
+	// Put the pieces in the table's order
+	for i := leadPawnsCount; i < n-1; i++ {
+		for j := i + 1; j < n; j++ {
+			if d.pieces[i] == pieces[j] {
+				pieces[i], pieces[j] = pieces[j], pieces[i]
+				squares[i], squares[j] = squares[j], squares[i]
+				break
+			}
+		}
+	}
+
+	// Reflect the lead piece onto files a to d, then without pawns onto
+	// ranks 1 to 4 and below the diagonal
+	if squares[0]&7 > 3 {
+		for i := range squares[:n] {
+			squares[i] ^= 7
+		}
+	}
+
+	if t.pawns {
+		idx = leadPawnIdx[leadPawnsCount][squares[0]]
+		rest := squares[1:leadPawnsCount]
+		sort.SliceStable(rest, func(i, j int) bool { return mapPawns[rest[i]] < mapPawns[rest[j]] })
+		for i := 1; i < leadPawnsCount; i++ {
+			idx += binomial[i][mapPawns[squares[i]]]
+		}
+	} else {
+		if squares[0]>>3 > 3 {
+			for i := range squares[:n] {
+				squares[i] ^= 56
+			}
+		}
+		for i := 0; i < d.groupLen[0]; i++ {
+			if offDiagonal(squares[i]) == 0 {
+				continue
+			}
+			if offDiagonal(squares[i]) > 0 {
+				for j := i; j < n; j++ {
+					squares[j] = flipDiagonal(squares[j])
+				}
+			}
+			break
+		}
+		idx = leadIndex(squares[:n], t.uniquePieces)
+	}
+
+	idx *= d.groupIdx[0]
+	// Later groups of pieces are placed on the squares left, in ascending
+	// order. Other pawns can only be on 48 squares.
+	remainingPawns := t.pawns && t.pawnCount[1] > 0
+	start := d.groupLen[0]
+	for next := 1; d.groupLen[next] != 0; next++ {
+		group := squares[start : start+d.groupLen[next]]
+		sort.Ints(group)
+		var n uint64
+		for i, sq := range group {
+			adjust := 0
+			for _, before := range squares[:start] {
+				if sq > before {
+					adjust++
+				}
+			}
+			if remainingPawns {
+				adjust += 8
+			}
+			n += binomial[i+1][sq-adjust]
+		}
+		remainingPawns = false
+		idx += n * d.groupIdx[next]
+		start += d.groupLen[next]
+	}
+	return d, idx, true
+}
+
+// leadIndex returns the index of the leading group of a table without
+// pawns: three unique pieces, or just the kings
+func leadIndex(squares []int, uniquePieces bool) uint64 {
+	if !uniquePieces {
+		return uint64(mapKK[mapA1D1D4[squares[0]]][squares[1]])
+	}
+
+	adjust1, adjust2 := 0, 0
+	if squares[1] > squares[0] {
+		adjust1++
+	}
+	if squares[2] > squares[0] {
+		adjust2++
+	}
+	if squares[2] > squares[1] {
+		adjust2++
+	}
+	rank0, rank1, rank2 := squares[0]>>3, squares[1]>>3, squares[2]>>3
+	var idx int
+	switch {
+	case offDiagonal(squares[0]) != 0:
+		// The first below the diagonal, on 6 squares
+		idx = (mapA1D1D4[squares[0]]*63+squares[1]-adjust1)*62 + squares[2] - adjust2
+	case offDiagonal(squares[1]) != 0:
+		// The first on the diagonal and the second below it
+		idx = (6*63+rank0*28+mapB1H1H7[squares[1]])*62 + squares[2] - adjust2
+	case offDiagonal(squares[2]) != 0:
+		// The first two on the diagonal and the third below it
+		idx = 6*63*62 + 4*28*62 + rank0*7*28 + (rank1-adjust1)*28 + mapB1H1H7[squares[2]]
+	default:
+		// All three on the diagonal
+		idx = 6*63*62 + 4*28*62 + 4*7*28 + rank0*7*6 + (rank1-adjust1)*6 + rank2 - adjust2
+	}
+	return uint64(idx)
+}
@@ -0,0 +1,190 @@
+package syzygy
+
+import (
+	"bareman.net/chess-engine/game"
+	"bareman.net/chess-engine/game/move"
+	"bareman.net/chess-engine/game/piece"
+	"bareman.net/chess-engine/search"
+)
+
+// ProbeWDL returns the result of the position in g for the side to move,
+// assuming the fifty-move counter is zero. ok is false if the position or
+// one it can capture into isn't covered.
+func (t *Tablebase) ProbeWDL(g *game.Game) (search.WDL, bool) {
+	if g.CanCastle() || g.PieceCount() > t.maxPieces {
+		return search.Draw, false
+	}
+	wdl, _, ok := t.searchCaptures(g, false)
+	return wdl, ok
+}
+
+// ProbeDTZ returns the number of plies to the next capture or pawn move
+// with the best play for the result, positive when the side to move wins
+// and negative when it loses. Wins and losses the fifty-move rule turns
+// into draws are over 100 plies. A mated position gives -1.
+func (t *Tablebase) ProbeDTZ(g *game.Game) (int, bool) {
+	if g.CanCastle() || g.PieceCount() > t.maxPieces {
+		return 0, false
+	}
+	return t.probeDTZ(g)
+}
+
+func (t *Tablebase) probeDTZ(g *game.Game) (int, bool) {
+	wdl, zeroing, ok := t.searchCaptures(g, true)
+	if !ok || wdl == search.Draw {
+		return 0, ok
+	}
+	// Tables may hold any value when the best move zeroes the count
+	if zeroing {
+		return beforeZeroing(wdl), true
+	}
+	dtz, stored, ok := t.probeTable(t.dtz, g, wdl)
+	if !ok {
+		return 0, false
+	}
+	if stored {
+		if wdl == search.CursedWin || wdl == search.BlessedLoss {
+			dtz += 100
+		}
+		if wdl < search.Draw {
+			dtz = -dtz
+		}
+		return dtz, true
+	}
+
+	// The table only holds the other side to move, so take the best move
+	// from the positions after each
+	best := 0
+	var list move.List
+	g.LegalMoves(&list)
+	for _, m := range list.Slice() {
+		zeroing := m.IsCapture() || g.Board[m.Origin()].Type() == piece.Pawn
+		g.MakeUnchecked(m)
+		var dtz int
+		if zeroing {
+			// The count restarts, so only the result matters
+			next, _, ok := t.searchCaptures(g, false)
+			if !ok {
+				g.Unmake()
+				return 0, false
+			}
+			dtz = -beforeZeroing(next)
+		} else {
+			next, ok := t.probeDTZ(g)
+			if !ok {
+				g.Unmake()
+				return 0, false
+			}
+			dtz = -next
+			if dtz == 1 && g.InCheck() && len(g.AllLegalMoves()) == 0 {
+				// Mate
+				g.Unmake()
+				return 1, true
+			}
+			if dtz > 0 {
+				dtz++
+			} else if dtz < 0 {
+				dtz--
+			}
+		}
+		g.Unmake()
+		if (dtz > 0) == (wdl > search.Draw) && dtz != 0 && (best == 0 || dtz < best) {
+			best = dtz
+		}
+	}
+	if best == 0 {
+		// Mated
+		return -1, true
+	}
+	return best, true
+}
+
+// beforeZeroing returns the DTZ of a position whose best move zeroes the
+// count and reaches result wdl
+func beforeZeroing(wdl search.WDL) int {
+	switch wdl {
+	case search.Win:
+		return 1
+	case search.CursedWin:
+		return 101
+	case search.BlessedLoss:
+		return -101
+	case search.Loss:
+		return -1
+	}
+	return 0
+}
+
+// searchCaptures returns the result of the position in g, trying captures
+// before the table as it may hold any value when a capture is best. With
+// pawnMoves, pawn moves are tried too. zeroing is set if the result comes
+// from one of those moves, or every move is one.
+func (t *Tablebase) searchCaptures(g *game.Game, pawnMoves bool) (wdl search.WDL, zeroing bool, ok bool) {
+	best := search.Loss
+	var list move.List
+	g.LegalMoves(&list)
+	searched := 0
+	for _, m := range list.Slice() {
+		if !m.IsCapture() && (!pawnMoves || g.Board[m.Origin()].Type() != piece.Pawn) {
+			continue
+		}
+		searched++
+		g.MakeUnchecked(m)
+		next, _, ok := t.searchCaptures(g, false)
+		g.Unmake()
+		if !ok {
+			return search.Draw, false, false
+		}
+		if -next > best {
+			best = -next
+			if best == search.Win {
+				return best, true, true
+			}
+		}
+	}
+
+	// Tables don't know about en passant, so with only captures to play
+	// their value could be wrong
+	if searched > 0 && searched == list.Len() {
+		return best, true, true
+	}
+	value, _, ok := t.probeTable(t.wdl, g, search.Draw)
+	if !ok {
+		return search.Draw, false, false
+	}
+	wdl = search.WDL(value)
+	if best >= wdl {
+		return best, best > search.Draw, true
+	}
+	return wdl, false, true
+}
+
+// probeTable looks up the position in g in the WDL or DTZ tables in files.
+// DTZ values need the position's result wdl, and are in plies. stored is
+// false if the table only holds the other side to move.
+func (t *Tablebase) probeTable(files map[string]*file, g *game.Game, wdl search.WDL) (value int, stored bool, ok bool) {
+	if g.PieceCount() == 2 {
+		// King against king
+		return 0, true, true
+	}
+	name, flip, ok := t.find(files, g)
+	if !ok {
+		return 0, false, false
+	}
+	tb, err := files[name].load()
+	if err != nil {
+		return 0, false, false
+	}
+	d, idx, stored := tb.index(g, flip)
+	if !stored {
+		return 0, false, true
+	}
+	value, err = d.value(idx)
+	if err != nil {
+		return 0, false, false
+	}
+	if tb.dtz {
+		return tb.dtzValue(d, value, wdl), true, true
+	}
+	return value - 2, true, true
+}
@@ -0,0 +1,303 @@
+package syzygy_test
+
+import (
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"bareman.net/chess-engine/game"
+	"bareman.net/chess-engine/game/piece"
+	"bareman.net/chess-engine/search"
+	"bareman.net/chess-engine/syzygy"
+)
+
+// The tables in testdata are the WDL tables of the 3 piece endings, KBNvK
+// and KNNvK, and the DTZ tables of KQvK and KRvK. They were written with
+// WriteWDL and WriteDTZ; tables of the same material from the Syzygy
+// generator can take their place.
+const testdata = "testdata"
+
+// Positions with known results. DTZs of 0 aren't checked.
+var known = []struct {
+	fen string
+	wdl search.WDL
+	dtz int
+}{
+	// Mated, and mate in one
+	{"7k/6Q1/6K1/8/8/8/8/8 b - - 0 1", search.Loss, -1},
+	{"7k/8/6K1/8/8/8/8/1Q6 w - - 0 1", search.Win, 1},
+	{"8/8/8/8/8/1k6/7r/K7 b - - 0 1", search.Win, 1},
+	{"8/8/8/8/8/1k6/8/K6r w - - 0 1", search.Loss, -1},
+	// Stalemate
+	{"7k/5Q2/6K1/8/8/8/8/8 b - - 0 1", search.Draw, 0},
+	// The queen hangs
+	{"8/8/8/8/8/8/1kQ5/7K b - - 0 1", search.Draw, 0},
+	{"8/8/8/8/4k3/8/8/K2R4 w - - 0 1", search.Win, 0},
+	{"8/8/8/3k4/8/8/8/KQ6 b - - 0 1", search.Loss, 0},
+	// King and pawn: the opposition decides, and a rook pawn draws
+	{"8/8/8/4k3/8/4K3/4P3/8 b - - 0 1", search.Loss, 0},
+	{"8/8/8/4k3/8/4K3/4P3/8 w - - 0 1", search.Draw, 0},
+	{"8/8/8/4k3/8/8/p7/6K1 w - - 0 1", search.Loss, 0},
+	{"k7/8/1K6/P7/8/8/8/8 w - - 0 1", search.Draw, 0},
+	// A minor piece can't win
+	{"8/8/8/4k3/8/8/8/KB6 w - - 0 1", search.Draw, 0},
+	{"8/8/8/4k3/8/8/8/KN6 b - - 0 1", search.Draw, 0},
+	// King against king
+	{"8/8/8/4k3/8/4K3/8/8 w - - 0 1", search.Draw, 0},
+	// Bishop and knight win, unless one hangs
+	{"8/8/8/4k3/8/8/8/KBN5 w - - 0 1", search.Win, 0},
+	{"8/8/8/4k3/8/8/8/KBN5 b - - 0 1", search.Loss, 0},
+	{"8/8/8/8/8/8/3kN3/KB6 b - - 0 1", search.Draw, 0},
+	// Two knights can't force mate, but can give it
+	{"8/8/8/4k3/8/8/8/KNN5 w - - 0 1", search.Draw, 0},
+	{"7k/4NN2/6K1/8/8/8/8/8 b - - 0 1", search.Loss, 0},
+}
+
+// checkKnown probes the positions with known results
+func checkKnown(t *testing.T, tb *syzygy.Tablebase) {
+	for _, test := range known {
+		g := fromFEN(t, test.fen)
+		if wdl, ok := tb.ProbeWDL(g); !ok || wdl != test.wdl {
+			t.Errorf("Expected %v for %v, got %v (%v)\n", test.wdl, test.fen, wdl, ok)
+		}
+		if test.dtz == 0 {
+			continue
+		}
+		if dtz, ok := tb.ProbeDTZ(g); !ok || dtz != test.dtz {
+			t.Errorf("Expected a DTZ of %v for %v, got %v (%v)\n", test.dtz, test.fen, dtz, ok)
+		}
+	}
+}
+
+func openTestdata(t *testing.T) *syzygy.Tablebase {
+	tb, err := syzygy.Open(testdata)
+	if err != nil {
+		t.Fatalf("Failed to open tables: %v\n", err)
+	}
+	return tb
+}
+
+func fromFEN(t *testing.T, fen string) *game.Game {
+	g, err := game.FromFEN(fen)
+	if err != nil {
+		t.Fatalf("Failed to create game: %v\n", err)
+	}
+	return g
+}
+
+func TestProbeKnownPositions(t *testing.T) {
+	tb := openTestdata(t)
+	if tb.MaxPieces() != 4 {
+		t.Errorf("Expected at most 4 pieces, got %v\n", tb.MaxPieces())
+	}
+	checkKnown(t, tb)
+}
+
+// TestProbeSyzygyPath checks the tables in $SYZYGY_PATH, as published by
+// the Syzygy generator
+func TestProbeSyzygyPath(t *testing.T) {
+	path := os.Getenv("SYZYGY_PATH")
+	if path == "" {
+		t.Skip("SYZYGY_PATH isn't set")
+	}
+	tb, err := syzygy.Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open tables: %v\n", err)
+	}
+	checkKnown(t, tb)
+}
+
+func TestProbeUncovered(t *testing.T) {
+	// Just KQvK
+	dir := t.TempDir()
+	for _, name := range []string{"KQvK.rtbw", "KQvK.rtbz"} {
+		data, err := os.ReadFile(filepath.Join(testdata, name))
+		if err != nil {
+			t.Fatalf("Failed to read %v: %v\n", name, err)
+		}
+		writeFile(t, dir, name, data)
+	}
+	tb, err := syzygy.Open(dir)
+	if err != nil {
+		t.Fatalf("Failed to open tables: %v\n", err)
+	}
+	if g := fromFEN(t, "8/8/8/4k3/8/4K3/4Q3/8 w - - 0 1"); !covered(tb, g) {
+		t.Errorf("Expected %v to be covered\n", g.ToFEN())
+	}
+	for _, fen := range []string{
+		// No table
+		"8/8/8/4k3/8/4K3/4R3/8 w - - 0 1",
+		// A capture into a position without a table
+		"8/8/8/4k3/4r3/4K3/4Q3/8 w - - 0 1",
+		// Too many pieces
+		"8/8/8/4k3/8/4K3/3QQ3/8 w - - 0 1",
+		// Castling
+		"4k3/8/8/8/8/8/8/Q3K2R w K - 0 1",
+	} {
+		if g := fromFEN(t, fen); covered(tb, g) {
+			t.Errorf("Expected %v not to be covered\n", fen)
+		}
+	}
+
+	// No DTZ table with pawns, though the result is known
+	g := fromFEN(t, "8/8/8/4k3/8/4K3/4P3/8 b - - 0 1")
+	if _, ok := openTestdata(t).ProbeDTZ(g); ok {
+		t.Errorf("Expected no DTZ without a KPvK table\n")
+	}
+}
+
+func covered(tb *syzygy.Tablebase, g *game.Game) bool {
+	_, wdl := tb.ProbeWDL(g)
+	_, dtz := tb.ProbeDTZ(g)
+	return wdl || dtz
+}
+
+// randomPosition places pieces on random squares with a random side to
+// move, or returns nil if that isn't a legal position
+func randomPosition(r *rand.Rand, pieces []piece.Piece) *game.Game {
+	var board [64]piece.Piece
+	for i, sq := range r.Perm(64)[:len(pieces)] {
+		if pieces[i].Type() == piece.Pawn && (sq < 8 || sq >= 56) {
+			return nil
+		}
+		board[sq] = pieces[i]
+	}
+	g := game.FromBoard(board, r.Intn(2) == 0)
+	us, them := piece.Piece(piece.White), piece.Piece(piece.Black)
+	if !g.WhiteToMove {
+		us, them = them, us
+	}
+	if g.AttackedBy(g.Bitboard(piece.King|them).LSB(), us) {
+		return nil
+	}
+	return g
+}
+
+// symmetricResult gives each position a made-up result that only depends
+// on the position up to the symmetries tables use: swapping the colors
+// along with the ranks, mirroring the files, and without pawns flipping
+// the ranks and the diagonal too
+func symmetricResult(g *game.Game) search.WDL {
+	transforms := []func(sq int) int{
+		func(sq int) int { return sq },
+		func(sq int) int { return sq ^ 7 },
+	}
+	if g.Pieces[piece.Pawn] == 0 {
+		for _, tr := range transforms[:2] {
+			tr := tr
+			transforms = append(transforms, func(sq int) int { return tr(sq) ^ 56 })
+		}
+		for _, tr := range transforms[:4] {
+			tr := tr
+			transforms = append(transforms, func(sq int) int { return tr((sq>>3 | sq<<3) & 63) })
+		}
+	}
+
+	key := ^uint64(0)
+	for _, tr := range transforms {
+		for _, swap := range []bool{false, true} {
+			var squares []int
+			for sq, p := range g.Board {
+				if p == piece.Empty {
+					continue
+				}
+				sq = tr(sq)
+				if swap {
+					p ^= piece.ColorMask
+					sq ^= 56
+				}
+				squares = append(squares, int(p)<<6|sq)
+			}
+			sort.Ints(squares)
+			var k uint64
+			if g.WhiteToMove != swap {
+				k = 1
+			}
+			for _, sq := range squares {
+				k = k<<11 | uint64(sq)
+			}
+			if k < key {
+				key = k
+			}
+		}
+	}
+	return search.WDL(key*0x9e3779b97f4a7c15>>32%5) - 2
+}
+
+// checkWritten writes WDL tables of made-up results and checks that
+// probing gives them back, in positions without captures as those would
+// need tables of other endings
+func checkWritten(t *testing.T, tests []struct {
+	material string
+	pieces   []piece.Piece
+}) {
+	dir := t.TempDir()
+	for _, test := range tests {
+		f, err := os.Create(filepath.Join(dir, test.material+".rtbw"))
+		if err != nil {
+			t.Fatalf("Failed to create table: %v\n", err)
+		}
+		err = syzygy.WriteWDL(f, test.material, symmetricResult)
+		f.Close()
+		if err != nil {
+			t.Fatalf("Failed to write %v: %v\n", test.material, err)
+		}
+	}
+	tb, err := syzygy.Open(dir)
+	if err != nil {
+		t.Fatalf("Failed to open tables: %v\n", err)
+	}
+
+	r := rand.New(rand.NewSource(1))
+	for _, test := range tests {
+		for checked := 0; checked < 1000; {
+			g := randomPosition(r, test.pieces)
+			if g == nil {
+				continue
+			}
+			capture := false
+			for _, m := range g.AllLegalMoves() {
+				capture = capture || m.IsCapture()
+			}
+			if capture {
+				continue
+			}
+			checked++
+			if wdl, ok := tb.ProbeWDL(g); !ok || wdl != symmetricResult(g) {
+				t.Errorf("Expected %v for %v, got %v (%v)\n", symmetricResult(g), g.ToFEN(), wdl, ok)
+			}
+		}
+	}
+}
+
+const (
+	wk = piece.King | piece.White
+	bk = piece.King | piece.Black
+)
+
+func TestWriteAndProbe(t *testing.T) {
+	checkWritten(t, []struct {
+		material string
+		pieces   []piece.Piece
+	}{
+		{"KQvK", []piece.Piece{wk, piece.Queen | piece.White, bk}},
+		{"KPvK", []piece.Piece{wk, piece.Pawn | piece.White, bk}},
+	})
+}
+
+func TestWriteAndProbePawns(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Writing 4 piece tables takes a while")
+	}
+	// Lead pawns with and without other pawns, in white or black
+	checkWritten(t, []struct {
+		material string
+		pieces   []piece.Piece
+	}{
+		{"KPvKP", []piece.Piece{wk, piece.Pawn | piece.White, bk, piece.Pawn | piece.Black}},
+		{"KPPvK", []piece.Piece{wk, piece.Pawn | piece.White, piece.Pawn | piece.White, bk}},
+		{"KRvKP", []piece.Piece{wk, piece.Rook | piece.White, bk, piece.Pawn | piece.Black}},
+	})
+}
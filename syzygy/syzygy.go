@@ -0,0 +1,192 @@
+// Package syzygy probes Syzygy endgame tablebases.
+//
+// Tables are named after their material, such as KQvKR.rtbw for the WDL
+// (win/draw/loss) table of king and queen against king and rook, and
+// KQvKR.rtbz for its DTZ (distance to zeroing move) table. Each file starts
+// with a magic number, checked when the file is found; the rest is read
+// the first time the table is probed.
+//
+// A table holds every placement of its pieces up to the symmetries of the
+// board, with the results Huffman coded in blocks. Positions where a
+// capture is the best move may hold any value, so probes search captures
+// first, which needs the tables of the materials they lead to.
+package syzygy
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"bareman.net/chess-engine/game"
+	"bareman.net/chess-engine/game/piece"
+)
+
+const (
+	wdlSuffix = ".rtbw"
+	dtzSuffix = ".rtbz"
+)
+
+var (
+	wdlMagic = []byte{0x71, 0xe8, 0x23, 0x5d}
+	dtzMagic = []byte{0xd7, 0x66, 0x0c, 0xa5}
+)
+
+// Pieces in the order they appear in table names
+var nameOrder = []piece.Piece{piece.King, piece.Queen, piece.Rook, piece.Bishop, piece.Knight, piece.Pawn}
+
+type Tablebase struct {
+	// Files by table name
+	wdl       map[string]*file
+	dtz       map[string]*file
+	maxPieces int
+}
+
+// file is a table file, read on first use
+type file struct {
+	path  string
+	dtz   bool
+	once  sync.Once
+	table *table
+	err   error
+}
+
+// load reads the table in f, or returns the error reading it
+func (f *file) load() (*table, error) {
+	f.once.Do(func() {
+		name := strings.TrimSuffix(filepath.Base(f.path), filepath.Ext(f.path))
+		var t *table
+		if t, f.err = newTable(name, f.dtz); f.err != nil {
+			return
+		}
+		var data []byte
+		if data, f.err = os.ReadFile(f.path); f.err != nil {
+			return
+		}
+		if f.err = t.read(data); f.err == nil {
+			f.table = t
+		}
+	})
+	return f.table, f.err
+}
+
+// Open finds the tables in the directories of path, separated as in the
+// PATH environment variable. Files with other names are ignored, and files
+// with a table's name but not its magic number are an error.
+func Open(path string) (*Tablebase, error) {
+	t := &Tablebase{wdl: map[string]*file{}, dtz: map[string]*file{}}
+	for _, dir := range filepath.SplitList(path) {
+		if dir == "" {
+			continue
+		}
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			if err := t.add(filepath.Join(dir, entry.Name())); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return t, nil
+}
+
+func (t *Tablebase) add(path string) error {
+	ext := filepath.Ext(path)
+	name := strings.TrimSuffix(filepath.Base(path), ext)
+	var tables map[string]*file
+	var magic []byte
+	switch ext {
+	case wdlSuffix:
+		tables, magic = t.wdl, wdlMagic
+	case dtzSuffix:
+		tables, magic = t.dtz, dtzMagic
+	default:
+		return nil
+	}
+	pieces, ok := countPieces(name)
+	if !ok {
+		return nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	header := make([]byte, len(magic))
+	if _, err := io.ReadFull(f, header); err != nil || !bytes.Equal(header, magic) {
+		return fmt.Errorf("syzygy: %v is not a %v table", path, strings.TrimPrefix(ext, "."))
+	}
+
+	tables[name] = &file{path: path, dtz: ext == dtzSuffix}
+	if ext == wdlSuffix && pieces > t.maxPieces {
+		t.maxPieces = pieces
+	}
+	return nil
+}
+
+// countPieces checks a table name and counts its pieces
+func countPieces(name string) (int, bool) {
+	sides := strings.Split(name, "v")
+	if len(sides) != 2 {
+		return 0, false
+	}
+	n := 0
+	for _, side := range sides {
+		if !strings.HasPrefix(side, "K") || strings.Count(side, "K") != 1 {
+			return 0, false
+		}
+		for _, r := range side {
+			if !strings.ContainsRune("KQRBNP", r) {
+				return 0, false
+			}
+			n++
+		}
+	}
+	return n, true
+}
+
+// Tables returns the number of WDL tables found
+func (t *Tablebase) Tables() int {
+	return len(t.wdl)
+}
+
+func (t *Tablebase) MaxPieces() int {
+	return t.maxPieces
+}
+
+// Table returns the name of the table holding the position in g and
+// whether it was found
+func (t *Tablebase) Table(g *game.Game) (string, bool) {
+	name, _, ok := t.find(t.wdl, g)
+	return name, ok
+}
+
+// find returns the name of the file in files holding the position in g.
+// Files are named with either side first, so both orders are tried; flip
+// is set if black has the side named first.
+func (t *Tablebase) find(files map[string]*file, g *game.Game) (name string, flip bool, ok bool) {
+	white, black := side(g, piece.White), side(g, piece.Black)
+	if _, ok := files[white+"v"+black]; ok {
+		return white + "v" + black, false, true
+	}
+	if _, ok := files[black+"v"+white]; ok {
+		return black + "v" + white, true, true
+	}
+	return "", false, false
+}
+
+func side(g *game.Game, color piece.Piece) string {
+	var sb strings.Builder
+	for _, p := range nameOrder {
+		for n := g.Bitboard(p | color).Count(); n > 0; n-- {
+			sb.WriteString((p | piece.White).String())
+		}
+	}
+	return sb.String()
+}
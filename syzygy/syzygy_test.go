@@ -0,0 +1,69 @@
+package syzygy_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"bareman.net/chess-engine/game"
+	"bareman.net/chess-engine/syzygy"
+)
+
+func writeFile(t *testing.T, dir, name string, data []byte) {
+	if err := os.WriteFile(filepath.Join(dir, name), data, 0o644); err != nil {
+		t.Fatalf("Failed to write %v: %v\n", name, err)
+	}
+}
+
+func TestOpen(t *testing.T) {
+	wdl := []byte{0x71, 0xe8, 0x23, 0x5d, 0}
+	dtz := []byte{0xd7, 0x66, 0x0c, 0xa5, 0}
+	first, second := t.TempDir(), t.TempDir()
+	writeFile(t, first, "KQvK.rtbw", wdl)
+	writeFile(t, first, "KQvK.rtbz", dtz)
+	writeFile(t, second, "KRvKN.rtbw", wdl)
+	// Not tables, so ignored
+	writeFile(t, second, "README.txt", nil)
+	writeFile(t, second, "KXvK.rtbw", nil)
+
+	tb, err := syzygy.Open(first + string(os.PathListSeparator) + second)
+	if err != nil {
+		t.Fatalf("Failed to open tables: %v\n", err)
+	}
+	if tb.Tables() != 2 {
+		t.Errorf("Expected 2 tables, got %v\n", tb.Tables())
+	}
+	if tb.MaxPieces() != 4 {
+		t.Errorf("Expected at most 4 pieces, got %v\n", tb.MaxPieces())
+	}
+
+	tests := []struct {
+		fen   string
+		table string
+	}{
+		{"8/8/8/4k3/8/8/8/KQ6 w - - 0 1", "KQvK"},
+		{"kq6/8/8/4K3/8/8/8/8 b - - 0 1", "KQvK"},
+		{"k7/n7/8/8/8/8/8/KR6 w - - 0 1", "KRvKN"},
+		{"k7/r7/8/8/8/8/8/KN6 w - - 0 1", "KRvKN"},
+		{"k7/8/8/8/8/8/8/KR6 w - - 0 1", ""},
+	}
+	for _, test := range tests {
+		g, err := game.FromFEN(test.fen)
+		if err != nil {
+			t.Fatalf("Failed to create game: %v\n", err)
+		}
+		if table, _ := tb.Table(g); table != test.table {
+			t.Errorf("Expected table %q for %v, got %q\n", test.table, test.fen, table)
+		}
+	}
+}
+
+func TestOpenBadMagic(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "KQvK.rtbw", []byte{0xd7, 0x66, 0x0c, 0xa5})
+	_, err := syzygy.Open(dir)
+	if err == nil || !strings.Contains(err.Error(), "KQvK.rtbw") {
+		t.Errorf("Expected an error naming the file, got %v\n", err)
+	}
+}
@@ -0,0 +1,581 @@
+package syzygy
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+
+	"bareman.net/chess-engine/game/piece"
+	"bareman.net/chess-engine/search"
+)
+
+// Flags of the whole file, after the magic number
+const (
+	fileSplit = 1 << iota
+	filePawns
+)
+
+// Flags of each part of a table. The ones before flagSingleValue only
+// apply to DTZ tables.
+const (
+	// Set if the part holds positions with black to move
+	flagSTM = 1 << iota
+	// Values are looked up in the DTZ map
+	flagMapped
+	// Wins and losses are in plies rather than moves
+	flagWinPlies
+	flagLossPlies
+	// The DTZ map has 2 byte entries
+	flagWide
+	flagSingleValue = 128
+)
+
+// Pieces as numbered in table files, with 8 added for black
+var filePieces = []piece.Piece{piece.Empty, piece.Pawn, piece.Knight, piece.Bishop, piece.Rook, piece.Queen, piece.King}
+
+// table is a WDL or DTZ table read from its file
+type table struct {
+	name string
+	dtz  bool
+	// The first side's pieces and pawns are in white, as named
+	pieceCount   int
+	pawns        bool
+	uniquePieces bool
+	// Pawns of the lead color, the one with fewer pawns but some, and of
+	// the other
+	pawnCount [2]int
+	// Both sides have the same pieces, so only positions with the first
+	// side to move are held
+	symmetric bool
+	// Parts of the table by side to move and, with pawns, the lead pawn's
+	// file. WDL tables have both sides to move unless symmetric, and DTZ
+	// tables one.
+	pairs [2][4]*pairs
+	// Maps from stored DTZ values to real ones, for parts with flagMapped
+	dtzMap []byte
+}
+
+// pairs is one part of a table, Huffman coded after "recursive pairing"
+// has replaced frequent pairs of symbols with new symbols. Values are
+// stored in blocks of the same size, each starting with a new symbol.
+type pairs struct {
+	flags byte
+	// Pieces in the order they are indexed, in groups of identical pieces
+	// except for the leading group. groupIdx is what each group's index is
+	// multiplied by; the last entry is the size of the part.
+	pieces   [maxPieces]piece.Piece
+	groupLen [maxPieces + 1]int
+	groupIdx [maxPieces + 1]uint64
+
+	minSymLen, maxSymLen int
+	blockSize            int
+	numBlocks            int
+	// A sparse index entry every span values, giving the block and the
+	// offset within it of the value in the middle of the span
+	span        uint64
+	sparseIndex []byte
+	sparseSize  int
+	// Number of values in each block, minus one, as 2 bytes each. There
+	// may be more than there are blocks.
+	blockLength     []byte
+	blockLengthSize int
+	// lowestSym[i] is the first symbol of length minSymLen+i, and base[i]
+	// its code padded to 64 bits
+	lowestSym []uint16
+	base      []uint64
+	// Each symbol's left and right symbols, or its value on the left
+	btree []byte
+	// Number of values a symbol stands for, minus one
+	symlen []uint8
+	data   []byte
+	// Offsets in the table's dtzMap of the maps for wins, losses, cursed
+	// wins and blessed losses
+	mapIdx [4]int
+}
+
+// newTable sets up a table for the material it is named after, such as
+// KRvKP, before its file is read
+func newTable(name string, dtz bool) (*table, error) {
+	sides := strings.Split(name, "v")
+	if _, ok := countPieces(name); !ok {
+		return nil, fmt.Errorf("syzygy: invalid table name %q", name)
+	}
+	t := &table{name: name, dtz: dtz, symmetric: sides[0] == sides[1]}
+	t.pieceCount = len(sides[0]) + len(sides[1])
+	if t.pieceCount > maxPieces {
+		return nil, fmt.Errorf("syzygy: %v has more than %v pieces", name, maxPieces)
+	}
+	for _, side := range sides {
+		for _, letter := range "QRBNP" {
+			if strings.Count(side, string(letter)) == 1 {
+				t.uniquePieces = true
+			}
+		}
+	}
+	white, black := strings.Count(sides[0], "P"), strings.Count(sides[1], "P")
+	t.pawns = white+black > 0
+	t.pawnCount = [2]int{white, black}
+	if black > 0 && (white == 0 || white > black) {
+		t.pawnCount = [2]int{black, white}
+	}
+	return t, nil
+}
+
+// sides returns how many sides to move the table holds
+func (t *table) sides() int {
+	if t.dtz || t.symmetric {
+		return 1
+	}
+	return 2
+}
+
+// files returns how many parts by lead pawn file the table has
+func (t *table) files() int {
+	if t.pawns {
+		return 4
+	}
+	return 1
+}
+
+// reader reads little-endian numbers from a table file, noting if it runs
+// past the end
+type reader struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func (r *reader) bytes(n int) []byte {
+	if r.err != nil || n < 0 || r.pos+n > len(r.data) {
+		r.err = errors.New("unexpected end of file")
+		return make([]byte, n)
+	}
+	b := r.data[r.pos : r.pos+n]
+	r.pos += n
+	return b
+}
+
+func (r *reader) byte() byte {
+	return r.bytes(1)[0]
+}
+
+func (r *reader) uint16() uint16 {
+	return binary.LittleEndian.Uint16(r.bytes(2))
+}
+
+func (r *reader) uint32() uint32 {
+	return binary.LittleEndian.Uint32(r.bytes(4))
+}
+
+// align skips to the next multiple of n from the start of the file
+func (r *reader) align(n int) {
+	if rem := r.pos % n; rem != 0 {
+		r.bytes(n - rem)
+	}
+}
+
+// read sets up t from the contents of its file, magic number included.
+// The layout is:
+//
+//	flags                 fileSplit and filePawns
+//	pieces                for each file: the order of the groups and the
+//	                      pieces in index order, one side to move in each
+//	                      half byte
+//	sizes                 for each file and side to move, see readSizes
+//	DTZ map               for DTZ tables, the maps of parts with flagMapped
+//	sparse index          for each part, 6 bytes an entry
+//	block lengths         for each part, 2 bytes a block
+//	data                  for each part, starting at a multiple of 64 bytes
+func (t *table) read(data []byte) error {
+	r := &reader{data: data, pos: len(wdlMagic)}
+	flags := r.byte()
+	if (flags&filePawns != 0) != t.pawns || (flags&fileSplit != 0) == t.symmetric {
+		return fmt.Errorf("syzygy: %v has the flags of another table", t.name)
+	}
+
+	for f := 0; f < t.files(); f++ {
+		var order [2][2]int
+		b := r.byte()
+		order[0][0], order[1][0] = int(b&0xf), int(b>>4)
+		order[0][1], order[1][1] = 0xf, 0xf
+		if t.pawns && t.pawnCount[1] > 0 {
+			b := r.byte()
+			order[0][1], order[1][1] = int(b&0xf), int(b>>4)
+		}
+		for side := 0; side < t.sides(); side++ {
+			t.pairs[side][f] = &pairs{}
+		}
+		for i, b := range r.bytes(t.pieceCount) {
+			for side := 0; side < t.sides(); side++ {
+				p, err := filePiece(b >> (4 * side) & 0xf)
+				if err != nil {
+					return fmt.Errorf("syzygy: %v: %w", t.name, err)
+				}
+				t.pairs[side][f].pieces[i] = p
+			}
+		}
+		for side := 0; side < t.sides(); side++ {
+			if err := t.setGroups(t.pairs[side][f], order[side], f); err != nil {
+				return err
+			}
+		}
+	}
+	r.align(2)
+
+	for f := 0; f < t.files(); f++ {
+		for side := 0; side < t.sides(); side++ {
+			if err := t.pairs[side][f].readSizes(r); err != nil {
+				return fmt.Errorf("syzygy: %v: %w", t.name, err)
+			}
+		}
+	}
+
+	if t.dtz {
+		t.readDTZMap(r)
+	}
+
+	for f := 0; f < t.files(); f++ {
+		for side := 0; side < t.sides(); side++ {
+			d := t.pairs[side][f]
+			d.sparseIndex = r.bytes(6 * d.sparseSize)
+		}
+	}
+	for f := 0; f < t.files(); f++ {
+		for side := 0; side < t.sides(); side++ {
+			d := t.pairs[side][f]
+			d.blockLength = r.bytes(2 * d.blockLengthSize)
+		}
+	}
+	for f := 0; f < t.files(); f++ {
+		for side := 0; side < t.sides(); side++ {
+			d := t.pairs[side][f]
+			r.align(64)
+			// The last block may be cut short at the end of the file
+			size := d.numBlocks * d.blockSize
+			if last := r.pos + size - len(data); last > 0 && last < d.blockSize {
+				size -= last
+			}
+			d.data = r.bytes(size)
+		}
+	}
+	if r.err != nil {
+		return fmt.Errorf("syzygy: %v: %w", t.name, r.err)
+	}
+	return nil
+}
+
+// filePiece converts a piece as numbered in table files
+func filePiece(b byte) (piece.Piece, error) {
+	if int(b&7) >= len(filePieces) || b&7 == 0 {
+		return piece.Empty, fmt.Errorf("invalid piece %v", b)
+	}
+	color := piece.Piece(piece.White)
+	if b&8 != 0 {
+		color = piece.Black
+	}
+	return filePieces[b&7] | color, nil
+}
+
+// groups returns the number of groups of pieces in d
+func (d *pairs) groups() int {
+	n := 0
+	for d.groupLen[n] != 0 {
+		n++
+	}
+	return n
+}
+
+// setGroups splits d's pieces into groups and works out what each group's
+// index is multiplied by. The leading group is the lead pawns, or without
+// pawns three unique pieces or the kings; other groups are identical
+// pieces. order gives the place of the leading group, and of the other
+// side's pawns when both sides have some, among the factors from least
+// significant.
+func (t *table) setGroups(d *pairs, order [2]int, file int) error {
+	firstLen := 2
+	if t.pawns {
+		firstLen = 0
+	} else if t.uniquePieces {
+		firstLen = 3
+	}
+	n := 0
+	d.groupLen[0] = 1
+	for i := 1; i < t.pieceCount; i++ {
+		firstLen--
+		if firstLen > 0 || d.pieces[i] == d.pieces[i-1] {
+			d.groupLen[n]++
+		} else {
+			n++
+			d.groupLen[n] = 1
+		}
+	}
+	n++
+	d.groupLen[n] = 0
+	if t.pawns && (d.pieces[0].Type() != piece.Pawn || d.groupLen[0] > 5) {
+		return fmt.Errorf("syzygy: %v doesn't start with the lead pawns", t.name)
+	}
+
+	pawnsBoth := t.pawns && t.pawnCount[1] > 0
+	next := 1
+	free := 64 - d.groupLen[0]
+	if pawnsBoth {
+		next = 2
+		free -= d.groupLen[1]
+	}
+	idx := uint64(1)
+	for k := 0; next < n || k == order[0] || k == order[1]; k++ {
+		if k >= 16 || d.groupLen[next] > 5 {
+			return fmt.Errorf("syzygy: %v has an invalid group order", t.name)
+		}
+		switch {
+		case k == order[0]:
+			d.groupIdx[0] = idx
+			switch {
+			case t.pawns:
+				idx *= leadPawnsSize[d.groupLen[0]][file]
+			case t.uniquePieces:
+				idx *= 31332
+			default:
+				idx *= 462
+			}
+		case k == order[1]:
+			d.groupIdx[1] = idx
+			idx *= binomial[d.groupLen[1]][48-d.groupLen[0]]
+		default:
+			d.groupIdx[next] = idx
+			idx *= binomial[d.groupLen[next]][free]
+			free -= d.groupLen[next]
+			next++
+		}
+	}
+	d.groupIdx[n] = idx
+	return nil
+}
+
+// readSizes reads the Huffman code of d. The layout is:
+//
+//	flags          with flagSingleValue, just the value follows
+//	block size     log2 of the bytes in a block
+//	span           log2 of the values between sparse index entries
+//	padding        block lengths stored beyond the number of blocks
+//	blocks         uint32
+//	max length     longest symbol in bits
+//	min length     shortest symbol in bits
+//	lowest         uint16 each, the first symbol of each length
+//	symbols        uint16
+//	btree          3 bytes a symbol, 12 bits each for the left and right
+//	               symbol, padded to a multiple of 2 bytes
+func (d *pairs) readSizes(r *reader) error {
+	d.flags = r.byte()
+	if d.flags&flagSingleValue != 0 {
+		d.minSymLen = int(r.byte())
+		return nil
+	}
+
+	d.blockSize = 1 << r.byte()
+	d.span = 1 << r.byte()
+	d.sparseSize = int((d.groupIdx[d.groups()] + d.span - 1) / d.span)
+	padding := int(r.byte())
+	d.numBlocks = int(r.uint32())
+	d.blockLengthSize = d.numBlocks + padding
+	d.maxSymLen, d.minSymLen = int(r.byte()), int(r.byte())
+	if d.minSymLen < 1 || d.maxSymLen < d.minSymLen || d.maxSymLen > 32 {
+		return errors.New("invalid symbol lengths")
+	}
+
+	lengths := d.maxSymLen - d.minSymLen + 1
+	d.lowestSym = make([]uint16, lengths)
+	for i := range d.lowestSym {
+		d.lowestSym[i] = r.uint16()
+	}
+	// Longer codes are lower numbers, and the codes of each length are
+	// consecutive, so the lowest code of a length follows from the next
+	d.base = make([]uint64, lengths)
+	for i := lengths - 2; i >= 0; i-- {
+		d.base[i] = (d.base[i+1] + uint64(d.lowestSym[i]) - uint64(d.lowestSym[i+1])) / 2
+	}
+	for i := range d.base {
+		d.base[i] <<= 64 - i - d.minSymLen
+	}
+
+	symbols := int(r.uint16())
+	d.btree = r.bytes(3 * symbols)
+	r.align(2)
+	if r.err != nil {
+		return r.err
+	}
+	d.symlen = make([]uint8, symbols)
+	visited := make([]bool, symbols)
+	for sym := range d.symlen {
+		if !visited[sym] {
+			length, err := d.setSymlen(sym, visited)
+			if err != nil {
+				return err
+			}
+			d.symlen[sym] = length
+		}
+	}
+	return nil
+}
+
+func (d *pairs) left(sym int) int {
+	return int(d.btree[3*sym+1]&0xf)<<8 | int(d.btree[3*sym])
+}
+
+func (d *pairs) right(sym int) int {
+	return int(d.btree[3*sym+2])<<4 | int(d.btree[3*sym+1]>>4)
+}
+
+// setSymlen works out how many values sym stands for from its pair
+func (d *pairs) setSymlen(sym int, visited []bool) (uint8, error) {
+	visited[sym] = true
+	right := d.right(sym)
+	if right == 0xfff {
+		return 0, nil
+	}
+	left := d.left(sym)
+	if left >= len(d.symlen) || right >= len(d.symlen) {
+		return 0, errors.New("invalid symbol")
+	}
+	for _, s := range []int{left, right} {
+		if !visited[s] {
+			length, err := d.setSymlen(s, visited)
+			if err != nil {
+				return 0, err
+			}
+			d.symlen[s] = length
+		}
+	}
+	return d.symlen[left] + d.symlen[right] + 1, nil
+}
+
+// readDTZMap notes where each part's maps start. Each map is a count and
+// that many entries.
+func (t *table) readDTZMap(r *reader) {
+	start := r.pos
+	for f := 0; f < t.files(); f++ {
+		d := t.pairs[0][f]
+		if d.flags&flagMapped == 0 {
+			continue
+		}
+		if d.flags&flagWide != 0 {
+			r.align(2)
+			for i := range d.mapIdx {
+				d.mapIdx[i] = r.pos + 2 - start
+				r.bytes(2 * int(r.uint16()))
+			}
+		} else {
+			for i := range d.mapIdx {
+				d.mapIdx[i] = r.pos + 1 - start
+				r.bytes(int(r.byte()))
+			}
+		}
+	}
+	t.dtzMap = r.data[start:r.pos]
+	r.align(2)
+}
+
+// value returns the value at idx
+func (d *pairs) value(idx uint64) (int, error) {
+	if d.flags&flagSingleValue != 0 {
+		return d.minSymLen, nil
+	}
+	if idx >= d.groupIdx[d.groups()] {
+		return 0, errors.New("index out of range")
+	}
+
+	// Find the block from the nearest sparse index entry, which gives the
+	// position of the value in the middle of its span
+	k := idx / d.span
+	entry := d.sparseIndex[6*k:]
+	block := int(binary.LittleEndian.Uint32(entry))
+	offset := int(binary.LittleEndian.Uint16(entry[4:]))
+	offset += int(idx%d.span) - int(d.span/2)
+	length := func(block int) int {
+		return int(binary.LittleEndian.Uint16(d.blockLength[2*block:]))
+	}
+	for offset < 0 && block > 0 && block <= d.numBlocks {
+		block--
+		offset += length(block) + 1
+	}
+	for offset >= 0 && block < d.numBlocks && offset > length(block) {
+		offset -= length(block) + 1
+		block++
+	}
+	if offset < 0 || block >= d.numBlocks {
+		return 0, errors.New("invalid sparse index")
+	}
+
+	// Decode symbols until the one holding the value
+	data := d.data[block*d.blockSize:]
+	// Reading past the last block of a part is harmless, as those bits
+	// aren't used
+	word := func(i int) uint64 {
+		var b [4]byte
+		if 4*i < len(data) {
+			copy(b[:], data[4*i:])
+		}
+		return uint64(binary.BigEndian.Uint32(b[:]))
+	}
+	buf := word(0)<<32 | word(1)
+	next, bits := 2, 64
+	var sym int
+	for {
+		l := 0
+		for buf < d.base[l] {
+			l++
+		}
+		sym = int(uint16((buf-d.base[l])>>(64-l-d.minSymLen)) + d.lowestSym[l])
+		if sym >= len(d.symlen) {
+			return 0, errors.New("invalid symbol")
+		}
+		if offset < int(d.symlen[sym])+1 {
+			break
+		}
+		offset -= int(d.symlen[sym]) + 1
+		l += d.minSymLen
+		buf <<= l
+		bits -= l
+		if bits <= 32 {
+			bits += 32
+			buf |= word(next) << (64 - bits)
+			next++
+		}
+	}
+
+	// Expand the symbol's pairs down to the value
+	for d.symlen[sym] != 0 {
+		left := d.left(sym)
+		if offset < int(d.symlen[left])+1 {
+			sym = left
+		} else {
+			offset -= int(d.symlen[left]) + 1
+			sym = d.right(sym)
+		}
+	}
+	return d.left(sym), nil
+}
+
+// The map of each result, from loss to win, in mapIdx
+var resultMaps = [5]int{1, 3, 0, 2, 0}
+
+// dtzValue converts a value of part d of a DTZ table to plies, given the
+// result of the position
+func (t *table) dtzValue(d *pairs, value int, wdl search.WDL) int {
+	if d.flags&flagMapped != 0 {
+		idx := d.mapIdx[resultMaps[wdl+2]]
+		if d.flags&flagWide != 0 {
+			value = int(binary.LittleEndian.Uint16(t.dtzMap[idx+2*value:]))
+		} else {
+			value = int(t.dtzMap[idx+value])
+		}
+	}
+	switch {
+	case wdl == search.Win && d.flags&flagWinPlies != 0, wdl == search.Loss && d.flags&flagLossPlies != 0:
+	default:
+		// Stored in moves
+		value *= 2
+	}
+	return value + 1
+}
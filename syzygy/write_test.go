@@ -0,0 +1,606 @@
+package syzygy
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"bareman.net/chess-engine/game"
+	"bareman.net/chess-engine/game/piece"
+	"bareman.net/chess-engine/search"
+)
+
+// Tables for tests are written here, in the package's tests so they can
+// use its index. They are neither as small as the Syzygy generator's nor
+// built as fast.
+
+// Most pieces, kings included, of a table that can be written, as every
+// placement is set up
+const maxWritePieces = 4
+
+// Sizes of the parts of written tables
+const (
+	blockSizeLog = 8
+	spanLog      = 12
+	// Longest Huffman code, so a symbol always fits the decoder's buffer
+	maxCodeLen = 24
+	// Rounds of pairing symbols
+	pairRounds = 256
+)
+
+// WriteWDL writes the WDL table of material, such as KQvK, in the Syzygy
+// format. wdl gives the result of each legal position for the side to
+// move, with the first side's pieces in white.
+func WriteWDL(w io.Writer, material string, wdl func(g *game.Game) search.WDL) error {
+	return write(w, material, false, func(g *game.Game) int { return int(wdl(g)) })
+}
+
+// WriteDTZ writes the DTZ table of material in the Syzygy format, as
+// WriteWDL does. dtz gives the value ProbeDTZ returns for each position,
+// which is only needed when the best move doesn't zero the count. Only
+// positions with the first side to move are stored, and wins and losses
+// taking over 100 plies aren't supported.
+func WriteDTZ(w io.Writer, material string, dtz func(g *game.Game) int) error {
+	return write(w, material, true, dtz)
+}
+
+func write(w io.Writer, material string, dtz bool, value func(g *game.Game) int) error {
+	t, err := newTable(material, dtz)
+	if err != nil {
+		return err
+	}
+	if t.pieceCount > maxWritePieces {
+		return fmt.Errorf("syzygy: can't write %v, which has more than %v pieces", material, maxWritePieces)
+	}
+	pieces, order := t.layout()
+	for f := 0; f < t.files(); f++ {
+		for side := 0; side < t.sides(); side++ {
+			d := &pairs{pieces: pieces}
+			if err := t.setGroups(d, order, f); err != nil {
+				return err
+			}
+			t.pairs[side][f] = d
+		}
+	}
+
+	// Values by part and index, and whether a position has the index
+	values := map[*pairs][]int{}
+	seen := map[*pairs][]bool{}
+	for f := 0; f < t.files(); f++ {
+		for side := 0; side < t.sides(); side++ {
+			d := t.pairs[side][f]
+			values[d] = make([]int, d.groupIdx[d.groups()])
+			seen[d] = make([]bool, d.groupIdx[d.groups()])
+		}
+	}
+	var board [64]piece.Piece
+	var place func(i int) error
+	place = func(i int) error {
+		if i == t.pieceCount {
+			for _, whiteToMove := range []bool{true, false} {
+				g := game.FromBoard(board, whiteToMove)
+				waiting := piece.Piece(piece.Black)
+				if !whiteToMove {
+					waiting = piece.White
+				}
+				if g.AttackedBy(g.Bitboard(piece.King|waiting).LSB(), waiting^piece.ColorMask) {
+					continue
+				}
+				d, idx, ok := t.index(g, false)
+				if !ok {
+					continue
+				}
+				v := value(g)
+				if dtz && (v > 100 || v < -100) {
+					return fmt.Errorf("syzygy: %v has a DTZ of %v plies in %v", material, v, g.ToFEN())
+				}
+				if seen[d][idx] && values[d][idx] != v {
+					return fmt.Errorf("syzygy: %v has different values at the index of %v", material, g.ToFEN())
+				}
+				values[d][idx], seen[d][idx] = v, true
+			}
+			return nil
+		}
+		p := pieces[i]
+		for sq := 0; sq < 64; sq++ {
+			file, rank := sq&7, sq>>3
+			switch {
+			case board[sq] != piece.Empty:
+				continue
+			case p.Type() == piece.Pawn && (rank == 0 || rank == 7):
+				continue
+			// Other placements of the first piece are reflections
+			case i == 0 && file > 3:
+				continue
+			case i == 0 && !t.pawns && rank > file:
+				continue
+			}
+			board[sq] = p
+			err := place(i + 1)
+			board[sq] = piece.Empty
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := place(0); err != nil {
+		return err
+	}
+
+	out := append([]byte{}, wdlMagic...)
+	if dtz {
+		out = append([]byte{}, dtzMagic...)
+	}
+	var flags byte
+	if !t.symmetric {
+		flags |= fileSplit
+	}
+	if t.pawns {
+		flags |= filePawns
+	}
+	out = append(out, flags)
+	for f := 0; f < t.files(); f++ {
+		out = append(out, byte(order[0]|order[0]<<4))
+		if t.pawns && t.pawnCount[1] > 0 {
+			out = append(out, byte(order[1]|order[1]<<4))
+		}
+		for _, p := range pieces[:t.pieceCount] {
+			code := filePieceCode(p)
+			out = append(out, code|code<<4)
+		}
+	}
+	out = pad(out, 2)
+
+	var parts []*encoded
+	var maps []byte
+	for f := 0; f < t.files(); f++ {
+		for side := 0; side < t.sides(); side++ {
+			d := t.pairs[side][f]
+			v := values[d]
+			var flags byte
+			if dtz {
+				var m []byte
+				v, m = dtzMaps(v)
+				maps = append(maps, m...)
+				flags = flagMapped | flagWinPlies | flagLossPlies
+			} else {
+				for i := range v {
+					v[i] += 2
+				}
+			}
+			fill(v, seen[d])
+			e, err := encode(v, flags)
+			if err != nil {
+				return fmt.Errorf("syzygy: %v: %w", material, err)
+			}
+			parts = append(parts, e)
+			out = append(out, e.sizes...)
+		}
+	}
+	out = pad(append(out, maps...), 2)
+	for _, e := range parts {
+		out = append(out, e.sparseIndex...)
+	}
+	for _, e := range parts {
+		out = append(out, e.blockLength...)
+	}
+	for _, e := range parts {
+		out = append(pad(out, 64), e.data...)
+	}
+	_, err = w.Write(out)
+	return err
+}
+
+// layout orders the pieces for the index: without pawns a unique piece
+// and the kings, or just the kings, then identical pieces together; with
+// pawns the lead pawns, the other side's pawns, then the other pieces.
+// order puts the leading group's factor last and the other pawns' first.
+func (t *table) layout() ([maxPieces]piece.Piece, [2]int) {
+	var all []piece.Piece
+	for i, side := range strings.Split(t.name, "v") {
+		color := piece.Piece(piece.White)
+		if i == 1 {
+			color = piece.Black
+		}
+		for _, r := range side {
+			all = append(all, piece.FromRune(r).Type()|color)
+		}
+	}
+	count := func(p piece.Piece) int {
+		n := 0
+		for _, q := range all {
+			if q == p {
+				n++
+			}
+		}
+		return n
+	}
+
+	var first []piece.Piece
+	if t.pawns {
+		lead := piece.Piece(piece.Pawn | piece.White)
+		if count(lead) != t.pawnCount[0] {
+			lead = piece.Pawn | piece.Black
+		}
+		first = repeat(first, lead, count(lead))
+		other := lead ^ piece.ColorMask
+		first = repeat(first, other, count(other))
+	} else {
+		if t.uniquePieces {
+			for _, p := range all {
+				if p.Type() != piece.King && count(p) == 1 {
+					first = append(first, p)
+					break
+				}
+			}
+		}
+		first = append(first, piece.King|piece.White, piece.King|piece.Black)
+	}
+	pieces := first
+	for _, p := range all {
+		if !contains(pieces, p) {
+			pieces = repeat(pieces, p, count(p))
+		}
+	}
+
+	var ordered [maxPieces]piece.Piece
+	copy(ordered[:], pieces)
+	d := &pairs{pieces: ordered}
+	t.setGroups(d, [2]int{0, 0xf}, 0)
+	order := [2]int{d.groups() - 1, 0xf}
+	if t.pawns && t.pawnCount[1] > 0 {
+		order[1] = 0
+	}
+	return ordered, order
+}
+
+func repeat(pieces []piece.Piece, p piece.Piece, n int) []piece.Piece {
+	for ; n > 0; n-- {
+		pieces = append(pieces, p)
+	}
+	return pieces
+}
+
+func contains(pieces []piece.Piece, p piece.Piece) bool {
+	for _, q := range pieces {
+		if q == p {
+			return true
+		}
+	}
+	return false
+}
+
+// filePieceCode numbers p as in table files
+func filePieceCode(p piece.Piece) byte {
+	for code, q := range filePieces {
+		if q == p.Type() && q != piece.Empty {
+			if p.Color() == piece.Black {
+				return byte(code) | 8
+			}
+			return byte(code)
+		}
+	}
+	return 0
+}
+
+func pad(b []byte, n int) []byte {
+	for len(b)%n != 0 {
+		b = append(b, 0)
+	}
+	return b
+}
+
+// fill gives indices without a position the most common value, which
+// compresses best
+func fill(v []int, seen []bool) {
+	counts := map[int]int{}
+	common := 0
+	for i, value := range v {
+		if seen[i] {
+			counts[value]++
+			if counts[value] > counts[common] {
+				common = value
+			}
+		}
+	}
+	for i := range v {
+		if !seen[i] {
+			v[i] = common
+		}
+	}
+}
+
+// dtzMaps numbers the distances of wins and losses in v by how often they
+// occur. It returns the numbers, with draws as 0, and the maps from them
+// to distances in plies less one.
+func dtzMaps(v []int) ([]int, []byte) {
+	// Wins and losses
+	var counts [2]map[int]int
+	var numbers [2]map[int]int
+	class := func(dtz int) (int, int) {
+		if dtz > 0 {
+			return 0, dtz - 1
+		}
+		return 1, -dtz - 1
+	}
+	for c := range counts {
+		counts[c], numbers[c] = map[int]int{}, map[int]int{}
+	}
+	for _, dtz := range v {
+		if dtz != 0 {
+			c, stored := class(dtz)
+			counts[c][stored]++
+		}
+	}
+
+	var maps []byte
+	for c, count := range counts {
+		var stored []int
+		for s := range count {
+			stored = append(stored, s)
+		}
+		sort.Slice(stored, func(i, j int) bool {
+			if count[stored[i]] != count[stored[j]] {
+				return count[stored[i]] > count[stored[j]]
+			}
+			return stored[i] < stored[j]
+		})
+		maps = append(maps, byte(len(stored)))
+		for i, s := range stored {
+			numbers[c][s] = i
+			maps = append(maps, byte(s))
+		}
+	}
+	// No cursed wins or blessed losses
+	maps = append(maps, 0, 0)
+
+	out := make([]int, len(v))
+	for i, dtz := range v {
+		if dtz != 0 {
+			c, stored := class(dtz)
+			out[i] = numbers[c][stored]
+		}
+	}
+	return out, maps
+}
+
+// encoded is one part of a table, laid out as read expects
+type encoded struct {
+	sizes, sparseIndex, blockLength, data []byte
+}
+
+// encode pairs and Huffman codes values, with the part's flags
+func encode(values []int, flags byte) (*encoded, error) {
+	same := true
+	for _, v := range values {
+		if v != values[0] {
+			same = false
+			break
+		}
+	}
+	if same {
+		return &encoded{sizes: []byte{flags | flagSingleValue, byte(values[0])}}, nil
+	}
+
+	// Symbols first stand for one value each, then pairs of symbols
+	// replace the most frequent adjacent pairs
+	var btree [][2]int
+	var symlen []int
+	leaves := map[int]int{}
+	seq := make([]int, len(values))
+	for i, v := range values {
+		sym, ok := leaves[v]
+		if !ok {
+			sym = len(btree)
+			leaves[v] = sym
+			btree = append(btree, [2]int{v, 0xfff})
+			symlen = append(symlen, 0)
+		}
+		seq[i] = sym
+	}
+	for round := 0; round < pairRounds && len(btree) < 0xfff; round++ {
+		n := len(btree)
+		counts := make([]int, n*n)
+		for i := 0; i+1 < len(seq); i++ {
+			counts[seq[i]*n+seq[i+1]]++
+		}
+		best := -1
+		for pair, count := range counts {
+			a, b := pair/n, pair%n
+			if count >= 8 && symlen[a]+symlen[b]+1 < 256 && (best < 0 || count > counts[best]) {
+				best = pair
+			}
+		}
+		if best < 0 {
+			break
+		}
+		a, b := best/n, best%n
+		sym := len(btree)
+		btree = append(btree, [2]int{a, b})
+		symlen = append(symlen, symlen[a]+symlen[b]+1)
+		paired := seq[:0]
+		for i := 0; i < len(seq); i++ {
+			if i+1 < len(seq) && seq[i] == a && seq[i+1] == b {
+				paired = append(paired, sym)
+				i++
+			} else {
+				paired = append(paired, seq[i])
+			}
+		}
+		seq = paired
+	}
+
+	freq := make([]int, len(btree))
+	for _, sym := range seq {
+		freq[sym]++
+	}
+	lengths := codeLengths(freq)
+
+	// Number symbols from the longest code down, as the decoder expects,
+	// with symbols only found in pairs last
+	syms := make([]int, len(btree))
+	for i := range syms {
+		syms[i] = i
+	}
+	sort.SliceStable(syms, func(i, j int) bool { return lengths[syms[i]] > lengths[syms[j]] })
+	ids := make([]int, len(btree))
+	for id, sym := range syms {
+		ids[sym] = id
+	}
+	minLen, maxLen := maxCodeLen, 0
+	countByLen := make([]int, maxCodeLen+1)
+	for _, l := range lengths {
+		if l > 0 {
+			countByLen[l]++
+			if l < minLen {
+				minLen = l
+			}
+			if l > maxLen {
+				maxLen = l
+			}
+		}
+	}
+	lowest := make([]int, maxLen-minLen+1)
+	base := make([]uint64, maxLen-minLen+1)
+	for i := len(lowest) - 2; i >= 0; i-- {
+		lowest[i] = lowest[i+1] + countByLen[minLen+i+1]
+		base[i] = (base[i+1] + uint64(countByLen[minLen+i+1])) / 2
+	}
+	code := func(sym int) uint64 {
+		i := lengths[sym] - minLen
+		return base[i] + uint64(ids[sym]-lowest[i])
+	}
+
+	e := &encoded{}
+	e.sizes = []byte{flags, blockSizeLog, spanLog, 0, 0, 0, 0, 0, byte(maxLen), byte(minLen)}
+	for _, l := range lowest {
+		e.sizes = binary.LittleEndian.AppendUint16(e.sizes, uint16(l))
+	}
+	e.sizes = binary.LittleEndian.AppendUint16(e.sizes, uint16(len(btree)))
+	for _, sym := range syms {
+		left, right := btree[sym][0], btree[sym][1]
+		if right != 0xfff {
+			left, right = ids[left], ids[right]
+		}
+		e.sizes = append(e.sizes, byte(left), byte(left>>8&0xf|right<<4), byte(right>>4))
+	}
+	e.sizes = pad(e.sizes, 2)
+
+	// Fill blocks with whole symbols
+	blockBits := 8 << blockSizeLog
+	span := 1 << spanLog
+	var starts []int
+	var block []byte
+	bits, count, total := 0, 0, 0
+	finish := func() {
+		e.data = append(e.data, block...)
+		e.blockLength = binary.LittleEndian.AppendUint16(e.blockLength, uint16(count-1))
+		block = make([]byte, blockBits/8)
+		bits, count = 0, 0
+	}
+	block = make([]byte, blockBits/8)
+	for _, sym := range seq {
+		n := symlen[sym] + 1
+		if count > 0 && (bits+lengths[sym] > blockBits || count+n > 1<<16-span) {
+			finish()
+		}
+		if count == 0 {
+			starts = append(starts, total)
+		}
+		c := code(sym)
+		for i := lengths[sym] - 1; i >= 0; i-- {
+			if c>>i&1 != 0 {
+				block[bits/8] |= 0x80 >> (bits % 8)
+			}
+			bits++
+		}
+		count += n
+		total += n
+	}
+	finish()
+	binary.LittleEndian.PutUint32(e.sizes[4:], uint32(len(starts)))
+
+	// Each sparse index entry gives the block holding the middle of its
+	// span and the offset there, which may run past the last value
+	for k := 0; k*span < len(values); k++ {
+		middle := k*span + span/2
+		target := middle
+		if target >= len(values) {
+			target = len(values) - 1
+		}
+		b := sort.Search(len(starts), func(i int) bool { return starts[i] > target }) - 1
+		e.sparseIndex = binary.LittleEndian.AppendUint32(e.sparseIndex, uint32(b))
+		e.sparseIndex = binary.LittleEndian.AppendUint16(e.sparseIndex, uint16(middle-starts[b]))
+	}
+	return e, nil
+}
+
+// codeLengths returns the length of each symbol's Huffman code, or 0 for
+// symbols that don't occur. Frequencies are evened out until no code is
+// longer than maxCodeLen.
+func codeLengths(freq []int) []int {
+	freq = append([]int{}, freq...)
+	for {
+		lengths := huffman(freq)
+		longest := 0
+		for _, l := range lengths {
+			if l > longest {
+				longest = l
+			}
+		}
+		if longest <= maxCodeLen {
+			return lengths
+		}
+		for i := range freq {
+			freq[i] = (freq[i] + 1) / 2
+		}
+	}
+}
+
+func huffman(freq []int) []int {
+	var syms []int
+	for sym, f := range freq {
+		if f > 0 {
+			syms = append(syms, sym)
+		}
+	}
+	sort.SliceStable(syms, func(i, j int) bool { return freq[syms[i]] < freq[syms[j]] })
+	lengths := make([]int, len(freq))
+	if len(syms) == 1 {
+		lengths[syms[0]] = 1
+		return lengths
+	}
+
+	// Leaves in order of weight, then the nodes joining them, which come
+	// out in order of weight too
+	weight := make([]int, len(syms), 2*len(syms)-1)
+	parent := make([]int, 2*len(syms)-1)
+	for i, sym := range syms {
+		weight[i] = freq[sym]
+	}
+	leaf, node := 0, len(syms)
+	lightest := func() int {
+		if leaf < len(syms) && (node >= len(weight) || weight[leaf] <= weight[node]) {
+			leaf++
+			return leaf - 1
+		}
+		node++
+		return node - 1
+	}
+	for len(weight) < cap(weight) {
+		a, b := lightest(), lightest()
+		parent[a], parent[b] = len(weight), len(weight)
+		weight = append(weight, weight[a]+weight[b])
+	}
+	depth := make([]int, len(weight))
+	for i := len(weight) - 2; i >= 0; i-- {
+		depth[i] = depth[parent[i]] + 1
+	}
+	for i, sym := range syms {
+		lengths[sym] = depth[i]
+	}
+	return lengths
+}
@@ -0,0 +1,316 @@
+package tablebase
+
+import (
+	"fmt"
+
+	"bareman.net/chess-engine/game"
+	"bareman.net/chess-engine/game/bitboard"
+	"bareman.net/chess-engine/game/move"
+	"bareman.net/chess-engine/game/piece"
+)
+
+// States of indices while a table is built
+const (
+	// Not a legal position, or not the index used for it
+	unused = iota
+	unresolved
+	resolved
+)
+
+// Generate builds the table for material, such as KRvKP, and adds it to tb.
+// Tables reached by captures and promotions are built first if tb doesn't
+// have them. Nothing is done if tb already has the table.
+func (tb *Tablebase) Generate(material string) error {
+	t, err := newTable(material)
+	if err != nil {
+		return err
+	}
+	if _, ok := tb.tables[t.name]; ok {
+		return nil
+	}
+	for _, next := range successors(t.name) {
+		if err := tb.Generate(next); err != nil {
+			return err
+		}
+	}
+	b := &builder{tb: tb, t: t, state: make([]uint8, len(t.dtm)), checked: make([]uint8, len(t.dtm))}
+	if err := b.build(); err != nil {
+		return err
+	}
+	tb.Add(t)
+	return nil
+}
+
+// successors names the materials one capture or promotion away
+func successors(material string) []string {
+	first, second, _ := parseMaterial(material)
+	var names []string
+	add := func(name string) {
+		for _, n := range names {
+			if n == name {
+				return
+			}
+		}
+		names = append(names, name)
+	}
+	for _, sides := range [][2]string{{first, second}, {second, first}} {
+		us, them := sides[0], sides[1]
+		for i := 1; i < len(us); i++ {
+			// Captured
+			add(canonicalName(us[:i]+us[i+1:], them))
+			if us[i] == 'P' {
+				for _, promotion := range "QRBN" {
+					add(canonicalName(us[:i]+string(promotion)+us[i+1:], them))
+				}
+			}
+		}
+	}
+	return names
+}
+
+type builder struct {
+	tb    *Tablebase
+	t     *Table
+	state []uint8
+	// The distance in plies plus one at which each index was last checked
+	// for a loss. Nothing changes within a distance, so each index is only
+	// checked once for it.
+	checked []uint8
+	// Indices to resolve by distance to mate in plies. An index may be
+	// queued more than once; only the shortest distance counts.
+	queue [][]int32
+	list  move.List
+}
+
+func (b *builder) push(plies int, index int) {
+	for len(b.queue) <= plies {
+		b.queue = append(b.queue, nil)
+	}
+	b.queue[plies] = append(b.queue[plies], int32(index))
+}
+
+func (b *builder) build() error {
+	for index := range b.t.dtm {
+		if err := b.start(index); err != nil {
+			return err
+		}
+	}
+
+	for plies := 0; plies < len(b.queue); plies++ {
+		var done []int32
+		for _, index := range b.queue[plies] {
+			if b.state[index] == unresolved {
+				if plies+1 > maxEntry {
+					return fmt.Errorf("tablebase: %v has mates longer than %v plies", b.t.name, maxEntry-1)
+				}
+				b.state[index] = resolved
+				b.t.dtm[index] = uint8(plies + 1)
+				done = append(done, index)
+			}
+		}
+		b.queue[plies] = nil
+
+		for _, index := range done {
+			err := b.predecessors(int(index), func(prev int) error {
+				// A move to a lost position wins, so the mover wins a ply
+				// later; a position is only lost once all its moves are.
+				if plies%2 == 0 {
+					b.push(plies+1, prev)
+					return nil
+				}
+				if b.checked[prev] == uint8(plies+1) {
+					return nil
+				}
+				b.checked[prev] = uint8(plies + 1)
+				lost, err := b.lost(prev)
+				if lost > 0 {
+					b.push(lost, prev)
+				}
+				return err
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// start sets up the index, scoring mates and moves out of the table
+func (b *builder) start(index int) error {
+	g, ok := b.t.position(index)
+	if !ok {
+		return nil
+	}
+	b.state[index] = unresolved
+	g.LegalMoves(&b.list)
+	if b.list.Len() == 0 {
+		if g.InCheck() {
+			b.push(0, index)
+		}
+		return nil
+	}
+
+	win, loss, escape := 0, 0, false
+	for _, m := range b.list.Slice() {
+		if !leaves(m) {
+			// Not known until the table is resolved
+			escape = true
+			continue
+		}
+		entry, err := b.exit(g, m)
+		if err != nil {
+			return err
+		}
+		switch plies := int(entry); {
+		case entry == 0:
+			escape = true
+		case wins(entry):
+			if plies > loss {
+				loss = plies
+			}
+		case win == 0 || plies < win:
+			win = plies
+		}
+	}
+	if win > 0 {
+		b.push(win, index)
+	} else if !escape {
+		b.push(loss, index)
+	}
+	return nil
+}
+
+// leaves reports whether m changes the material, leaving the table
+func leaves(m move.Move) bool {
+	return m.IsCapture() || m.Promotion() != piece.Empty
+}
+
+// exit looks up the position after m, which leaves the table
+func (b *builder) exit(g *game.Game, m move.Move) (uint8, error) {
+	g.MakeUnchecked(m)
+	defer g.Unmake()
+	entry, ok := b.tb.entry(g)
+	if !ok {
+		return 0, fmt.Errorf("tablebase: %v needs the table for %v", b.t.name,
+			canonicalName(side(g, piece.White), side(g, piece.Black)))
+	}
+	return entry, nil
+}
+
+// lost returns the distance to mate in plies for the side to move at index
+// if every move is known to lose, or 0
+func (b *builder) lost(index int) (int, error) {
+	g, _ := b.t.position(index)
+	var list move.List
+	g.LegalMoves(&list)
+	loss := 0
+	for _, m := range list.Slice() {
+		var entry uint8
+		if leaves(m) {
+			var err error
+			if entry, err = b.exit(g, m); err != nil {
+				return 0, err
+			}
+		} else {
+			g.MakeUnchecked(m)
+			next := b.t.gameIndex(g, false)
+			g.Unmake()
+			if b.state[next] != resolved {
+				return 0, nil
+			}
+			entry = b.t.dtm[next]
+		}
+		if !wins(entry) {
+			return 0, nil
+		}
+		// The entry is the opponent's distance plus one
+		if plies := int(entry); plies > loss {
+			loss = plies
+		}
+	}
+	return loss, nil
+}
+
+// predecessors calls f with each unresolved index from which a move that
+// stays in the table reaches index
+func (b *builder) predecessors(index int, f func(int) error) error {
+	t := b.t
+	var buf [maxPieces]int
+	squares := buf[:len(t.pieces)]
+	firstToMove := t.squares(index, squares)
+	var occupied bitboard.Bitboard
+	for _, sq := range squares {
+		occupied |= bitboard.FromSquare(sq)
+	}
+	// The side that moved last
+	color := piece.Piece(piece.White)
+	if firstToMove {
+		color = piece.Black
+	}
+
+	for i, p := range t.pieces {
+		if p.Color() != color {
+			continue
+		}
+		sq := squares[i]
+		var origins bitboard.Bitboard
+		if p.Type() == piece.Pawn {
+			origins = pawnOrigins(sq, color, occupied)
+		} else {
+			origins = bitboard.Attacks(p.Type(), sq, occupied) &^ occupied
+		}
+		for origins != 0 {
+			squares[i] = origins.PopLSB()
+			prev := t.index(squares, !firstToMove)
+			if b.state[prev] == unresolved {
+				if err := f(prev); err != nil {
+					return err
+				}
+			}
+		}
+		squares[i] = sq
+	}
+	return nil
+}
+
+// pawnOrigins returns the squares a pawn of color on sq could have pushed
+// from
+func pawnOrigins(sq int, color piece.Piece, occupied bitboard.Bitboard) bitboard.Bitboard {
+	forward, start := 8, 1
+	if color == piece.Black {
+		forward, start = -8, 6
+	}
+	from := sq - forward
+	if from>>3 == 0 || from>>3 == 7 || occupied.Has(from) {
+		return bitboard.Empty
+	}
+	origins := bitboard.FromSquare(from)
+	if double := from - forward; double>>3 == start && !occupied.Has(double) {
+		origins |= bitboard.FromSquare(double)
+	}
+	return origins
+}
+
+// String describes the table: its name, the longest mate and how many
+// positions are won, drawn and lost for the side to move
+func (t *Table) String() string {
+	var won, drawn, lost, longest int
+	for index, entry := range t.dtm {
+		if _, ok := t.position(index); !ok {
+			continue
+		}
+		switch {
+		case entry == 0:
+			drawn++
+		case wins(entry):
+			won++
+		default:
+			lost++
+		}
+		if int(entry)-1 > longest {
+			longest = int(entry) - 1
+		}
+	}
+	return fmt.Sprintf("%v: longest mate %v plies, %v won, %v drawn, %v lost", t.name, longest, won, drawn, lost)
+}
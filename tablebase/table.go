@@ -0,0 +1,335 @@
+package tablebase
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"bareman.net/chess-engine/game"
+	"bareman.net/chess-engine/game/piece"
+)
+
+// Most pieces, kings included, a table can hold
+const maxPieces = 4
+
+// Largest entry, so the longest distance to mate is maxEntry-1 plies
+const maxEntry = 255
+
+var magic = []byte("DTM\x01")
+
+// Pieces in the order they appear in material names
+var nameOrder = []piece.Piece{piece.King, piece.Queen, piece.Rook, piece.Bishop, piece.Knight, piece.Pawn}
+
+// Table holds the distance to mate of every position of one material set
+type Table struct {
+	name string
+	// Pieces in index order: the first side's king and other pieces in
+	// white, then the second side's in black
+	pieces []piece.Piece
+	pawns  bool
+	// Squares the first king is kept to by symmetry, and the index of each
+	// square in kings or -1
+	kings     []int
+	kingIndex [64]int
+	// One entry per index. Entries are the distance to mate in plies plus
+	// one, odd distances being wins for the side to move, or 0 for draws
+	// and indices that aren't legal positions.
+	dtm []uint8
+}
+
+// Squares the first king is moved to with the symmetries of the board:
+// the a1-d1-d4 triangle for tables without pawns, which can be reflected
+// and rotated, and files a to d with pawns, which can only be reflected
+// left to right
+var (
+	triangle  = squaresWhere(func(file, rank int) bool { return file < 4 && rank <= file })
+	queenside = squaresWhere(func(file, rank int) bool { return file < 4 })
+)
+
+func squaresWhere(f func(file, rank int) bool) []int {
+	var squares []int
+	for sq := 0; sq < 64; sq++ {
+		if f(sq&7, sq>>3) {
+			squares = append(squares, sq)
+		}
+	}
+	return squares
+}
+
+// newTable sets up an empty table for material, such as KRvKP
+func newTable(material string) (*Table, error) {
+	first, second, err := parseMaterial(material)
+	if err != nil {
+		return nil, err
+	}
+	if len(first)+len(second) > maxPieces {
+		return nil, fmt.Errorf("tablebase: %v has more than %v pieces", material, maxPieces)
+	}
+	if strings.Contains(first, "P") && strings.Contains(second, "P") {
+		// Double pawn moves could then allow en passant captures, which
+		// the index doesn't record
+		return nil, fmt.Errorf("tablebase: %v has pawns on both sides, which is not supported", material)
+	}
+
+	t := &Table{name: first + "v" + second}
+	for _, side := range []struct {
+		pieces string
+		color  piece.Piece
+	}{{first, piece.White}, {second, piece.Black}} {
+		for _, r := range side.pieces {
+			t.pieces = append(t.pieces, piece.FromRune(r).Type()|side.color)
+		}
+	}
+	t.pawns = strings.Contains(t.name, "P")
+	t.kings = triangle
+	if t.pawns {
+		t.kings = queenside
+	}
+	for sq := range t.kingIndex {
+		t.kingIndex[sq] = -1
+	}
+	for i, sq := range t.kings {
+		t.kingIndex[sq] = i
+	}
+	size := 2 * len(t.kings)
+	for range t.pieces[1:] {
+		size *= 64
+	}
+	t.dtm = make([]uint8, size)
+	return t, nil
+}
+
+// parseMaterial splits a material name into its sides, stronger side first
+// and each side's pieces in nameOrder
+func parseMaterial(material string) (string, string, error) {
+	sides := strings.Split(material, "v")
+	if len(sides) != 2 {
+		return "", "", fmt.Errorf("tablebase: invalid material %q", material)
+	}
+	for i, side := range sides {
+		if strings.Count(side, "K") != 1 || strings.Trim(side, "KQRBNP") != "" {
+			return "", "", fmt.Errorf("tablebase: invalid material %q", material)
+		}
+		sides[i] = sortSide(side)
+	}
+	if stronger(sides[1], sides[0]) {
+		return sides[1], sides[0], nil
+	}
+	return sides[0], sides[1], nil
+}
+
+// canonicalName names the material of first against second
+func canonicalName(first, second string) string {
+	first, second = sortSide(first), sortSide(second)
+	if stronger(second, first) {
+		first, second = second, first
+	}
+	return first + "v" + second
+}
+
+func sortSide(side string) string {
+	var sb strings.Builder
+	for _, p := range nameOrder {
+		letter := (p | piece.White).String()
+		sb.WriteString(strings.Repeat(letter, strings.Count(side, letter)))
+	}
+	return sb.String()
+}
+
+// stronger reports whether side a is named before side b: it has more
+// pieces, or as many and the first that differs is worth more
+func stronger(a, b string) bool {
+	if len(a) != len(b) {
+		return len(a) > len(b)
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return strings.IndexByte("KQRBNP", a[i]) < strings.IndexByte("KQRBNP", b[i])
+		}
+	}
+	return false
+}
+
+func (t *Table) Name() string {
+	return t.name
+}
+
+// transforms returns how many of the board's symmetries apply to t
+func (t *Table) transforms() int {
+	if t.pawns {
+		return 2
+	}
+	return 8
+}
+
+// transform applies symmetry tr to sq. Bit 0 reflects the files, bit 1 the
+// ranks and bit 2 the long diagonal.
+func transform(sq, tr int) int {
+	file, rank := sq&7, sq>>3
+	if tr&4 != 0 {
+		file, rank = rank, file
+	}
+	if tr&1 != 0 {
+		file = 7 - file
+	}
+	if tr&2 != 0 {
+		rank = 7 - rank
+	}
+	return rank<<3 | file
+}
+
+// index returns the index of the position with t.pieces on squares. Every
+// position equal to it by symmetry or by swapping identical pieces gets
+// the same index: the least of those possible.
+func (t *Table) index(squares []int, firstToMove bool) int {
+	best := -1
+	var buf [maxPieces]int
+	for tr := 0; tr < t.transforms(); tr++ {
+		king := t.kingIndex[transform(squares[0], tr)]
+		if king < 0 {
+			continue
+		}
+		s := buf[:len(squares)]
+		for i, sq := range squares {
+			s[i] = transform(sq, tr)
+		}
+		for i := 2; i < len(s); i++ {
+			for j := i; j > 1 && t.pieces[j] == t.pieces[j-1] && s[j] < s[j-1]; j-- {
+				s[j], s[j-1] = s[j-1], s[j]
+			}
+		}
+
+		index := 0
+		if !firstToMove {
+			index = 1
+		}
+		index = index*len(t.kings) + king
+		for _, sq := range s[1:] {
+			index = index*64 + sq
+		}
+		if best < 0 || index < best {
+			best = index
+		}
+	}
+	return best
+}
+
+// squares fills in the squares of t.pieces at index and returns whether
+// the first side is to move
+func (t *Table) squares(index int, squares []int) bool {
+	for i := len(t.pieces) - 1; i > 0; i-- {
+		squares[i] = index % 64
+		index /= 64
+	}
+	squares[0] = t.kings[index%len(t.kings)]
+	return index/len(t.kings) == 0
+}
+
+// position sets up the position at index. It returns false if the index isn't
+// the one index would give the position, or the position isn't legal.
+func (t *Table) position(index int) (*game.Game, bool) {
+	var squares [maxPieces]int
+	firstToMove := t.squares(index, squares[:len(t.pieces)])
+	if t.index(squares[:len(t.pieces)], firstToMove) != index {
+		return nil, false
+	}
+	var board [64]piece.Piece
+	for i, sq := range squares[:len(t.pieces)] {
+		if board[sq] != piece.Empty {
+			return nil, false
+		}
+		if t.pieces[i].Type() == piece.Pawn && (sq < 8 || sq >= 56) {
+			return nil, false
+		}
+		board[sq] = t.pieces[i]
+	}
+	g := game.FromBoard(board, firstToMove)
+	// The side that just moved can't be left in check
+	waiting := piece.Piece(piece.Black)
+	if !firstToMove {
+		waiting = piece.White
+	}
+	if g.AttackedBy(g.Bitboard(piece.King|waiting).LSB(), waiting^piece.ColorMask) {
+		return nil, false
+	}
+	return g, true
+}
+
+// gameIndex returns the index of the position in g, which has t's
+// material. With flip the colors are swapped, for positions where black
+// has the first side's pieces.
+func (t *Table) gameIndex(g *game.Game, flip bool) int {
+	var squares [maxPieces]int
+	n := 0
+	for i, p := range t.pieces {
+		if i > 0 && p == t.pieces[i-1] {
+			continue
+		}
+		if flip {
+			p ^= piece.ColorMask
+		}
+		for b := g.Bitboard(p); b != 0; n++ {
+			squares[n] = b.PopLSB()
+			if flip {
+				squares[n] ^= 56
+			}
+		}
+	}
+	return t.index(squares[:n], g.WhiteToMove != flip)
+}
+
+// Tables are stored one to a file:
+//
+//	magic  4 bytes, "DTM" and the format version 1
+//	name   1 byte length, then the material such as KRvKP
+//	dtm    one byte per index, compressed with DEFLATE
+
+// Write stores t in the format Load reads
+func (t *Table) Write(w io.Writer) error {
+	header := append(append([]byte{}, magic...), byte(len(t.name)))
+	header = append(header, t.name...)
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	fw, err := flate.NewWriter(w, flate.BestCompression)
+	if err != nil {
+		return err
+	}
+	if _, err := fw.Write(t.dtm); err != nil {
+		return err
+	}
+	return fw.Close()
+}
+
+// Load reads a table written by Write
+func Load(r io.Reader) (*Table, error) {
+	br := bufio.NewReader(r)
+	header := make([]byte, len(magic)+1)
+	if _, err := io.ReadFull(br, header); err != nil || !bytes.Equal(header[:len(magic)], magic) {
+		return nil, errors.New("tablebase: not a table file")
+	}
+	name := make([]byte, header[len(magic)])
+	if _, err := io.ReadFull(br, name); err != nil {
+		return nil, err
+	}
+	t, err := newTable(string(name))
+	if err != nil {
+		return nil, err
+	}
+	if t.name != string(name) {
+		return nil, fmt.Errorf("tablebase: %v is not a canonical material name", string(name))
+	}
+	fr := flate.NewReader(br)
+	defer fr.Close()
+	if _, err := io.ReadFull(fr, t.dtm); err != nil {
+		return nil, fmt.Errorf("tablebase: %v: %w", t.name, err)
+	}
+	if n, _ := fr.Read(make([]byte, 1)); n != 0 {
+		return nil, fmt.Errorf("tablebase: %v has more entries than positions", t.name)
+	}
+	return t, nil
+}
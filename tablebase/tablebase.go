@@ -0,0 +1,159 @@
+// Package tablebase builds, stores and probes distance-to-mate tables for
+// endings of up to four pieces, kings included.
+//
+// Tables are built by retrograde analysis. Every legal position of a
+// material set is set up and its moves generated: mates are scored, along
+// with moves that capture or promote into smaller tables, which are built
+// first. Results are then carried backwards a ply at a time by unmaking
+// moves, until no position changes. Positions left over are draws.
+//
+// Materials are named with the stronger side first, as in other
+// tablebases: KRvKP is king and rook against king and pawn. A table covers
+// either color having either side. Positions are stored once for all of
+// their reflections, and for rotations too without pawns.
+//
+// Distances ignore the fifty-move rule, and positions with castling rights
+// aren't covered. Endings with pawns on both sides aren't supported.
+package tablebase
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"bareman.net/chess-engine/game"
+	"bareman.net/chess-engine/game/piece"
+	"bareman.net/chess-engine/search"
+)
+
+// Extension of table files
+const Extension = ".dtm"
+
+// Tablebase is a set of tables, which can be probed by the search
+type Tablebase struct {
+	// By material name
+	tables map[string]*Table
+}
+
+func New() *Tablebase {
+	return &Tablebase{tables: map[string]*Table{}}
+}
+
+// Open loads every table file in dir
+func Open(dir string) (*Tablebase, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*"+Extension))
+	if err != nil {
+		return nil, err
+	}
+	tb := New()
+	for _, file := range files {
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, err
+		}
+		t, err := Load(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%v: %w", file, err)
+		}
+		tb.Add(t)
+	}
+	return tb, nil
+}
+
+// Add puts t in the tablebase, replacing any table for the same material
+func (tb *Tablebase) Add(t *Table) {
+	tb.tables[t.name] = t
+}
+
+// Tables returns the tables in the tablebase, sorted by name
+func (tb *Tablebase) Tables() []*Table {
+	var tables []*Table
+	for _, t := range tb.tables {
+		tables = append(tables, t)
+	}
+	sort.Slice(tables, func(i, j int) bool { return tables[i].name < tables[j].name })
+	return tables
+}
+
+// Table returns the table for material, such as KRvKP, if there is one
+func (tb *Tablebase) Table(material string) (*Table, bool) {
+	first, second, err := parseMaterial(material)
+	if err != nil {
+		return nil, false
+	}
+	t, ok := tb.tables[first+"v"+second]
+	return t, ok
+}
+
+func (tb *Tablebase) MaxPieces() int {
+	most := 0
+	for _, t := range tb.tables {
+		if len(t.pieces) > most {
+			most = len(t.pieces)
+		}
+	}
+	return most
+}
+
+// entry looks up the position in g
+func (tb *Tablebase) entry(g *game.Game) (uint8, bool) {
+	if g.CanCastle() || g.PieceCount() > maxPieces {
+		return 0, false
+	}
+	white, black := side(g, piece.White), side(g, piece.Black)
+	if t, ok := tb.tables[white+"v"+black]; ok {
+		return t.dtm[t.gameIndex(g, false)], true
+	}
+	if t, ok := tb.tables[black+"v"+white]; ok {
+		return t.dtm[t.gameIndex(g, true)], true
+	}
+	return 0, false
+}
+
+func side(g *game.Game, color piece.Piece) string {
+	var sb strings.Builder
+	for _, p := range nameOrder {
+		sb.WriteString(strings.Repeat((p | piece.White).String(), g.Bitboard(p|color).Count()))
+	}
+	return sb.String()
+}
+
+// wins reports whether an entry is a win for the side to move
+func wins(entry uint8) bool {
+	return entry != 0 && entry%2 == 0
+}
+
+// DTM returns the result of the position in g for the side to move and the
+// number of plies to mate with best play, or 0 for a draw. ok is false if
+// no table covers the position.
+func (tb *Tablebase) DTM(g *game.Game) (wdl search.WDL, plies int, ok bool) {
+	entry, ok := tb.entry(g)
+	switch {
+	case !ok:
+		return search.Draw, 0, false
+	case entry == 0:
+		return search.Draw, 0, true
+	case wins(entry):
+		return search.Win, int(entry) - 1, true
+	}
+	return search.Loss, int(entry) - 1, true
+}
+
+// ProbeWDL returns the result of the position in g. As distances ignore the
+// fifty-move rule, results are never cursed wins or blessed losses.
+func (tb *Tablebase) ProbeWDL(g *game.Game) (search.WDL, bool) {
+	wdl, _, ok := tb.DTM(g)
+	return wdl, ok
+}
+
+// ProbeDTZ returns the distance to mate in plies, negative for losses
+func (tb *Tablebase) ProbeDTZ(g *game.Game) (int, bool) {
+	wdl, plies, ok := tb.DTM(g)
+	if wdl == search.Loss {
+		plies = -plies
+	}
+	return plies, ok
+}
@@ -0,0 +1,315 @@
+package tablebase_test
+
+import (
+	"bytes"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"bareman.net/chess-engine/game"
+	"bareman.net/chess-engine/game/piece"
+	"bareman.net/chess-engine/search"
+	"bareman.net/chess-engine/tablebase"
+)
+
+var (
+	generated     *tablebase.Tablebase
+	generateOnce  sync.Once
+	generateError error
+)
+
+// small returns a tablebase of the 3 piece endings, built once for all tests
+func small(t *testing.T) *tablebase.Tablebase {
+	generateOnce.Do(func() {
+		generated = tablebase.New()
+		for _, material := range []string{"KQvK", "KRvK", "KPvK"} {
+			if generateError = generated.Generate(material); generateError != nil {
+				return
+			}
+		}
+	})
+	if generateError != nil {
+		t.Fatalf("Failed to generate tables: %v\n", generateError)
+	}
+	return generated
+}
+
+func fromFEN(t *testing.T, fen string) *game.Game {
+	g, err := game.FromFEN(fen)
+	if err != nil {
+		t.Fatalf("Failed to create game: %v\n", err)
+	}
+	return g
+}
+
+func TestKnownPositions(t *testing.T) {
+	tb := small(t)
+	// Plies of -1 aren't checked
+	tests := []struct {
+		fen   string
+		wdl   search.WDL
+		plies int
+	}{
+		// Mated
+		{"8/8/8/8/8/5k2/6q1/7K w - - 0 1", search.Loss, 0},
+		{"7k/8/6K1/8/8/8/8/1Q6 w - - 0 1", search.Win, 1},
+		// Stalemate
+		{"7k/5Q2/6K1/8/8/8/8/8 b - - 0 1", search.Draw, 0},
+		// Whoever has the opposition decides king and pawn against king
+		{"8/4k3/8/4K3/4P3/8/8/8 w - - 0 1", search.Draw, 0},
+		{"8/4k3/8/4K3/4P3/8/8/8 b - - 0 1", search.Loss, -1},
+		// The defending king can't be driven from in front of a rook pawn
+		{"k7/8/8/8/8/8/P7/K7 w - - 0 1", search.Draw, 0},
+		// The king can take the undefended queen
+		{"8/8/8/8/8/8/1q6/K6k w - - 0 1", search.Draw, 0},
+	}
+	for _, test := range tests {
+		wdl, plies, ok := tb.DTM(fromFEN(t, test.fen))
+		if !ok {
+			t.Errorf("Expected %v to be covered\n", test.fen)
+			continue
+		}
+		if wdl != test.wdl || test.plies >= 0 && plies != test.plies {
+			t.Errorf("Expected %v in %v plies for %v, got %v in %v\n", test.wdl, test.plies, test.fen, wdl, plies)
+		}
+	}
+
+	// Longest mates with the stronger side to move: 10 moves with a queen,
+	// 16 with a rook and 28 with a pawn
+	for material, longest := range map[string]int{"KQvK": 19, "KRvK": 31, "KPvK": 55} {
+		if got := longestWin(t, tb, material); got != longest {
+			t.Errorf("Expected the longest %v win to take %v plies, got %v\n", material, longest, got)
+		}
+	}
+
+	if _, _, ok := tb.DTM(fromFEN(t, "4k3/8/8/8/8/8/8/R3K3 w Q - 0 1")); ok {
+		t.Errorf("Expected positions with castling rights not to be covered\n")
+	}
+	if _, _, ok := tb.DTM(fromFEN(t, "4k3/8/8/8/8/8/8/RB2K3 w - - 0 1")); ok {
+		t.Errorf("Expected material without a table not to be covered\n")
+	}
+}
+
+// longestWin walks through every placement of the material with the first
+// side, in white, to move
+func longestWin(t *testing.T, tb *tablebase.Tablebase, material string) int {
+	extra := piece.FromRune(rune(material[1])).Type() | piece.White
+	longest := 0
+	for white := 0; white < 64; white++ {
+		for black := 0; black < 64; black++ {
+			for sq := 8; sq < 56; sq++ {
+				if white == black || sq == white || sq == black {
+					continue
+				}
+				var board [64]piece.Piece
+				board[white] = piece.King | piece.White
+				board[black] = piece.King | piece.Black
+				board[sq] = extra
+				g := game.FromBoard(board, true)
+				if g.AttackedBy(black, piece.White) {
+					continue
+				}
+				wdl, plies, ok := tb.DTM(g)
+				if !ok {
+					t.Fatalf("Expected %v to be covered\n", g.ToFEN())
+				}
+				if wdl == search.Win && plies > longest {
+					longest = plies
+				}
+			}
+		}
+	}
+	return longest
+}
+
+func TestConsistentWithMoves(t *testing.T) {
+	tb := small(t)
+	r := rand.New(rand.NewSource(1))
+	for _, extra := range []piece.Piece{piece.Queen, piece.Rook, piece.Pawn} {
+		// Either color may have the extra piece
+		checkMoves(t, tb, r, 1000, piece.King|piece.White, piece.King|piece.Black, extra|piece.White)
+		checkMoves(t, tb, r, 1000, piece.King|piece.White, piece.King|piece.Black, extra|piece.Black)
+	}
+}
+
+// checkMoves sets up n random placements of pieces and checks that each
+// position's distance follows from its moves: the quickest win if any move
+// wins, otherwise the slowest loss
+func checkMoves(t *testing.T, tb *tablebase.Tablebase, r *rand.Rand, n int, pieces ...piece.Piece) {
+	for checked := 0; checked < n; {
+		g := randomPosition(r, pieces)
+		if g == nil {
+			continue
+		}
+		checked++
+
+		wdl, plies, ok := tb.DTM(g)
+		if !ok {
+			t.Fatalf("Expected %v to be covered\n", g.ToFEN())
+		}
+		want, wantPlies := search.Draw, 0
+		moves := g.AllLegalMoves()
+		if len(moves) == 0 && g.InCheck() {
+			want = search.Loss
+		}
+		for i, m := range moves {
+			g.MakeUnchecked(m)
+			next, nextPlies, ok := tb.DTM(g)
+			g.Unmake()
+			if !ok {
+				t.Fatalf("Expected the position after %v in %v to be covered\n", m, g.ToFEN())
+			}
+			if i == 0 || better(-next, nextPlies+1, want, wantPlies) {
+				want, wantPlies = -next, nextPlies+1
+			}
+		}
+		if want == search.Draw {
+			wantPlies = 0
+		}
+		if wdl != want || plies != wantPlies {
+			t.Fatalf("Expected %v in %v plies for %v, got %v in %v\n", want, wantPlies, g.ToFEN(), wdl, plies)
+		}
+	}
+}
+
+// randomPosition places pieces on random squares with a random side to
+// move, or returns nil if that isn't a legal position
+func randomPosition(r *rand.Rand, pieces []piece.Piece) *game.Game {
+	var board [64]piece.Piece
+	for i, sq := range r.Perm(64)[:len(pieces)] {
+		if pieces[i].Type() == piece.Pawn && (sq < 8 || sq >= 56) {
+			return nil
+		}
+		board[sq] = pieces[i]
+	}
+	g := game.FromBoard(board, r.Intn(2) == 0)
+	us, them := piece.Piece(piece.White), piece.Piece(piece.Black)
+	if !g.WhiteToMove {
+		us, them = them, us
+	}
+	if g.AttackedBy(g.Bitboard(piece.King|them).LSB(), us) {
+		return nil
+	}
+	return g
+}
+
+// better reports whether result a in aPlies is better than b in bPlies
+func better(a search.WDL, aPlies int, b search.WDL, bPlies int) bool {
+	switch {
+	case a != b:
+		return a > b
+	case a == search.Win:
+		return aPlies < bPlies
+	case a == search.Loss:
+		return aPlies > bPlies
+	}
+	return false
+}
+
+func TestMateSearchAgrees(t *testing.T) {
+	tb := small(t)
+	for _, fen := range []string{
+		"k7/8/1K6/8/8/8/8/7R w - - 0 1",
+		"k7/8/2K5/8/8/8/8/7Q w - - 0 1",
+		"2k5/8/3K4/8/8/8/8/7R w - - 0 1",
+	} {
+		g := fromFEN(t, fen)
+		wdl, plies, _ := tb.DTM(g)
+		if wdl != search.Win {
+			t.Fatalf("Expected %v to be won, got %v\n", fen, wdl)
+		}
+		moves := (plies + 1) / 2
+		if line := search.New(g, search.Limits{}).Mate(moves); len(line) != plies {
+			t.Errorf("Expected the mate search to find mate in %v plies for %v, got %v\n", plies, fen, line)
+		}
+		if moves > 1 && search.New(g, search.Limits{}).Mate(moves-1) != nil {
+			t.Errorf("Expected no mate in %v moves for %v\n", moves-1, fen)
+		}
+	}
+}
+
+func TestWriteAndOpen(t *testing.T) {
+	tb := small(t)
+	dir := t.TempDir()
+	for _, table := range tb.Tables() {
+		var buf bytes.Buffer
+		if err := table.Write(&buf); err != nil {
+			t.Fatalf("Failed to write %v: %v\n", table.Name(), err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, table.Name()+tablebase.Extension), buf.Bytes(), 0o644); err != nil {
+			t.Fatalf("Failed to write %v: %v\n", table.Name(), err)
+		}
+	}
+	loaded, err := tablebase.Open(dir)
+	if err != nil {
+		t.Fatalf("Failed to open tables: %v\n", err)
+	}
+	if len(loaded.Tables()) != len(tb.Tables()) || loaded.MaxPieces() != 3 {
+		t.Fatalf("Expected %v tables of up to 3 pieces, got %v of up to %v\n", len(tb.Tables()), len(loaded.Tables()), loaded.MaxPieces())
+	}
+	for i, table := range loaded.Tables() {
+		if table.String() != tb.Tables()[i].String() {
+			t.Errorf("Expected %v, got %v\n", tb.Tables()[i], table)
+		}
+	}
+
+	if _, err := tablebase.Load(bytes.NewReader([]byte("not a table"))); err == nil {
+		t.Errorf("Expected an error loading a file that isn't a table\n")
+	}
+	var buf bytes.Buffer
+	table, _ := tb.Table("KQvK")
+	table.Write(&buf)
+	if _, err := tablebase.Load(bytes.NewReader(buf.Bytes()[:buf.Len()/2])); err == nil {
+		t.Errorf("Expected an error loading a truncated table\n")
+	}
+}
+
+func TestGenerateErrors(t *testing.T) {
+	tb := tablebase.New()
+	for _, material := range []string{"KQRvKR", "KPvKP", "KQvKK", "KQ"} {
+		if err := tb.Generate(material); err == nil {
+			t.Errorf("Expected an error generating %v\n", material)
+		}
+	}
+}
+
+func TestSearchWithTables(t *testing.T) {
+	tb := small(t)
+	g := fromFEN(t, "8/8/8/4k3/8/8/8/KR6 w - - 0 1")
+	_, plies, _ := tb.DTM(g)
+	s := search.New(g, search.Limits{Depth: 2})
+	s.Tablebase = tb
+	pv := s.Run()
+	if len(pv) == 0 {
+		t.Fatalf("Expected a move\n")
+	}
+	g.MakeUnchecked(pv[0])
+	if wdl, next, _ := tb.DTM(g); wdl != search.Loss || next != plies-1 {
+		t.Errorf("Expected %v to keep the quickest mate, leaving a loss in %v plies, got %v in %v\n", pv[0], plies-1, wdl, next)
+	}
+}
+
+func TestFourPieces(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Building a 4 piece table takes a while")
+	}
+	tb := tablebase.New()
+	if err := tb.Generate("KRvKQ"); err != nil {
+		t.Fatalf("Failed to generate KQvKR: %v\n", err)
+	}
+	if _, ok := tb.Table("KRvK"); !ok {
+		t.Errorf("Expected the tables reached by captures to be built too\n")
+	}
+	// The queen takes up to 35 moves to mate, after a move by the rook
+	table, _ := tb.Table("KQvKR")
+	if want := "KQvKR: longest mate 70 plies"; !strings.HasPrefix(table.String(), want) {
+		t.Errorf("Expected %v, got %v\n", want, table)
+	}
+
+	r := rand.New(rand.NewSource(1))
+	checkMoves(t, tb, r, 1000, piece.King|piece.White, piece.Queen|piece.White, piece.King|piece.Black, piece.Rook|piece.Black)
+	checkMoves(t, tb, r, 1000, piece.King|piece.White, piece.Rook|piece.White, piece.King|piece.Black, piece.Queen|piece.Black)
+}
@@ -0,0 +1,274 @@
+// Package tune fits the weights of the handcrafted evaluation to game
+// results using Texel's method.
+//
+// Each training position is labelled with the result of the game it came
+// from. The evaluation of the quiet position reached by quiescence search is
+// mapped to an expected result with a logistic curve, and weights are nudged
+// one at a time for as long as that lowers the mean squared error against
+// the real results.
+package tune
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+
+	"bareman.net/chess-engine/eval"
+	"bareman.net/chess-engine/game"
+	"bareman.net/chess-engine/search"
+)
+
+// Weights which set scales or counts rather than scores, so aren't tuned
+// unless asked for
+var DefaultSkip = []string{"PhaseWeights", "MobilityBase", "KingDangerScale", "MaxKingDanger"}
+
+type Position struct {
+	// Quiet position reached from the original by quiescence search
+	Game *game.Game
+	// 1 for a white win, 0.5 for a draw and 0 for a black win
+	Result float64
+}
+
+// ReadPositions reads lines of "FEN [result]", where the result is one of
+// 1-0, 1/2-1/2 and 0-1, or the score for white as 1.0, 0.5 or 0.0. The move
+// counters may be left out of the FEN. Blank lines and lines starting with #
+// are skipped. Each position is replaced by the quiet position its
+// quiescence search ends in.
+func ReadPositions(r io.Reader) ([]Position, error) {
+	var positions []Position
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		p, err := parsePosition(text)
+		if err != nil {
+			return nil, fmt.Errorf("tune: line %v: %w", line, err)
+		}
+		positions = append(positions, p)
+	}
+	return positions, scanner.Err()
+}
+
+func parsePosition(text string) (Position, error) {
+	open, end := strings.LastIndex(text, "["), strings.LastIndex(text, "]")
+	if open == -1 || end < open {
+		return Position{}, fmt.Errorf("missing [result]")
+	}
+	result, err := parseResult(strings.TrimSpace(text[open+1 : end]))
+	if err != nil {
+		return Position{}, err
+	}
+
+	fields := strings.Fields(text[:open])
+	if len(fields) == 4 {
+		fields = append(fields, "0", "1")
+	}
+	g, err := game.FromFEN(strings.Join(fields, " "))
+	if err != nil {
+		return Position{}, err
+	}
+	_, pv := search.New(g, search.Limits{}).Quiesce()
+	for _, m := range pv {
+		g.MakeUnchecked(m)
+	}
+	return Position{Game: g, Result: result}, nil
+}
+
+func parseResult(s string) (float64, error) {
+	switch s {
+	case "1-0":
+		return 1, nil
+	case "0-1":
+		return 0, nil
+	case "1/2-1/2":
+		return 0.5, nil
+	}
+	result, err := strconv.ParseFloat(s, 64)
+	if err != nil || result < 0 || result > 1 {
+		return 0, fmt.Errorf("invalid result %q", s)
+	}
+	return result, nil
+}
+
+type Tuner struct {
+	Positions []Position
+	// Scales evaluations before the logistic curve. Set by FitK.
+	K float64
+	// Names of Params fields to leave alone. Defaults to DefaultSkip.
+	Skip []string
+	// Number of goroutines computing the loss. Defaults to the number of
+	// CPUs.
+	Workers int
+	// Called after each pass over the weights, if set
+	Report func(pass int, loss float64)
+}
+
+func New(positions []Position) *Tuner {
+	return &Tuner{Positions: positions, K: 1, Skip: DefaultSkip}
+}
+
+// Loss puts p in use and returns the mean squared error between the
+// predicted and real results
+func (t *Tuner) Loss(p eval.Params) float64 {
+	eval.SetParams(p)
+	return t.loss()
+}
+
+func (t *Tuner) loss() float64 {
+	workers := t.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	sums := make([]float64, workers)
+	tables := eval.Tables()
+	var wg sync.WaitGroup
+	chunk := (len(t.Positions) + workers - 1) / workers
+	for w := 0; w < workers; w++ {
+		start, end := w*chunk, (w+1)*chunk
+		if end > len(t.Positions) {
+			end = len(t.Positions)
+		}
+		if start >= end {
+			break
+		}
+		wg.Add(1)
+		go func(w int, positions []Position) {
+			defer wg.Done()
+			for _, p := range positions {
+				p.Game.SetPieceSquareTables(tables)
+				diff := p.Result - t.predict(whiteScore(p.Game))
+				sums[w] += diff * diff
+			}
+		}(w, t.Positions[start:end])
+	}
+	wg.Wait()
+
+	var sum float64
+	for _, s := range sums {
+		sum += s
+	}
+	return sum / float64(len(t.Positions))
+}
+
+// predict maps a score for white to the expected result
+func (t *Tuner) predict(score int) float64 {
+	return 1 / (1 + math.Pow(10, -t.K*float64(score)/400))
+}
+
+func whiteScore(g *game.Game) int {
+	score := eval.Evaluate(g)
+	if !g.WhiteToMove {
+		return -score
+	}
+	return score
+}
+
+// FitK finds the K minimising the loss with the weights in use, so tuning
+// starts from the scale that best fits them
+func (t *Tuner) FitK() float64 {
+	eval.SetParams(eval.CurrentParams())
+	best, bestLoss := t.K, t.loss()
+	for step := 0.1; step >= 0.0001; step /= 10 {
+		for improved := true; improved; {
+			improved = false
+			for _, k := range []float64{best - step, best + step} {
+				if k <= 0 {
+					continue
+				}
+				t.K = k
+				if loss := t.loss(); loss < bestLoss {
+					best, bestLoss, improved = k, loss, true
+				}
+			}
+		}
+	}
+	t.K = best
+	return best
+}
+
+// Tune improves start by local search, trying each weight one higher and
+// one lower and keeping changes that reduce the loss. It stops after passes
+// passes, or earlier once no change helps. The weights found so far are put
+// in use after every pass, before Report is called.
+func (t *Tuner) Tune(start eval.Params, passes int) eval.Params {
+	params := start
+	weights := t.weights(&params)
+	best := t.Loss(params)
+
+	// Weights that make no difference to any position are dropped after the
+	// first pass
+	active := make([]bool, len(weights))
+	for i := range active {
+		active[i] = true
+	}
+	for pass := 1; pass <= passes; pass++ {
+		improved := false
+		for i, w := range weights {
+			if !active[i] {
+				continue
+			}
+			changed := false
+			for _, delta := range []int{1, -2} {
+				*w += delta
+				loss := t.Loss(params)
+				if loss != best {
+					changed = true
+				}
+				if loss < best {
+					best, improved = loss, true
+					break
+				}
+				if delta == -2 {
+					*w++
+				}
+			}
+			if pass == 1 && !changed {
+				active[i] = false
+			}
+		}
+		eval.SetParams(params)
+		if t.Report != nil {
+			t.Report(pass, best)
+		}
+		if !improved {
+			break
+		}
+	}
+	return params
+}
+
+// weights returns pointers to every tunable integer in p
+func (t *Tuner) weights(p *eval.Params) []*int {
+	skip := map[string]bool{}
+	for _, name := range t.Skip {
+		skip[name] = true
+	}
+	var weights []*int
+	v := reflect.ValueOf(p).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		if !skip[v.Type().Field(i).Name] {
+			weights = appendInts(weights, v.Field(i))
+		}
+	}
+	return weights
+}
+
+func appendInts(weights []*int, v reflect.Value) []*int {
+	switch v.Kind() {
+	case reflect.Int:
+		return append(weights, v.Addr().Interface().(*int))
+	case reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			weights = appendInts(weights, v.Index(i))
+		}
+	}
+	return weights
+}
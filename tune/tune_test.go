@@ -0,0 +1,79 @@
+package tune_test
+
+import (
+	"strings"
+	"testing"
+
+	"bareman.net/chess-engine/eval"
+	"bareman.net/chess-engine/game/piece"
+	"bareman.net/chess-engine/tune"
+)
+
+const dataset = `
+# Extra material wins
+4k3/8/8/8/8/8/8/3QK3 w - - [1-0]
+3qk3/8/8/8/8/8/8/4K3 w - - 0 1 [0-1]
+4k3/8/8/8/8/8/8/2N1K3 b - - 0 1 [1/2-1/2]
+4k3/8/8/8/8/8/8/R3K3 w - - 0 1 [1.0]
+r3k3/8/8/8/8/8/8/4K3 b - - 0 1 [0.0]
+4k3/pppp4/8/8/8/8/PPPP4/4K3 w - - 0 1 [0.5]
+2n1k3/8/8/8/8/8/8/4K3 w - - 0 1 [0.5]
+4k3/8/8/8/8/8/8/1B2K3 w - - 0 1 [0.5]
+4k3/8/8/8/8/8/4P3/1R2K3 w - - 0 1 [1-0]
+1r2k3/4p3/8/8/8/8/8/4K3 w - - 0 1 [0-1]
+4k3/8/8/3p4/4Q3/8/8/4K3 w - - 0 1 [1-0]
+`
+
+func TestReadPositions(t *testing.T) {
+	positions, err := tune.ReadPositions(strings.NewReader(dataset))
+	if err != nil {
+		t.Fatalf("Failed to read positions: %v\n", err)
+	}
+	if len(positions) != 11 {
+		t.Fatalf("Expected 11 positions, got %v\n", len(positions))
+	}
+	if r := positions[2].Result; r != 0.5 {
+		t.Errorf("Expected a draw to read as 0.5, got %v\n", r)
+	}
+	// Black's pawn hangs to the queen, so quiescence search ends after the
+	// capture
+	if fen := positions[10].Game.ToFEN(); !strings.HasPrefix(fen, "4k3/8/8/3Q4/8/8/8/4K3 b") {
+		t.Errorf("Expected the quiet position after Qxd5, got %v\n", fen)
+	}
+
+	invalid := []string{
+		"4k3/8/8/8/8/8/8/3QK3 w - - 0 1",
+		"4k3/8/8/8/8/8/8/3QK3 w - - 0 1 [2-0]",
+		"4k3/8/8 w - - 0 1 [1-0]",
+	}
+	for _, line := range invalid {
+		if _, err := tune.ReadPositions(strings.NewReader(line)); err == nil {
+			t.Errorf("Expected an error reading %q\n", line)
+		}
+	}
+}
+
+func TestTune(t *testing.T) {
+	original := eval.CurrentParams()
+	defer eval.SetParams(original)
+
+	positions, err := tune.ReadPositions(strings.NewReader(dataset))
+	if err != nil {
+		t.Fatalf("Failed to read positions: %v\n", err)
+	}
+	start := original
+	start.MidgameValues[piece.Queen] = 100
+	start.EndgameValues[piece.Queen] = 100
+
+	tuner := tune.New(positions)
+	tuner.K = 1
+	before := tuner.Loss(start)
+	tuned := tuner.Tune(start, 2)
+	after := tuner.Loss(tuned)
+	if after >= before {
+		t.Errorf("Expected tuning to lower the loss from %v, got %v\n", before, after)
+	}
+	if tuned == start {
+		t.Errorf("Expected tuning to change some weights\n")
+	}
+}